@@ -0,0 +1,362 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Stream appends the rows to the table.
+type Stream interface {
+	// Append appends the rows. It returns the errors of the rejected rows by their index,
+	// or the error if the whole batch failed. The batch with rejected rows is not appended.
+	Append(ctx context.Context, rows [][]byte) (map[int]error, error)
+
+	Close() error
+}
+
+// ErrWriterClosed the error returned when the rows are written to the closed BatchWriter.
+var ErrWriterClosed = errors.New("batch writer is closed")
+
+// RowsError the error of the rejected rows by their index in DataWriter.Data.
+type RowsError struct {
+	Errors map[int]error
+}
+
+func (e RowsError) Error() string {
+	idx := make([]int, 0, len(e.Errors))
+	for i := range e.Errors {
+		idx = append(idx, i)
+	}
+	sort.Ints(idx)
+
+	msg := make([]string, len(idx))
+	for k, i := range idx {
+		msg[k] = "[row:" + strconv.Itoa(i) + "] " + e.Errors[i].Error()
+	}
+	return strconv.Itoa(len(idx)) + " rows rejected: " + strings.Join(msg, "; ")
+}
+
+// BatchWriterConfig defines when the buffered rows are flushed.
+type BatchWriterConfig struct {
+	// MaxRows the number of rows to flush, defaults to 500.
+	MaxRows int
+
+	// MaxBytes the size of rows to flush, defaults to 5MB.
+	MaxBytes int
+
+	// Interval the max time the rows are buffered, defaults to 2s.
+	Interval time.Duration
+
+	// Streams the max number of streams per table, defaults to 1.
+	Streams int
+
+	// Timeout the timeout to append the batch, defaults to 30s.
+	Timeout time.Duration
+}
+
+// BatchWriter buffers the rows written by all workers and appends them in batches through the shared streams.
+// It is safe for concurrent use.
+type BatchWriter struct {
+	client GBQClient
+	cfg    BatchWriterConfig
+
+	tables map[string]*batchTable
+	closed bool
+	mu     sync.Mutex
+	wg     sync.WaitGroup
+}
+
+type batchWaiter struct {
+	offset, n int
+	done      chan error
+}
+
+type batchTable struct {
+	path       string
+	descriptor *descriptorpb.DescriptorProto
+
+	rows    [][]byte
+	size    int
+	waiters []batchWaiter
+	timer   *time.Timer
+
+	streams chan Stream
+	open    int
+}
+
+// NewBatchWriter init the writer opening the streams with the client.
+func NewBatchWriter(client GBQClient, cfg BatchWriterConfig) *BatchWriter {
+	if cfg.MaxRows <= 0 {
+		cfg.MaxRows = 500
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = 5 << 20
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 2 * time.Second
+	}
+	if cfg.Streams <= 0 {
+		cfg.Streams = 1
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	return &BatchWriter{client: client, cfg: cfg, tables: map[string]*batchTable{}}
+}
+
+// Write buffers the data's rows for the specified path and blocks until they are appended.
+// It returns RowsError if any row was rejected. The rows may still be appended if the context is done before.
+func (w *BatchWriter) Write(ctx context.Context, data DataWriter, path string) error {
+	rows := data.Data()
+	if len(rows) == 0 {
+		return nil
+	}
+
+	done := make(chan error, 1)
+
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrWriterClosed
+	}
+
+	t, ok := w.tables[path]
+	if !ok {
+		t = &batchTable{path: path, descriptor: data.Descriptor(), streams: make(chan Stream, w.cfg.Streams)}
+		w.tables[path] = t
+	}
+
+	t.waiters = append(t.waiters, batchWaiter{offset: len(t.rows), n: len(rows), done: done})
+	for _, r := range rows {
+		t.rows = append(t.rows, r)
+		t.size += len(r)
+	}
+
+	switch {
+	case len(t.rows) >= w.cfg.MaxRows || t.size >= w.cfg.MaxBytes:
+		w.flush(t)
+	case t.timer == nil:
+		t.timer = time.AfterFunc(
+			w.cfg.Interval, func() {
+				w.mu.Lock()
+				defer w.mu.Unlock()
+				w.flush(t)
+			},
+		)
+	}
+	w.mu.Unlock()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// flush detaches the buffered rows of the table and appends them in the background. The lock must be held.
+func (w *BatchWriter) flush(t *batchTable) {
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	if len(t.rows) == 0 {
+		return
+	}
+
+	rows, waiters := t.rows, t.waiters
+	t.rows, t.waiters, t.size = nil, nil, 0
+
+	// the idle stream is taken, a new one is opened if the limit is not reached, or the idle one is awaited
+	var stream Stream
+	isNew := false
+	select {
+	case stream = <-t.streams:
+	default:
+		if t.open < w.cfg.Streams {
+			t.open++
+			isNew = true
+		}
+	}
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		stream, err := w.stream(t, stream, isNew)
+		if err != nil {
+			for _, wt := range waiters {
+				wt.done <- err
+			}
+			return
+		}
+
+		rowErrs, err := w.append(stream, rows)
+		if err != nil {
+			// the broken stream is replaced by a new one
+			_ = stream.Close()
+			stream = nil
+		}
+		w.release(t, stream)
+
+		for _, wt := range waiters {
+			if err != nil {
+				wt.done <- err
+				continue
+			}
+
+			var e map[int]error
+			for i := 0; i < wt.n; i++ {
+				if er, ok := rowErrs[wt.offset+i]; ok {
+					if e == nil {
+						e = map[int]error{}
+					}
+					e[i] = er
+				}
+			}
+			if e != nil {
+				wt.done <- RowsError{Errors: e}
+				continue
+			}
+			wt.done <- nil
+		}
+	}()
+}
+
+// stream returns the stream s, opens a new one if isNew, or awaits the idle one, or the free slot to open a new one.
+func (w *BatchWriter) stream(t *batchTable, s Stream, isNew bool) (Stream, error) {
+	if s != nil {
+		return s, nil
+	}
+
+	deadline := time.NewTimer(w.cfg.Timeout)
+	defer deadline.Stop()
+
+	for {
+		if isNew {
+			ctx, cancel := context.WithTimeout(context.Background(), w.cfg.Timeout)
+			s, err := w.client.OpenStream(ctx, t.path, t.descriptor)
+			cancel()
+			if err != nil {
+				w.release(t, nil)
+				return nil, err
+			}
+			return s, nil
+		}
+
+		select {
+		case s := <-t.streams:
+			return s, nil
+		case <-deadline.C:
+			return nil, errors.New("timeout waiting for the idle stream to " + t.path)
+		case <-time.After(100 * time.Millisecond):
+			// the slot is freed when the broken stream is closed
+			w.mu.Lock()
+			if t.open < w.cfg.Streams {
+				t.open++
+				isNew = true
+			}
+			w.mu.Unlock()
+		}
+	}
+}
+
+// release returns the stream to the pool, nil stream frees the slot.
+func (w *BatchWriter) release(t *batchTable, s Stream) {
+	if s == nil {
+		w.mu.Lock()
+		t.open--
+		w.mu.Unlock()
+		return
+	}
+	t.streams <- s
+}
+
+// append appends the rows, the rows which were not rejected are appended again if the batch had rejected rows.
+func (w *BatchWriter) append(s Stream, rows [][]byte) (map[int]error, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), w.cfg.Timeout)
+	defer cancel()
+
+	rowErrs, err := s.Append(ctx, rows)
+	if err != nil || len(rowErrs) == 0 {
+		return nil, err
+	}
+
+	var (
+		rest [][]byte
+		idx  []int
+	)
+	for i, r := range rows {
+		if _, ok := rowErrs[i]; !ok {
+			rest = append(rest, r)
+			idx = append(idx, i)
+		}
+	}
+	if len(rest) == 0 {
+		return rowErrs, nil
+	}
+
+	errs, err := s.Append(ctx, rest)
+	if err != nil {
+		for _, i := range idx {
+			rowErrs[i] = err
+		}
+		return rowErrs, nil
+	}
+	for k, e := range errs {
+		rowErrs[idx[k]] = e
+	}
+	return rowErrs, nil
+}
+
+// Close flushes the buffered rows, waits for the appends in flight and closes the streams.
+func (w *BatchWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	for _, t := range w.tables {
+		w.flush(t)
+	}
+	w.mu.Unlock()
+
+	w.wg.Wait()
+
+	var msg []string
+	for _, t := range w.tables {
+		close(t.streams)
+		for s := range t.streams {
+			if err := s.Close(); err != nil {
+				msg = append(msg, t.path+": "+err.Error())
+			}
+		}
+	}
+	if len(msg) > 0 {
+		sort.Strings(msg)
+		return errors.New("error closing streams: " + strings.Join(msg, "; "))
+	}
+	return nil
+}
+
+type batchedClient struct {
+	GBQClient
+	w *BatchWriter
+}
+
+func (c batchedClient) Write(ctx context.Context, data DataWriter, path string) error {
+	return c.w.Write(ctx, data, path)
+}
+
+// NewBatchedClient returns the client writing through the BatchWriter w.
+func NewBatchedClient(client GBQClient, w *BatchWriter) GBQClient {
+	return batchedClient{GBQClient: client, w: w}
+}
@@ -0,0 +1,240 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+type mockRows [][]byte
+
+func (d mockRows) Data() [][]byte {
+	return d
+}
+
+func (d mockRows) Descriptor() *descriptorpb.DescriptorProto {
+	return &descriptorpb.DescriptorProto{}
+}
+
+// mockStream records the appended batches, the rows equal to "reject" are rejected.
+type mockStream struct {
+	c *mockStreamClient
+}
+
+func (s mockStream) Append(_ context.Context, rows [][]byte) (map[int]error, error) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	if s.c.appendErr != nil {
+		return nil, s.c.appendErr
+	}
+
+	var rowErrs map[int]error
+	for i, r := range rows {
+		if string(r) == "reject" {
+			if rowErrs == nil {
+				rowErrs = map[int]error{}
+			}
+			rowErrs[i] = errors.New("rejected")
+		}
+	}
+	if rowErrs != nil {
+		return rowErrs, nil
+	}
+
+	s.c.batches = append(s.c.batches, rows)
+	return nil, nil
+}
+
+func (s mockStream) Close() error {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+	s.c.closed++
+	return nil
+}
+
+type mockStreamClient struct {
+	GBQClient
+
+	appendErr error
+	opened    int
+	closed    int
+	batches   [][][]byte
+	mu        sync.Mutex
+}
+
+func (c *mockStreamClient) OpenStream(_ context.Context, _ string, _ *descriptorpb.DescriptorProto) (Stream, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.opened++
+	return mockStream{c: c}, nil
+}
+
+func TestBatchWriter(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         BatchWriterConfig
+		writes      int
+		wantBatches int
+	}{
+		{
+			name:        "flush on rows count",
+			cfg:         BatchWriterConfig{MaxRows: 10, Interval: time.Hour},
+			writes:      20,
+			wantBatches: 2,
+		},
+		{
+			name:        "flush on size",
+			cfg:         BatchWriterConfig{MaxBytes: 15, Interval: time.Hour},
+			writes:      20,
+			wantBatches: 5,
+		},
+		{
+			name:        "flush on interval",
+			cfg:         BatchWriterConfig{Interval: 10 * time.Millisecond},
+			writes:      5,
+			wantBatches: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				c := &mockStreamClient{}
+				w := NewBatchWriter(c, tt.cfg)
+
+				var wg sync.WaitGroup
+				wg.Add(tt.writes)
+				for i := 0; i < tt.writes; i++ {
+					go func(i int) {
+						defer wg.Done()
+						// every row is 4 bytes long
+						row := []byte("r" + strconv.Itoa(100+i))
+						if err := w.Write(context.TODO(), mockRows{row}, "foo"); err != nil {
+							t.Errorf("Write() unexpected error = %v", err)
+						}
+					}(i)
+				}
+				wg.Wait()
+
+				if err := w.Close(); err != nil {
+					t.Errorf("Close() unexpected error = %v", err)
+				}
+
+				if len(c.batches) != tt.wantBatches {
+					t.Errorf("batches = %v, want %v", len(c.batches), tt.wantBatches)
+				}
+
+				var rows int
+				for _, b := range c.batches {
+					rows += len(b)
+				}
+				if rows != tt.writes {
+					t.Errorf("rows = %v, want %v", rows, tt.writes)
+				}
+
+				if c.opened != 1 || c.closed != 1 {
+					t.Errorf("streams opened = %v, closed = %v, want 1", c.opened, c.closed)
+				}
+			},
+		)
+	}
+}
+
+func TestBatchWriter_rowErrors(t *testing.T) {
+	c := &mockStreamClient{}
+	// the rows of both writes are flushed in one batch
+	w := NewBatchWriter(c, BatchWriterConfig{MaxRows: 3, Interval: time.Hour})
+
+	var (
+		wg        sync.WaitGroup
+		errFaulty error
+		errValid  error
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		errFaulty = w.Write(context.TODO(), mockRows{[]byte("foo"), []byte("reject")}, "foo")
+	}()
+	go func() {
+		defer wg.Done()
+		errValid = w.Write(context.TODO(), mockRows{[]byte("bar")}, "foo")
+	}()
+	wg.Wait()
+
+	var rowsErr RowsError
+	if !errors.As(errFaulty, &rowsErr) {
+		t.Fatalf("Write() error = %v, want RowsError", errFaulty)
+	}
+	if _, ok := rowsErr.Errors[1]; !ok || len(rowsErr.Errors) != 1 {
+		t.Errorf("Write() rows errors = %v, want the error of the row 1", rowsErr.Errors)
+	}
+
+	if errValid != nil {
+		t.Errorf("Write() unexpected error = %v", errValid)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Errorf("Close() unexpected error = %v", err)
+	}
+
+	if len(c.batches) != 1 || len(c.batches[0]) != 2 {
+		t.Errorf("the valid rows must be appended again, got = %v", c.batches)
+	}
+}
+
+func TestBatchWriter_appendError(t *testing.T) {
+	c := &mockStreamClient{appendErr: errors.New("foo")}
+	w := NewBatchWriter(c, BatchWriterConfig{MaxRows: 1})
+
+	if err := w.Write(context.TODO(), mockRows{[]byte("foo")}, "foo"); err == nil {
+		t.Errorf("Write() error expected")
+	}
+
+	c.mu.Lock()
+	c.appendErr = nil
+	c.mu.Unlock()
+
+	if err := w.Write(context.TODO(), mockRows{[]byte("foo")}, "foo"); err != nil {
+		t.Errorf("Write() unexpected error = %v", err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Errorf("Close() unexpected error = %v", err)
+	}
+
+	if c.opened != 2 {
+		t.Errorf("the broken stream must be replaced, opened = %v", c.opened)
+	}
+
+	if err := w.Write(context.TODO(), mockRows{[]byte("foo")}, "foo"); !errors.Is(err, ErrWriterClosed) {
+		t.Errorf("Write() error = %v, want %v", err, ErrWriterClosed)
+	}
+}
+
+func TestBatchWriter_Close(t *testing.T) {
+	c := &mockStreamClient{}
+	w := NewBatchWriter(c, BatchWriterConfig{Interval: time.Hour})
+
+	done := make(chan error)
+	go func() {
+		done <- w.Write(context.TODO(), mockRows{[]byte("foo")}, "foo")
+	}()
+
+	// the rows are buffered until the writer is closed
+	time.Sleep(10 * time.Millisecond)
+
+	if err := w.Close(); err != nil {
+		t.Errorf("Close() unexpected error = %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Write() unexpected error = %v", err)
+	}
+	if len(c.batches) != 1 {
+		t.Errorf("the buffered rows must be flushed on close, got = %v", c.batches)
+	}
+}
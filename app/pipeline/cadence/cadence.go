@@ -0,0 +1,69 @@
+// Package cadence aggregates the release cadence of the modules listed in the index
+// to the release_cadence table using the remote function cadence, see app/udf/cadence.
+package cadence
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/kislerdm/gomodanalysis/app/pipeline"
+)
+
+// DefaultFunction the default name of the remote function in the warehouse dataset.
+const DefaultFunction = "cadence"
+
+// Function returns the remote function set as name, or dataset.name, defaults to DefaultFunction
+// in the warehouse dataset.
+func Function(wh pipeline.Warehouse, v string) (pipeline.TableRef, error) {
+	o := pipeline.TableRef{ProjectID: wh.ProjectID, Dataset: wh.Dataset, Table: v}
+	if v == "" {
+		o.Table = DefaultFunction
+		return o, nil
+	}
+
+	if els := strings.Split(v, "."); len(els) > 1 {
+		if len(els) != 2 || els[0] == "" || els[1] == "" {
+			return pipeline.TableRef{}, errors.New("faulty function " + v + ", function, or dataset.function expected")
+		}
+		o.Dataset, o.Table = els[0], els[1]
+	}
+	return o, nil
+}
+
+// columns the columns of the release_cadence table set from the function's reply, except path and timestamp.
+var columns = []string{
+	"releases", "median_days_between", "p90_days_between", "days_since_last",
+	"major_bumps", "minor_bumps", "patch_bumps", "releases_last_12_months",
+}
+
+// query defines the query to append the release cadence of every module in the index.
+// The function replies JSON, the null values, e.g. the median of the module with a single release,
+// are converted to NULL.
+func query(wh pipeline.Warehouse, fn pipeline.TableRef) string {
+	vals := make([]string, len(columns))
+	for i, c := range columns {
+		conv := "LAX_INT64"
+		if strings.HasSuffix(c, "_days_between") {
+			conv = "LAX_FLOAT64"
+		}
+		vals[i] = conv + "(s." + c + ")"
+	}
+
+	return "INSERT INTO " + wh.Table(pipeline.TableReleaseCadence).ID() + " " +
+		"(path, " + strings.Join(columns, ", ") + ", timestamp) " +
+		"SELECT path, " + strings.Join(vals, ", ") + ", CURRENT_TIMESTAMP() " +
+		"FROM (" +
+		"SELECT path, " + fn.ID() + "(" +
+		"ARRAY_AGG(version ORDER BY timestamp), ARRAY_AGG(UNIX_MICROS(timestamp) ORDER BY timestamp)" +
+		") AS s " +
+		"FROM " + wh.Table(pipeline.TableIndex).ID() + " GROUP BY path);"
+}
+
+// Aggregate appends the release cadence of every module in the index to the release_cadence table.
+func Aggregate(ctx context.Context, client pipeline.GBQClient, wh pipeline.Warehouse, fn pipeline.TableRef) error {
+	if _, err := client.Read(ctx, query(wh, fn)); err != nil {
+		return errors.New("error aggregating release cadence: " + err.Error())
+	}
+	return nil
+}
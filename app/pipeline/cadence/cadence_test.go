@@ -0,0 +1,125 @@
+package cadence
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kislerdm/gomodanalysis/app/pipeline"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+type mockGBQClient struct {
+	err     error
+	queries []string
+}
+
+func (c *mockGBQClient) Read(_ context.Context, query string, _ ...pipeline.QueryParam) (
+	pipeline.DataReader, error,
+) {
+	c.queries = append(c.queries, query)
+	return nil, c.err
+}
+
+func (c *mockGBQClient) Iterate(_ context.Context, _ string, _ ...pipeline.QueryParam) (pipeline.Rows, error) {
+	panic("not implemented")
+}
+
+func (c *mockGBQClient) Write(_ context.Context, _ pipeline.DataWriter, _ string) error {
+	panic("not implemented")
+}
+
+func (c *mockGBQClient) OpenStream(_ context.Context, _ string, _ *descriptorpb.DescriptorProto) (
+	pipeline.Stream, error,
+) {
+	panic("not implemented")
+}
+
+func (c *mockGBQClient) Close() error {
+	return nil
+}
+
+func TestFunction(t *testing.T) {
+	wh := pipeline.Warehouse{ProjectID: "p", Dataset: "d"}
+
+	tests := []struct {
+		name    string
+		v       string
+		want    pipeline.TableRef
+		wantErr bool
+	}{
+		{name: "default", want: pipeline.TableRef{ProjectID: "p", Dataset: "d", Table: "cadence"}},
+		{name: "name", v: "foo", want: pipeline.TableRef{ProjectID: "p", Dataset: "d", Table: "foo"}},
+		{name: "dataset and name", v: "udf.foo", want: pipeline.TableRef{ProjectID: "p", Dataset: "udf", Table: "foo"}},
+		{name: "faulty", v: "p.udf.foo", wantErr: true},
+		{name: "empty name", v: "udf.", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got, err := Function(wh, tt.v)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("Function() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Function() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	wh := pipeline.Warehouse{
+		ProjectID: "p",
+		Dataset:   "d",
+		Tables: map[string]pipeline.TableRef{
+			pipeline.TableReleaseCadence: {ProjectID: "p", Dataset: "stats", Table: "release_cadence"},
+		},
+	}
+	fn := pipeline.TableRef{ProjectID: "p", Dataset: "udf", Table: "cadence"}
+
+	tests := []struct {
+		name         string
+		client       *mockGBQClient
+		wantContains []string
+		wantErr      bool
+	}{
+		{
+			name:   "happy path",
+			client: &mockGBQClient{},
+			wantContains: []string{
+				"INSERT INTO `p.stats.release_cadence`",
+				"`p.udf.cadence`(ARRAY_AGG(version ORDER BY timestamp), " +
+					"ARRAY_AGG(UNIX_MICROS(timestamp) ORDER BY timestamp))",
+				"FROM `p.d.index` GROUP BY path",
+				"LAX_FLOAT64(s.median_days_between)",
+				"LAX_INT64(s.releases_last_12_months)",
+			},
+		},
+		{
+			name:    "query error",
+			client:  &mockGBQClient{err: errors.New("foo")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if err := Aggregate(context.TODO(), tt.client, wh, fn); (err != nil) != tt.wantErr {
+					t.Fatalf("Aggregate() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if len(tt.client.queries) != 1 {
+					t.Fatalf("Aggregate() run %d queries, want 1", len(tt.client.queries))
+				}
+				for _, s := range tt.wantContains {
+					if !strings.Contains(tt.client.queries[0], s) {
+						t.Errorf("Aggregate() query = %s, want it to contain %s", tt.client.queries[0], s)
+					}
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/kislerdm/gomodanalysis/app/pipeline"
+	"github.com/kislerdm/gomodanalysis/app/pipeline/cadence"
+)
+
+func init() {
+	register(
+		Command{
+			Name:  "aggregate",
+			Usage: "aggregates the statistics of the modules, e.g. the release cadence",
+			Run:   runAggregate,
+		},
+	)
+}
+
+// aggregation appends the statistics of the modules to the warehouse table.
+type aggregation func(
+	ctx context.Context, client pipeline.GBQClient, wh pipeline.Warehouse, getenv func(string) string,
+) error
+
+// aggregations the aggregations by name.
+var aggregations = map[string]aggregation{
+	"cadence": aggregateCadence,
+}
+
+func aggregateCadence(
+	ctx context.Context, client pipeline.GBQClient, wh pipeline.Warehouse, getenv func(string) string,
+) error {
+	fn, err := cadence.Function(wh, getenv("CADENCE_FUNCTION"))
+	if err != nil {
+		return err
+	}
+	return cadence.Aggregate(ctx, client, wh, fn)
+}
+
+// aggregationNames returns the aggregations set as the comma-separated list, all aggregations if v is empty.
+func aggregationNames(v string) ([]string, error) {
+	if v == "" {
+		o := make([]string, 0, len(aggregations))
+		for k := range aggregations {
+			o = append(o, k)
+		}
+		sort.Strings(o)
+		return o, nil
+	}
+
+	o := strings.Split(v, ",")
+	for _, name := range o {
+		if _, ok := aggregations[name]; !ok {
+			return nil, errors.New("unknown aggregation " + name)
+		}
+	}
+	return o, nil
+}
+
+func runAggregate(ctx context.Context, getenv func(string) string) error {
+	wh, err := pipeline.NewWarehouse(getenv)
+	if err != nil {
+		return err
+	}
+
+	names, err := aggregationNames(getenv("AGGREGATIONS"))
+	if err != nil {
+		return err
+	}
+
+	client, err := newGBQClient(ctx, wh.ProjectID)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = client.Close() }()
+
+	for _, name := range names {
+		if err := aggregations[name](ctx, client, wh, getenv); err != nil {
+			return err
+		}
+		log.Println(name + " aggregated")
+	}
+
+	log.Println("done")
+	return nil
+}
@@ -0,0 +1,32 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_aggregationNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       string
+		want    []string
+		wantErr bool
+	}{
+		{name: "all by default", want: []string{"cadence"}},
+		{name: "selected", v: "cadence", want: []string{"cadence"}},
+		{name: "unknown", v: "cadence,foo", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got, err := aggregationNames(tt.v)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("aggregationNames() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("aggregationNames() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,233 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/kislerdm/gomodanalysis/app/pipeline"
+)
+
+// Command the subcommand of the gomodanalysis binary.
+type Command struct {
+	Name  string
+	Usage string
+
+	// Run runs the command reading its configuration with the function getenv.
+	Run func(ctx context.Context, getenv func(string) string) error
+}
+
+// Commands the subcommands by name.
+var Commands = map[string]Command{}
+
+func register(c Command) {
+	Commands[c.Name] = c
+}
+
+// ConfigFile the configuration file.
+type ConfigFile struct {
+	// Env the configuration values shared by all commands.
+	Env map[string]string `json:"env"`
+
+	// Stages the stages executed by the run command.
+	Stages []Stage `json:"stages"`
+}
+
+// LoadConfigFile reads the JSON configuration file, the empty path yields the empty configuration.
+func LoadConfigFile(path string) (ConfigFile, error) {
+	if path == "" {
+		return ConfigFile{}, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ConfigFile{}, errors.New("error reading config file: " + err.Error())
+	}
+
+	var o ConfigFile
+	if err := json.Unmarshal(b, &o); err != nil {
+		return ConfigFile{}, errors.New("faulty config file " + path + ": " + err.Error())
+	}
+	return o, nil
+}
+
+// Config resolves the configuration values in the order of precedence: the flags, the stage's values,
+// the env variables and the config file values. The stage's values override the env variables, so the stages of
+// the same run can be configured differently, e.g. with their own QUERY_MAX_BYTES.
+type Config struct {
+	Flags   map[string]string
+	Getenv  func(string) string
+	Stage   map[string]string
+	Default map[string]string
+}
+
+// Get returns the configuration value of the key.
+func (c Config) Get(key string) string {
+	if v, ok := c.Flags[key]; ok {
+		return v
+	}
+	if v, ok := c.Stage[key]; ok {
+		return v
+	}
+	if c.Getenv != nil {
+		if v := c.Getenv(key); v != "" {
+			return v
+		}
+	}
+	return c.Default[key]
+}
+
+// WithStage returns the configuration with the values of the stage.
+func (c Config) WithStage(env map[string]string) Config {
+	c.Stage = env
+	return c
+}
+
+type costGuardKey struct{}
+
+// newGBQClient init the GBQ client guarded by the cost guard of the run.
+func newGBQClient(ctx context.Context, projectID string) (pipeline.GBQClient, error) {
+	guard, _ := ctx.Value(costGuardKey{}).(*pipeline.CostGuard)
+	return pipeline.NewGBQClient(ctx, projectID, pipeline.GBQConfig{CostGuard: guard})
+}
+
+type setFlags map[string]string
+
+func (f setFlags) String() string {
+	o := make([]string, 0, len(f))
+	for k, v := range f {
+		o = append(o, k+"="+v)
+	}
+	sort.Strings(o)
+	return strings.Join(o, ",")
+}
+
+func (f setFlags) Set(s string) error {
+	els := strings.SplitN(s, "=", 2)
+	if len(els) != 2 || els[0] == "" {
+		return errors.New("KEY=VALUE expected")
+	}
+	f[els[0]] = els[1]
+	return nil
+}
+
+type options struct {
+	config   string
+	flags    setFlags
+	runID    string
+	stateDir string
+}
+
+func newFlagSet(o *options, w io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("gomodanalysis", flag.ContinueOnError)
+	fs.SetOutput(w)
+	fs.StringVar(&o.config, "config", o.config, "path to the JSON config file, or GOMODANALYSIS_CONFIG env variable")
+	fs.Var(o.flags, "set", "configuration value KEY=VALUE, can be repeated")
+	fs.Func(
+		"project", "the project ID, sets PROJECT_ID", func(s string) error {
+			o.flags["PROJECT_ID"] = s
+			return nil
+		},
+	)
+	fs.Func(
+		"dataset", "the warehouse dataset, sets DATASET", func(s string) error {
+			o.flags["DATASET"] = s
+			return nil
+		},
+	)
+	fs.StringVar(&o.runID, "run-id", o.runID, "run: the run ID to resume, a new run is started by default")
+	fs.StringVar(&o.stateDir, "state-dir", o.stateDir, "run: the dir to store the stages' records, defaults to .runs")
+	fs.Usage = func() {
+		_, _ = io.WriteString(w, "usage: gomodanalysis [flags] <command> [flags]\n\ncommands:\n")
+		names := make([]string, 0, len(Commands)+1)
+		for k := range Commands {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			_, _ = io.WriteString(w, "  "+k+"\t"+Commands[k].Usage+"\n")
+		}
+		_, _ = io.WriteString(w, "  run\texecutes the stages declared in the config file\n\nflags:\n")
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// Main runs the command given the command line arguments, it returns the exit code.
+// The flags are accepted before and after the command name.
+func Main(args []string, stdout, stderr io.Writer) int {
+	o := options{flags: setFlags{}, config: os.Getenv("GOMODANALYSIS_CONFIG"), stateDir: ".runs"}
+
+	fs := newFlagSet(&o, stderr)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	name := fs.Arg(0)
+	if err := fs.Parse(fs.Args()[1:]); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		_, _ = io.WriteString(stderr, "unexpected arguments: "+strings.Join(fs.Args(), " ")+"\n")
+		return 2
+	}
+
+	file, err := LoadConfigFile(o.config)
+	if err != nil {
+		_, _ = io.WriteString(stderr, err.Error()+"\n")
+		return 1
+	}
+
+	cfg := Config{Flags: o.flags, Getenv: os.Getenv, Default: file.Env}
+
+	// the run budget is shared by all stages of the run, the stages limit their queries by their own budgets
+	guard, err := pipeline.NewCostGuard(cfg.Get("QUERY_MAX_BYTES"), cfg.Get("RUN_MAX_BYTES"))
+	if err != nil {
+		_, _ = io.WriteString(stderr, err.Error()+"\n")
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	ctx = context.WithValue(ctx, costGuardKey{}, guard)
+
+	if name == "run" {
+		dag, err := NewDAG(file.Stages)
+		if err != nil {
+			_, _ = io.WriteString(stderr, err.Error()+"\n")
+			return 1
+		}
+
+		report, err := dag.Run(ctx, cfg, DiskRecords{Dir: o.stateDir}, o.runID)
+		_, _ = io.WriteString(stdout, report.String())
+		if err != nil {
+			_, _ = io.WriteString(stderr, err.Error()+"\n")
+			return 1
+		}
+		return 0
+	}
+
+	c, ok := Commands[name]
+	if !ok {
+		_, _ = io.WriteString(stderr, "unknown command "+name+"\n")
+		fs.Usage()
+		return 2
+	}
+
+	if err := c.Run(ctx, cfg.Get); err != nil {
+		_, _ = io.WriteString(stderr, err.Error()+"\n")
+		return 1
+	}
+	return 0
+}
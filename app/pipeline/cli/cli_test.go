@@ -0,0 +1,169 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConfig_Get(t *testing.T) {
+	cfg := Config{
+		Flags: map[string]string{"A": "flag"},
+		Getenv: func(k string) string {
+			return map[string]string{"A": "env", "B": "env", "C": "env"}[k]
+		},
+		Default: map[string]string{"A": "file", "B": "file", "C": "file", "D": "file"},
+	}.WithStage(map[string]string{"A": "stage", "B": "stage"})
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "A", want: "flag"},
+		{key: "B", want: "stage"},
+		{key: "C", want: "env"},
+		{key: "D", want: "file"},
+		{key: "E", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.key, func(t *testing.T) {
+				if got := cfg.Get(tt.key); got != tt.want {
+					t.Errorf("Get() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(
+		path, []byte(`{"env":{"PROJECT_ID":"p"},"stages":[{"name":"a","command":"index","needs":["b"]}]}`), 0644,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	faulty := filepath.Join(dir, "faulty.json")
+	if err := os.WriteFile(faulty, []byte(`{`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		want    ConfigFile
+		wantErr bool
+	}{
+		{
+			name: "happy path",
+			path: path,
+			want: ConfigFile{
+				Env:    map[string]string{"PROJECT_ID": "p"},
+				Stages: []Stage{{Name: "a", Command: "index", Needs: []string{"b"}}},
+			},
+		},
+		{
+			name: "no file",
+		},
+		{
+			name:    "missing file",
+			path:    filepath.Join(dir, "missing.json"),
+			wantErr: true,
+		},
+		{
+			name:    "faulty file",
+			path:    faulty,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got, err := LoadConfigFile(tt.path)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("LoadConfigFile() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("LoadConfigFile() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestMain_flags(t *testing.T) {
+	var calls []string
+	fakeCommands(t, []string{"test-a"}, map[string]bool{}, &calls)
+
+	tests := []struct {
+		name      string
+		args      []string
+		want      int
+		wantCalls []string
+		wantErr   string
+	}{
+		{
+			name:      "flags after the command",
+			args:      []string{"test-a", "-set", "KEY=v"},
+			wantCalls: []string{"test-a:v"},
+		},
+		{
+			name:      "flags before the command",
+			args:      []string{"-set", "KEY=v", "test-a"},
+			wantCalls: []string{"test-a:v"},
+		},
+		{
+			name:    "unknown command",
+			args:    []string{"foo"},
+			want:    2,
+			wantErr: "unknown command foo",
+		},
+		{
+			name: "no command",
+			want: 2,
+		},
+		{
+			name:    "faulty flag",
+			args:    []string{"test-a", "-set", "KEY"},
+			want:    2,
+			wantErr: "KEY=VALUE expected",
+		},
+		{
+			name:    "faulty query budget",
+			args:    []string{"test-a", "-set", "QUERY_MAX_BYTES=1GB"},
+			want:    1,
+			wantErr: "faulty bytes per query value 1GB",
+		},
+		{
+			name:    "run without stages",
+			args:    []string{"run"},
+			want:    1,
+			wantErr: "no stages declared",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Setenv("GOMODANALYSIS_CONFIG", "")
+				calls = nil
+
+				var stdout, stderr bytes.Buffer
+				if got := Main(tt.args, &stdout, &stderr); got != tt.want {
+					t.Errorf("Main() = %v, want %v, stderr: %s", got, tt.want, stderr.String())
+				}
+				if !reflect.DeepEqual(calls, tt.wantCalls) {
+					t.Errorf("Main() calls = %v, want %v", calls, tt.wantCalls)
+				}
+				if !strings.Contains(stderr.String(), tt.wantErr) {
+					t.Errorf("Main() stderr = %v, want %v", stderr.String(), tt.wantErr)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,315 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kislerdm/gomodanalysis/app/pipeline"
+)
+
+// Stage the stage of the run which executes the command after the stages it needs succeeded.
+type Stage struct {
+	Name    string   `json:"name"`
+	Command string   `json:"command"`
+	Needs   []string `json:"needs,omitempty"`
+
+	// Env the configuration values of the stage, they take precedence over the env variables and the config file's values.
+	Env map[string]string `json:"env,omitempty"`
+}
+
+// DAG the stages in the execution order.
+type DAG struct {
+	stages []Stage
+}
+
+// NewDAG validates the stages and orders them by dependencies, the independent stages keep the declaration order.
+func NewDAG(stages []Stage) (DAG, error) {
+	if len(stages) == 0 {
+		return DAG{}, errors.New("no stages declared")
+	}
+
+	byName := make(map[string]Stage, len(stages))
+	for _, s := range stages {
+		switch {
+		case s.Name == "":
+			return DAG{}, errors.New("stage name must be set")
+		case s.Command == "run":
+			return DAG{}, errors.New("stage " + s.Name + " cannot execute the run command")
+		case s.Env["RUN_MAX_BYTES"] != "":
+			return DAG{}, errors.New("stage " + s.Name + " cannot set RUN_MAX_BYTES, the run budget is shared by all stages")
+		}
+		if _, ok := Commands[s.Command]; !ok {
+			return DAG{}, errors.New("stage " + s.Name + " executes unknown command " + s.Command)
+		}
+		if _, ok := byName[s.Name]; ok {
+			return DAG{}, errors.New("stage " + s.Name + " is declared twice")
+		}
+		byName[s.Name] = s
+	}
+
+	for _, s := range stages {
+		for _, n := range s.Needs {
+			if _, ok := byName[n]; !ok {
+				return DAG{}, errors.New("stage " + s.Name + " needs unknown stage " + n)
+			}
+		}
+	}
+
+	var (
+		o    = make([]Stage, 0, len(stages))
+		done = make(map[string]bool, len(stages))
+	)
+	for len(o) < len(stages) {
+		progressed := false
+		for _, s := range stages {
+			if done[s.Name] {
+				continue
+			}
+
+			ready := true
+			for _, n := range s.Needs {
+				if !done[n] {
+					ready = false
+					break
+				}
+			}
+			if !ready {
+				continue
+			}
+
+			o = append(o, s)
+			done[s.Name] = true
+			progressed = true
+			// the next stage is selected from the beginning to keep the declaration order
+			break
+		}
+
+		if !progressed {
+			var cycle []string
+			for _, s := range stages {
+				if !done[s.Name] {
+					cycle = append(cycle, s.Name)
+				}
+			}
+			return DAG{}, errors.New("stages dependencies form a cycle: " + strings.Join(cycle, ", "))
+		}
+	}
+
+	return DAG{stages: o}, nil
+}
+
+// Stages returns the stages in the execution order.
+func (d DAG) Stages() []Stage {
+	return d.stages
+}
+
+// Statuses of the stage.
+const (
+	StageSucceeded = "succeeded"
+	StageFailed    = "failed"
+	StageSkipped   = "skipped"
+)
+
+// Record the outcome of the stage in the run.
+type Record struct {
+	RunID      string    `json:"run_id"`
+	Stage      string    `json:"stage"`
+	Command    string    `json:"command"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// RecordStore stores the stages' records.
+type RecordStore interface {
+	// Load returns the latest record of every stage of the run.
+	Load(ctx context.Context, runID string) ([]Record, error)
+
+	// Put appends the record.
+	Put(ctx context.Context, r Record) error
+}
+
+// DiskRecords the records stored in the files <run ID>.jsonl in the Dir.
+type DiskRecords struct {
+	Dir string
+}
+
+func (s DiskRecords) path(runID string) string {
+	return filepath.Join(s.Dir, runID+".jsonl")
+}
+
+func (s DiskRecords) Load(_ context.Context, runID string) ([]Record, error) {
+	b, err := os.ReadFile(s.path(runID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var (
+		o     []Record
+		index = map[string]int{}
+	)
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+
+		var r Record
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			return nil, errors.New("faulty record in " + s.path(runID) + ": " + err.Error())
+		}
+
+		if i, ok := index[r.Stage]; ok {
+			o[i] = r
+			continue
+		}
+		index[r.Stage] = len(o)
+		o = append(o, r)
+	}
+	return o, sc.Err()
+}
+
+func (s DiskRecords) Put(_ context.Context, r Record) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(s.path(r.RunID), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// RunReport the outcome of the run.
+type RunReport struct {
+	RunID   string
+	Records []Record
+}
+
+func (r RunReport) String() string {
+	var b strings.Builder
+	b.WriteString("run " + r.RunID + "\n")
+	for _, rec := range r.Records {
+		b.WriteString("  " + rec.Stage + ": " + rec.Status)
+		if rec.Status != StageSkipped {
+			b.WriteString(" after " + rec.FinishedAt.Sub(rec.StartedAt).Round(time.Millisecond).String())
+		}
+		if rec.Error != "" {
+			b.WriteString(": " + rec.Error)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// runStage runs the stage's command with the cost guard limiting the stage's queries by its QUERY_MAX_BYTES.
+func runStage(ctx context.Context, s Stage, cfg Config) error {
+	if guard, _ := ctx.Value(costGuardKey{}).(*pipeline.CostGuard); guard != nil {
+		g, err := guard.WithMaxBytesPerQuery(cfg.Get("QUERY_MAX_BYTES"))
+		if err != nil {
+			return err
+		}
+		ctx = context.WithValue(ctx, costGuardKey{}, g)
+	}
+	return Commands[s.Command].Run(ctx, cfg.Get)
+}
+
+// Run executes the stages in order and records their outcome. The stages which succeeded in the run with the ID
+// runID before are not executed again, the new run is started if runID is empty. The stages which need the failed,
+// or skipped stages are skipped. It returns the error if any stage failed, or was skipped.
+func (d DAG) Run(ctx context.Context, cfg Config, store RecordStore, runID string) (RunReport, error) {
+	if runID == "" {
+		runID = time.Now().UTC().Format("20060102T150405Z")
+	}
+	report := RunReport{RunID: runID}
+
+	prev, err := store.Load(ctx, runID)
+	if err != nil {
+		return report, err
+	}
+
+	succeeded := map[string]bool{}
+	for _, r := range prev {
+		if r.Status == StageSucceeded {
+			succeeded[r.Stage] = true
+		}
+	}
+
+	var failed []string
+	for _, s := range d.stages {
+		if succeeded[s.Name] {
+			for _, r := range prev {
+				if r.Stage == s.Name {
+					report.Records = append(report.Records, r)
+				}
+			}
+			continue
+		}
+
+		r := Record{RunID: runID, Stage: s.Name, Command: s.Command, StartedAt: time.Now().UTC()}
+
+		var blocked []string
+		for _, n := range s.Needs {
+			if !succeeded[n] {
+				blocked = append(blocked, n)
+			}
+		}
+
+		switch {
+		case len(blocked) > 0:
+			r.Status = StageSkipped
+			r.Error = "needs " + strings.Join(blocked, ", ")
+		case ctx.Err() != nil:
+			r.Status = StageSkipped
+			r.Error = ctx.Err().Error()
+		default:
+			if err := runStage(ctx, s, cfg.WithStage(s.Env)); err != nil {
+				r.Status = StageFailed
+				r.Error = err.Error()
+			} else {
+				r.Status = StageSucceeded
+				succeeded[s.Name] = true
+			}
+		}
+		r.FinishedAt = time.Now().UTC()
+
+		if r.Status != StageSucceeded {
+			failed = append(failed, s.Name)
+		}
+
+		report.Records = append(report.Records, r)
+		if err := store.Put(ctx, r); err != nil {
+			return report, errors.New("error storing the record of stage " + s.Name + ": " + err.Error())
+		}
+	}
+
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return report, errors.New(
+			"run " + runID + " is incomplete, stages failed, or skipped: " + strings.Join(failed, ", "),
+		)
+	}
+	return report, nil
+}
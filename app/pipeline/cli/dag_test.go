@@ -0,0 +1,293 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kislerdm/gomodanalysis/app/pipeline"
+)
+
+// fakeCommands registers the commands for the test, the command fails when it is listed in fail.
+func fakeCommands(t *testing.T, names []string, fail map[string]bool, calls *[]string) {
+	t.Helper()
+	for _, name := range names {
+		name := name
+		if _, ok := Commands[name]; ok {
+			t.Fatalf("command %s is registered already", name)
+		}
+		register(
+			Command{
+				Name: name,
+				Run: func(_ context.Context, getenv func(string) string) error {
+					*calls = append(*calls, name+":"+getenv("KEY"))
+					if fail[name] {
+						return errors.New("failed")
+					}
+					return nil
+				},
+			},
+		)
+	}
+	t.Cleanup(
+		func() {
+			for _, name := range names {
+				delete(Commands, name)
+			}
+		},
+	)
+}
+
+func stageNames(stages []Stage) []string {
+	o := make([]string, len(stages))
+	for i, s := range stages {
+		o[i] = s.Name
+	}
+	return o
+}
+
+func TestNewDAG(t *testing.T) {
+	var calls []string
+	fakeCommands(t, []string{"test-a", "test-b"}, nil, &calls)
+
+	tests := []struct {
+		name    string
+		stages  []Stage
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "declaration order",
+			stages: []Stage{
+				{Name: "a", Command: "test-a"},
+				{Name: "b", Command: "test-b"},
+			},
+			want: []string{"a", "b"},
+		},
+		{
+			name: "dependencies first",
+			stages: []Stage{
+				{Name: "c", Command: "test-a", Needs: []string{"b"}},
+				{Name: "b", Command: "test-b", Needs: []string{"a"}},
+				{Name: "d", Command: "test-a"},
+				{Name: "a", Command: "test-a"},
+			},
+			want: []string{"d", "a", "b", "c"},
+		},
+		{
+			name:    "no stages",
+			wantErr: true,
+		},
+		{
+			name: "cycle",
+			stages: []Stage{
+				{Name: "a", Command: "test-a", Needs: []string{"b"}},
+				{Name: "b", Command: "test-b", Needs: []string{"a"}},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "unknown command",
+			stages:  []Stage{{Name: "a", Command: "foo"}},
+			wantErr: true,
+		},
+		{
+			name:    "run command",
+			stages:  []Stage{{Name: "a", Command: "run"}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown need",
+			stages:  []Stage{{Name: "a", Command: "test-a", Needs: []string{"b"}}},
+			wantErr: true,
+		},
+		{
+			name:    "stage run budget",
+			stages:  []Stage{{Name: "a", Command: "test-a", Env: map[string]string{"RUN_MAX_BYTES": "100"}}},
+			wantErr: true,
+		},
+		{
+			name: "duplicate stage",
+			stages: []Stage{
+				{Name: "a", Command: "test-a"},
+				{Name: "a", Command: "test-b"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got, err := NewDAG(tt.stages)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("NewDAG() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if err != nil {
+					return
+				}
+				if names := stageNames(got.Stages()); !reflect.DeepEqual(names, tt.want) {
+					t.Errorf("NewDAG() got = %v, want %v", names, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestDAG_Run(t *testing.T) {
+	stages := []Stage{
+		{Name: "a", Command: "test-a", Env: map[string]string{"KEY": "stage"}},
+		{Name: "b", Command: "test-b", Needs: []string{"a"}},
+		{Name: "c", Command: "test-c", Needs: []string{"b"}},
+		{Name: "d", Command: "test-a"},
+	}
+
+	tests := []struct {
+		name       string
+		fail       map[string]bool
+		prev       []Record
+		wantCalls  []string
+		wantStatus map[string]string
+		wantErr    bool
+	}{
+		{
+			name:      "all succeeded",
+			wantCalls: []string{"test-a:stage", "test-b:file", "test-c:file", "test-a:file"},
+			wantStatus: map[string]string{
+				"a": StageSucceeded, "b": StageSucceeded, "c": StageSucceeded, "d": StageSucceeded,
+			},
+		},
+		{
+			name:      "dependants of the failed stage are skipped",
+			fail:      map[string]bool{"test-b": true},
+			wantCalls: []string{"test-a:stage", "test-b:file", "test-a:file"},
+			wantStatus: map[string]string{
+				"a": StageSucceeded, "b": StageFailed, "c": StageSkipped, "d": StageSucceeded,
+			},
+			wantErr: true,
+		},
+		{
+			name: "resumed run",
+			prev: []Record{
+				{RunID: "r", Stage: "a", Status: StageSucceeded},
+				{RunID: "r", Stage: "b", Status: StageFailed},
+				{RunID: "r", Stage: "c", Status: StageSkipped},
+				{RunID: "r", Stage: "d", Status: StageSucceeded},
+			},
+			wantCalls: []string{"test-b:file", "test-c:file"},
+			wantStatus: map[string]string{
+				"a": StageSucceeded, "b": StageSucceeded, "c": StageSucceeded, "d": StageSucceeded,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				var calls []string
+				fakeCommands(t, []string{"test-a", "test-b", "test-c"}, tt.fail, &calls)
+
+				dag, err := NewDAG(stages)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				store := DiskRecords{Dir: t.TempDir()}
+				for _, r := range tt.prev {
+					if err := store.Put(context.Background(), r); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				cfg := Config{Default: map[string]string{"KEY": "file"}}
+				report, err := dag.Run(context.Background(), cfg, store, "r")
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+				}
+
+				if !reflect.DeepEqual(calls, tt.wantCalls) {
+					t.Errorf("Run() calls = %v, want %v", calls, tt.wantCalls)
+				}
+
+				status := map[string]string{}
+				for _, r := range report.Records {
+					status[r.Stage] = r.Status
+				}
+				if !reflect.DeepEqual(status, tt.wantStatus) {
+					t.Errorf("Run() report = %v, want %v", status, tt.wantStatus)
+				}
+
+				stored, err := store.Load(context.Background(), "r")
+				if err != nil {
+					t.Fatal(err)
+				}
+				status = map[string]string{}
+				for _, r := range stored {
+					status[r.Stage] = r.Status
+				}
+				if !reflect.DeepEqual(status, tt.wantStatus) {
+					t.Errorf("Run() stored = %v, want %v", status, tt.wantStatus)
+				}
+			},
+		)
+	}
+}
+
+func TestDAG_Run_costGuard(t *testing.T) {
+	budgets := map[string]int64{}
+	for _, name := range []string{"test-a", "test-b"} {
+		name := name
+		register(
+			Command{
+				Name: name,
+				Run: func(ctx context.Context, _ func(string) string) error {
+					guard := ctx.Value(costGuardKey{}).(*pipeline.CostGuard)
+					budgets[name] = guard.MaxBytesPerQuery
+					if err := guard.Admit("SELECT 1", 60); err != nil {
+						return err
+					}
+					guard.Done("SELECT 1", 60, 60)
+					return nil
+				},
+			},
+		)
+	}
+	t.Cleanup(
+		func() {
+			delete(Commands, "test-a")
+			delete(Commands, "test-b")
+		},
+	)
+
+	dag, err := NewDAG(
+		[]Stage{
+			{Name: "a", Command: "test-a", Env: map[string]string{"QUERY_MAX_BYTES": "1000"}},
+			{Name: "b", Command: "test-b"},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run := &pipeline.CostGuard{MaxBytesPerQuery: 100, MaxBytesPerRun: 100, Logf: func(string, ...interface{}) {}}
+	ctx := context.WithValue(context.Background(), costGuardKey{}, run)
+	cfg := Config{Default: map[string]string{"QUERY_MAX_BYTES": "100"}}
+
+	report, err := dag.Run(ctx, cfg, DiskRecords{Dir: t.TempDir()}, "r")
+	if err == nil {
+		t.Fatalf("Run() error expected, the stages exceed the run budget together")
+	}
+
+	wantBudgets := map[string]int64{"test-a": 1000, "test-b": 100}
+	if !reflect.DeepEqual(budgets, wantBudgets) {
+		t.Errorf("Run() stages query budgets = %v, want %v", budgets, wantBudgets)
+	}
+
+	if got := report.Records[1]; got.Status != StageFailed || !strings.Contains(got.Error, "run budget") {
+		t.Errorf("Run() stage b = %v, want it failed over the run budget", got)
+	}
+
+	if got := run.Processed(); got != 60 {
+		t.Errorf("Processed() = %v, want the bytes of the stages accounted to the run", got)
+	}
+}
@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kislerdm/gomodanalysis/app/pipeline"
+	"github.com/kislerdm/gomodanalysis/app/pipeline/dataextraction"
+)
+
+func init() {
+	register(
+		Command{
+			Name:  "deadletter",
+			Usage: "retries the modules which failed to be extracted",
+			Run:   runDeadLetter,
+		},
+	)
+}
+
+func runDeadLetter(ctx context.Context, getenv func(string) string) error {
+	wh, err := pipeline.NewWarehouse(getenv)
+	if err != nil {
+		return err
+	}
+
+	client, err := newGBQClient(ctx, wh.ProjectID)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = client.Close() }()
+
+	store := dataextraction.GBQDeadLetters{Client: client, Table: wh.Table(pipeline.TablePkgGoDevDeadLetters)}
+
+	policy, err := dataextraction.NewDeadLetterPolicy(getenv("DEADLETTER_BASE_DELAY"), getenv("DEADLETTER_MAX_ATTEMPTS"))
+	if err != nil {
+		return err
+	}
+
+	lim := 1000
+	if v, err := strconv.Atoi(getenv("LIMIT")); err == nil {
+		lim = v
+	}
+
+	c := dataextraction.NewGoPackagesClient(&http.Client{Timeout: 60 * time.Second}, 30)
+
+	rateLimit := 10.
+	if v, err := strconv.ParseFloat(getenv("RATE_LIMIT"), 64); err == nil {
+		rateLimit = v
+	}
+	c.RateLimiter = pipeline.NewRateLimiter(rateLimit, 1, 5*time.Minute)
+
+	if c.Rules, err = dataextraction.LoadRulesFile(getenv("RULES_FILE")); err != nil {
+		return err
+	}
+
+	report, err := dataextraction.RetryDeadLetters(
+		ctx, store, c, policy, lim, func(d dataextraction.PkgData) error {
+			// the write is not bound to the shutdown to avoid interrupting it midway
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			data, err := pipeline.NewProtoData(d.Message())
+			if err != nil {
+				return err
+			}
+			return client.Write(ctx, data, wh.Table(pipeline.TablePkgGoDev).Path())
+		},
+	)
+	log.Printf(
+		"%d modules retried: %d dead letters resolved, %d pending, %d given up",
+		report.Modules, report.Resolved, report.Pending, report.GivenUp,
+	)
+	if err != nil {
+		return err
+	}
+
+	log.Println("done")
+	return nil
+}
@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"context"
+	"log"
+
+	"github.com/kislerdm/gomodanalysis/app/pipeline"
+	"github.com/kislerdm/gomodanalysis/app/pipeline/enrich"
+)
+
+func init() {
+	register(
+		Command{
+			Name:  "enrich",
+			Usage: "enriches the extracted modules with the attributes of their repositories",
+			Run:   runEnrich,
+		},
+	)
+}
+
+func runEnrich(ctx context.Context, getenv func(string) string) error {
+	wh, err := pipeline.NewWarehouse(getenv)
+	if err != nil {
+		return err
+	}
+
+	client, err := newGBQClient(ctx, wh.ProjectID)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = client.Close() }()
+
+	if err := enrich.Enrich(ctx, client, wh); err != nil {
+		return err
+	}
+
+	log.Println("done")
+	return nil
+}
@@ -0,0 +1,475 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/kislerdm/gomodanalysis/app/pipeline"
+	"github.com/kislerdm/gomodanalysis/app/pipeline/dataextraction"
+)
+
+type logger struct {
+	wOut io.Writer
+	wErr io.Writer
+}
+
+func (l *logger) Info(msg string) {
+	l.printer("INFO", l.wOut, msg)
+}
+
+func (l *logger) Error(msg string) {
+	l.printer("ERROR", l.wErr, msg)
+}
+
+func (l *logger) Debug(msg string) {
+	l.printer("DEBUG", l.wOut, msg)
+}
+
+func (l *logger) Warning(msg string) {
+	l.printer("WARNING", l.wOut, msg)
+}
+
+func (l *logger) time() string {
+	return "[" + time.Now().UTC().Format(time.RFC3339Nano) + "]"
+}
+
+func (l *logger) printer(prefix string, w io.Writer, msg string) {
+	msg = l.time() + "[" + prefix + "] " + msg
+	if _, err := fmt.Fprintln(w, msg); err != nil {
+		panic(err)
+	}
+}
+
+var extractLog = logger{os.Stdout, os.Stderr}
+
+func init() {
+	register(
+		Command{
+			Name:  "extract",
+			Usage: "extracts the modules' data from pkg.go.dev",
+			Run:   runExtract,
+		},
+	)
+}
+
+func runExtract(ctx context.Context, getenv func(string) string) error {
+	wh, err := pipeline.NewWarehouse(getenv)
+	if err != nil {
+		return err
+	}
+
+	client, err := newGBQClient(ctx, wh.ProjectID)
+	if err != nil {
+		return errors.New("cannot init gbq client: " + err.Error())
+	}
+	defer func() { _ = client.Close() }()
+
+	extractLog.Info("start")
+
+	t0 := time.Now()
+
+	mode, err := dataextraction.NewFetchMode(getenv("FETCH_MODE"))
+	if err != nil {
+		return err
+	}
+
+	refresh, err := dataextraction.NewRefreshPolicy(
+		getenv("REFRESH_NEW_VERSION"), getenv("REFRESH_MAX_AGE"), getenv("REFRESH_STALE_SHARE"),
+	)
+	if err != nil {
+		return err
+	}
+
+	priority, err := dataextraction.NewPriorityConfig(
+		getenv("PRIORITY_WEIGHTS"), getenv("PRIORITY_WATCHLIST"), getenv("PRIORITY_POOL_SIZE"),
+	)
+	if err != nil {
+		return err
+	}
+
+	var limit int
+	if v := getenv("LIMIT"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil {
+			return errors.New("faulty LIMIT value " + v)
+		}
+	}
+
+	listModules, err := dataextraction.ListModulesToFetch(
+		ctx, client, dataextraction.ListConfig{
+			Mode:      mode,
+			Refresh:   refresh,
+			Priority:  priority,
+			Warehouse: wh,
+			Limit:     limit,
+		},
+	)
+	if err != nil {
+		return errors.New("error fetching list of modules: " + err.Error())
+	}
+	extractLog.Info(
+		strconv.Itoa(len(listModules)) + " modules found. elapsed: " + strconv.FormatInt(
+			time.Since(t0).Milliseconds(), 10,
+		) + " ms.",
+	)
+
+	if len(listModules) == 0 {
+		extractLog.Info("done.")
+		return nil
+	}
+
+	cntWorkers := 20
+	if c, err := strconv.Atoi(getenv("WORKERS")); err == nil {
+		cntWorkers = c
+	}
+
+	goPkgClient := dataextraction.NewGoPackagesClient(
+		&http.Client{
+			Transport: &http.Transport{
+				TLSHandshakeTimeout: 30 * time.Second,
+				DisableKeepAlives:   false,
+				DisableCompression:  false,
+			},
+			Timeout: 60 * time.Second,
+		},
+		30,
+	)
+
+	rateLimit := 10.
+	if v, err := strconv.ParseFloat(getenv("RATE_LIMIT"), 64); err == nil {
+		rateLimit = v
+	}
+	goPkgClient.RateLimiter = pipeline.NewRateLimiter(rateLimit, cntWorkers, 5*time.Minute)
+
+	rules, err := dataextraction.LoadRulesFile(getenv("RULES_FILE"))
+	if err != nil {
+		return err
+	}
+	goPkgClient.Rules = rules
+
+	// the rows of all workers are appended in batches through the shared streams
+	batchCfg := pipeline.BatchWriterConfig{}
+	if v, err := strconv.Atoi(getenv("WRITE_BATCH_ROWS")); err == nil {
+		batchCfg.MaxRows = v
+	}
+	if v, err := strconv.Atoi(getenv("WRITE_BATCH_BYTES")); err == nil {
+		batchCfg.MaxBytes = v
+	}
+	if v, err := time.ParseDuration(getenv("WRITE_BATCH_INTERVAL")); err == nil {
+		batchCfg.Interval = v
+	}
+	if v, err := strconv.Atoi(getenv("WRITE_STREAMS")); err == nil {
+		batchCfg.Streams = v
+	}
+	batchWriter := pipeline.NewBatchWriter(client, batchCfg)
+	writer := pipeline.NewBatchedClient(client, batchWriter)
+
+	archiveInWarehouse, _ := strconv.ParseBool(getenv("ARCHIVE_WAREHOUSE"))
+	archive := dataextraction.NewArchive(
+		client, getenv("ARCHIVE_DIR"), wh.Table(pipeline.TablePkgGoDevPages), archiveInWarehouse,
+	)
+	if archive != nil {
+		goPkgClient.Archive = archive
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		t := time.NewTicker(30 * time.Second)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				extractLog.Info("throughput: " + strconv.FormatFloat(goPkgClient.RateLimiter.Rate(), 'f', 2, 64) + " req/s.")
+			}
+		}
+	}()
+
+	moduleTimeout := 5 * time.Minute
+	if v, err := time.ParseDuration(getenv("MODULE_TIMEOUT")); err == nil {
+		moduleTimeout = v
+	}
+
+	gracePeriod := 30 * time.Second
+	if v, err := time.ParseDuration(getenv("GRACE_PERIOD")); err == nil {
+		gracePeriod = v
+	}
+
+	var deadLetters dataextraction.DeadLetterStore
+	if v, _ := strconv.ParseBool(getenv("DEADLETTER_ENABLED")); v {
+		deadLetters = dataextraction.GBQDeadLetters{
+			Client: writer, Table: wh.Table(pipeline.TablePkgGoDevDeadLetters),
+		}
+	}
+
+	deadLetterPolicy, err := dataextraction.NewDeadLetterPolicy(
+		getenv("DEADLETTER_BASE_DELAY"), getenv("DEADLETTER_MAX_ATTEMPTS"),
+	)
+	if err != nil {
+		return err
+	}
+
+	sectionRetries := 1
+	if v, err := strconv.Atoi(getenv("SECTION_RETRIES")); err == nil {
+		sectionRetries = v
+	}
+
+	if canary := getenv("CANARY_MODULE"); canary != "none" {
+		if canary == "" {
+			canary = dataextraction.CanaryModule
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, moduleTimeout)
+		err := dataextraction.RunCanary(ctx, goPkgClient, canary)
+		cancel()
+		if err != nil {
+			return err
+		}
+		extractLog.Info("canary " + canary + " passed")
+	}
+
+	driftThresholds, err := dataextraction.ParseDriftThresholds(getenv("DRIFT_THRESHOLDS"))
+	if err != nil {
+		return err
+	}
+
+	driftMinSamples := 50
+	if v, err := strconv.Atoi(getenv("DRIFT_MIN_SAMPLES")); err == nil {
+		driftMinSamples = v
+	}
+
+	// the run is aborted upon the drift if DRIFT_ACTION=fail, otherwise the drift is alerted in the logs
+	driftFail := getenv("DRIFT_ACTION") == "fail"
+	fieldStats := dataextraction.NewFieldStats()
+
+	var (
+		driftOnce sync.Once
+		driftErr  error
+	)
+
+	// ctxSignal is done upon SIGINT, or SIGTERM to stop dispatching new modules
+	ctxSignal, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// ctxDispatch is done upon the signal, or the parser drift
+	ctxDispatch, stopDispatch := context.WithCancel(ctxSignal)
+	defer stopDispatch()
+
+	// ctxWork is cancelled when the grace period after the signal is over to abort the fetches in flight
+	ctxWork, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
+
+	drained := make(chan struct{})
+	go func() {
+		select {
+		case <-drained:
+			return
+		case <-ctxSignal.Done():
+		}
+
+		extractLog.Warning("shutdown signal received, draining workers within " + gracePeriod.String())
+
+		t := time.NewTimer(gracePeriod)
+		defer t.Stop()
+
+		select {
+		case <-drained:
+		case <-t.C:
+			extractLog.Warning("grace period is over, aborting fetches in flight")
+			cancelWork()
+		}
+	}()
+
+	var (
+		wg            sync.WaitGroup
+		mu            sync.Mutex
+		unfinished    []string
+		notDispatched []dataextraction.Module
+	)
+
+	pool := make(chan struct{}, cntWorkers)
+
+dispatch:
+	for i, m := range listModules {
+		if ctxDispatch.Err() != nil {
+			notDispatched = listModules[i:]
+			break
+		}
+
+		select {
+		case <-ctxDispatch.Done():
+			notDispatched = listModules[i:]
+			break dispatch
+		case pool <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(m dataextraction.Module, wg *sync.WaitGroup, writerClient pipeline.GBQClient) {
+			defer func() { wg.Done(); <-pool }()
+
+			extractLog.Info("[pkg:" + m.String() + "] fetch start")
+			t0 := time.Now()
+
+			ctx, cancel := context.WithTimeout(ctxWork, moduleTimeout)
+			defer cancel()
+
+			o, err := dataextraction.ExtractGoPkgData(ctx, m.Name, m.Version, goPkgClient)
+			for i := 0; err != nil && i < sectionRetries && o.Status().IsTransient() && ctx.Err() == nil; i++ {
+				extractLog.Warning("[pkg:" + m.String() + "] retry failed sections, fetch error: " + err.Error())
+				o, err = dataextraction.RetryFailedSections(ctx, o, goPkgClient)
+			}
+
+			extractLog.Info(
+				"[pkg:" + m.String() + "] fetch ended after " + strconv.FormatInt(
+					time.Since(t0).Milliseconds(), 10,
+				) + " ms.",
+			)
+
+			if ctxWork.Err() != nil {
+				mu.Lock()
+				unfinished = append(unfinished, m.String())
+				mu.Unlock()
+				return
+			}
+
+			if err != nil && deadLetters != nil {
+				if letters := deadLetterPolicy.DeadLetters(o, err, nil, time.Now()); len(letters) > 0 {
+					ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+					if err := deadLetters.Put(ctx, letters); err != nil {
+						extractLog.Error("[pkg:" + m.String() + "] dead letters store error: " + err.Error())
+					}
+					cancel()
+				}
+			}
+
+			srore := func(m dataextraction.Module, o dataextraction.PkgData) error {
+				// the write is not bound to the shutdown to avoid interrupting it midway
+				ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+				defer cancel()
+
+				extractLog.Info("[pkg:" + m.String() + "] store start")
+				t0 = time.Now()
+
+				data, err := pipeline.NewProtoData(o.Message())
+				if err != nil {
+					return err
+				}
+
+				if err := writerClient.Write(ctx, data, wh.Table(pipeline.TablePkgGoDev).Path()); err != nil {
+					return err
+				}
+
+				extractLog.Info(
+					"[pkg:" + m.String() + "] store ended after " + strconv.FormatInt(
+						time.Since(t0).Milliseconds(), 10,
+					) + " ms.",
+				)
+
+				return nil
+			}
+
+			var errExtract dataextraction.ErrExtractGoPkgData
+
+			switch {
+			case err == nil:
+				fieldStats.Observe(o)
+				if err := fieldStats.Check(driftThresholds, driftMinSamples); err != nil {
+					driftOnce.Do(
+						func() {
+							driftErr = err
+							if driftFail {
+								extractLog.Error(err.Error() + ", stop dispatching")
+								stopDispatch()
+								return
+							}
+							extractLog.Error(err.Error())
+						},
+					)
+					if driftFail {
+						return
+					}
+				}
+
+				if err := srore(m, o); err != nil {
+					extractLog.Error("[pkg:" + m.String() + "] gbq store error: " + err.Error())
+					break
+				}
+
+			case errors.As(err, &errExtract):
+				// the extracted sections are stored along with the status of the failed ones,
+				// the module is left to the next run if no section was extracted because of the transient errors
+				if !o.Status().IsStorable() {
+					extractLog.Error("[pkg:" + m.String() + "] fetch error: " + err.Error())
+					return
+				}
+
+				extractLog.Warning("[pkg:" + m.String() + "] partial fetch error: " + err.Error())
+				if err := srore(m, o); err != nil {
+					extractLog.Error("[pkg:" + m.String() + "] gbq store error: " + err.Error())
+					break
+				}
+
+			default:
+				extractLog.Error("[pkg:" + m.String() + "] fetch error:\n" + err.Error())
+			}
+
+		}(m, &wg, writer)
+	}
+	wg.Wait()
+	close(drained)
+
+	if err := batchWriter.Close(); err != nil {
+		extractLog.Error("gbq writer close error: " + err.Error())
+	}
+
+	if len(notDispatched) > 0 {
+		names := make([]string, len(notDispatched))
+		for i, m := range notDispatched {
+			names[i] = m.String()
+		}
+		extractLog.Warning(
+			strconv.Itoa(len(notDispatched)) + " modules were not dispatched: " + strings.Join(names, ", "),
+		)
+	}
+
+	if len(unfinished) > 0 {
+		extractLog.Warning(
+			strconv.Itoa(len(unfinished)) + " modules were left unfinished: " + strings.Join(unfinished, ", "),
+		)
+	}
+
+	rates := fieldStats.Rates()
+	fields := make([]string, 0, len(rates))
+	for k, v := range rates {
+		fields = append(fields, k+"="+strconv.FormatFloat(v, 'f', 3, 64))
+	}
+	sort.Strings(fields)
+	extractLog.Info("fields population rates: " + strings.Join(fields, ", "))
+
+	if driftErr != nil && driftFail {
+		return driftErr
+	}
+
+	// the run records the stage as failed, so the resumed run extracts the modules again
+	if len(notDispatched) > 0 || len(unfinished) > 0 {
+		return errors.New(
+			"interrupted: " + strconv.Itoa(len(notDispatched)) + " modules not dispatched, " +
+				strconv.Itoa(len(unfinished)) + " unfinished",
+		)
+	}
+
+	extractLog.Info("done.")
+	return nil
+}
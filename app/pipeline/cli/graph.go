@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"context"
+	"log"
+
+	"github.com/kislerdm/gomodanalysis/app/pipeline"
+	"github.com/kislerdm/gomodanalysis/app/pipeline/graph"
+)
+
+func init() {
+	register(
+		Command{
+			Name:  "graph",
+			Usage: "builds the dependency graph of the extracted modules",
+			Run:   runGraph,
+		},
+	)
+}
+
+func runGraph(ctx context.Context, getenv func(string) string) error {
+	wh, err := pipeline.NewWarehouse(getenv)
+	if err != nil {
+		return err
+	}
+
+	client, err := newGBQClient(ctx, wh.ProjectID)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = client.Close() }()
+
+	if err := graph.Build(ctx, client, wh); err != nil {
+		return err
+	}
+
+	log.Println("done")
+	return nil
+}
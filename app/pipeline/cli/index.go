@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"context"
+	"log"
+
+	app "github.com/kislerdm/gomodanalysis/app/pipeline"
+	"github.com/kislerdm/gomodanalysis/app/pipeline/indexmodules"
+)
+
+func init() {
+	register(Command{Name: "index", Usage: "ingests the modules from index.golang.org", Run: runIndex})
+}
+
+func runIndex(ctx context.Context, getenv func(string) string) error {
+	wh, err := app.NewWarehouse(getenv)
+	if err != nil {
+		return err
+	}
+	table := wh.Table(app.TableIndex)
+
+	c, err := indexmodules.NewConfigWriter(wh.ProjectID)
+	if err != nil {
+		return err
+	}
+
+	writer, err := indexmodules.NewCommittedWriter(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	clientGBQ, err := newGBQClient(ctx, wh.ProjectID)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = clientGBQ.Close() }()
+
+	// the cursor is derived from the committed rows, so the restarted ingestion resumes after the last stored page
+	cursor, err := indexmodules.ReadCursor(ctx, clientGBQ, table)
+	if err != nil {
+		return err
+	}
+
+	reader := indexmodules.NewReader()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		resp, err := reader.Fetch(map[string]string{"since": cursor.Since})
+		if err != nil {
+			return err
+		}
+
+		if resp == nil {
+			log.Println("done")
+			return nil
+		}
+
+		d, err := resp.Decode()
+		if err != nil {
+			return err
+		}
+
+		d, err = cursor.Filter(d)
+		if err != nil {
+			return err
+		}
+
+		if len(d) == 0 {
+			log.Println("done")
+			return nil
+		}
+
+		output, err := indexmodules.ConvertToStoreFormat(d)
+		if err != nil {
+			return err
+		}
+
+		if err := writer.Store(ctx, output, table.Path()); err != nil {
+			return err
+		}
+
+		if err := cursor.Advance(d); err != nil {
+			return err
+		}
+	}
+}
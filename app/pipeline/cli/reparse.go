@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/kislerdm/gomodanalysis/app/pipeline"
+	"github.com/kislerdm/gomodanalysis/app/pipeline/dataextraction"
+)
+
+func init() {
+	register(
+		Command{
+			Name:  "reparse",
+			Usage: "reparses the archived pkg.go.dev pages with the current rules",
+			Run:   runReparse,
+		},
+	)
+}
+
+func runReparse(ctx context.Context, getenv func(string) string) error {
+	wh, err := pipeline.NewWarehouse(getenv)
+	if err != nil {
+		return err
+	}
+
+	client, err := newGBQClient(ctx, wh.ProjectID)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = client.Close() }()
+
+	archiveInWarehouse, _ := strconv.ParseBool(getenv("ARCHIVE_WAREHOUSE"))
+	archive := dataextraction.NewArchive(
+		client, getenv("ARCHIVE_DIR"), wh.Table(pipeline.TablePkgGoDevPages), archiveInWarehouse,
+	)
+	if archive == nil {
+		return errors.New("env variable ARCHIVE_DIR, or ARCHIVE_WAREHOUSE must be set")
+	}
+
+	rules, err := dataextraction.LoadRulesFile(getenv("RULES_FILE"))
+	if err != nil {
+		return err
+	}
+
+	cnt, err := dataextraction.Reparse(
+		ctx, archive, rules, func(d dataextraction.PkgData) error {
+			ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			defer cancel()
+			data, err := pipeline.NewProtoData(d.Message())
+			if err != nil {
+				return err
+			}
+			return client.Write(ctx, data, wh.Table(pipeline.TablePkgGoDev).Path())
+		},
+	)
+	log.Printf("%d modules reparsed", cnt)
+	if err != nil {
+		return err
+	}
+
+	log.Println("done")
+	return nil
+}
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kislerdm/gomodanalysis/app/pipeline"
+	"github.com/kislerdm/gomodanalysis/app/pipeline/report"
+)
+
+func init() {
+	register(
+		Command{
+			Name:  "report",
+			Usage: "writes the reports on the modules as CSV",
+			Run:   runReport,
+		},
+	)
+}
+
+func runReport(ctx context.Context, getenv func(string) string) error {
+	names := report.Names()
+	if v := getenv("REPORTS"); v != "" {
+		names = strings.Split(v, ",")
+	}
+
+	reports := make([]report.Report, len(names))
+	for i, name := range names {
+		r, ok := report.Reports[name]
+		if !ok {
+			return errors.New("unknown report " + name)
+		}
+		reports[i] = r
+	}
+
+	wh, err := pipeline.NewWarehouse(getenv)
+	if err != nil {
+		return err
+	}
+
+	client, err := newGBQClient(ctx, wh.ProjectID)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = client.Close() }()
+
+	dir := getenv("OUTPUT_DIR")
+	for _, r := range reports {
+		cnt, err := writeReport(ctx, client, wh, r, dir)
+		if err != nil {
+			return err
+		}
+		log.Println("report " + r.Name + ": " + strconv.Itoa(cnt) + " rows")
+	}
+
+	log.Println("done")
+	return nil
+}
+
+// writeReport writes the report to the file <report>.csv in the dir, or to stdout if the dir is not set.
+func writeReport(
+	ctx context.Context, client pipeline.GBQClient, wh pipeline.Warehouse, r report.Report, dir string,
+) (int, error) {
+	if dir == "" {
+		_, _ = os.Stdout.WriteString("# " + r.Name + "\n")
+		return report.Write(ctx, client, wh, r, os.Stdout)
+	}
+
+	f, err := os.Create(filepath.Join(dir, r.Name+".csv"))
+	if err != nil {
+		return 0, err
+	}
+
+	cnt, err := report.Write(ctx, client, wh, r, f)
+	if errClose := f.Close(); err == nil && errClose != nil {
+		err = errClose
+	}
+	return cnt, err
+}
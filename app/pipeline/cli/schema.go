@@ -0,0 +1,146 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/kislerdm/gomodanalysis/app/pipeline"
+	"github.com/kislerdm/gomodanalysis/app/pipeline/schema"
+)
+
+func init() {
+	register(
+		Command{
+			Name:  "schema",
+			Usage: "generates the warehouse schemas, or checks them against the files, or the warehouse",
+			Run:   runSchema,
+		},
+	)
+}
+
+func runSchema(ctx context.Context, getenv func(string) string) error {
+	names := schema.TableNames()
+	if v := getenv("TABLES"); v != "" {
+		names = strings.Split(v, ",")
+	}
+
+	tables := make([]schema.Table, len(names))
+	for i, name := range names {
+		t, ok := schema.Tables[name]
+		if !ok {
+			return errors.New("unknown table " + name)
+		}
+		tables[i] = t
+	}
+
+	checkDir := getenv("CHECK_DIR")
+	checkWarehouse, _ := strconv.ParseBool(getenv("CHECK_WAREHOUSE"))
+
+	if checkDir != "" || checkWarehouse {
+		return checkSchemas(ctx, getenv, tables, checkDir, checkWarehouse)
+	}
+	return generateSchemas(tables, getenv("FORMAT"), getenv("OUTPUT_DIR"))
+}
+
+// generateSchemas writes the schemas to the files <table>.json in the dir, or to stdout if the dir is not set.
+func generateSchemas(tables []schema.Table, format, dir string) error {
+	for _, t := range tables {
+		s, err := t.Schema()
+		if err != nil {
+			return err
+		}
+
+		var b []byte
+		switch format {
+		case "", "json":
+			b, err = s.JSON()
+		case "tf":
+			b, err = s.Terraform()
+		default:
+			return errors.New("unknown format " + format + ", json or tf expected")
+		}
+		if err != nil {
+			return err
+		}
+
+		if dir == "" {
+			_, _ = os.Stdout.WriteString("# " + t.Name + "\n")
+			_, _ = os.Stdout.Write(b)
+			continue
+		}
+
+		ext := ".json"
+		if format == "tf" {
+			ext = ".tf"
+		}
+		if err := os.WriteFile(filepath.Join(dir, t.Name+ext), b, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSchemas diffs the generated schemas against the files <table>.json in the dir, or the live warehouse tables.
+func checkSchemas(
+	ctx context.Context, getenv func(string) string, tables []schema.Table, dir string, inWarehouse bool,
+) error {
+	var (
+		client *bigquery.Client
+		wh     pipeline.Warehouse
+	)
+	if inWarehouse {
+		var err error
+		if wh, err = pipeline.NewWarehouse(getenv); err != nil {
+			return err
+		}
+
+		client, err = bigquery.NewClient(ctx, wh.ProjectID)
+		if err != nil {
+			return errors.New("bigquery.NewClient: " + err.Error())
+		}
+		defer func() { _ = client.Close() }()
+	}
+
+	ok := true
+	for _, t := range tables {
+		want, err := t.Schema()
+		if err != nil {
+			return err
+		}
+
+		var got schema.Schema
+		if client != nil {
+			ref := wh.Table(t.Name)
+			m, err := client.DatasetInProject(ref.ProjectID, ref.Dataset).Table(ref.Table).Metadata(ctx)
+			if err != nil {
+				return err
+			}
+			got = schema.FromBigQuery(m.Schema)
+		} else {
+			b, err := os.ReadFile(filepath.Join(dir, t.Name+".json"))
+			if err != nil {
+				return err
+			}
+			if got, err = schema.Parse(b); err != nil {
+				return errors.New(t.Name + ": " + err.Error())
+			}
+		}
+
+		for _, d := range schema.Diff(want, got) {
+			ok = false
+			log.Println(t.Name + "." + d)
+		}
+	}
+
+	if !ok {
+		return errors.New("schemas differ")
+	}
+	log.Println("schemas match")
+	return nil
+}
@@ -0,0 +1,167 @@
+package pipeline
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CostGuard refuses the queries estimated to process more bytes than the budgets allow.
+// The estimate is reserved from the run budget until the query is done, so the concurrent queries
+// cannot exceed the budget together. The guard is shared by all clients of the run, the stages of the run
+// use the guards derived with WithMaxBytesPerQuery.
+type CostGuard struct {
+	// MaxBytesPerQuery the max bytes the query is estimated to process, zero value means no limit.
+	MaxBytesPerQuery int64
+
+	// MaxBytesPerRun the max bytes all queries of the run process in total, zero value means no limit.
+	MaxBytesPerRun int64
+
+	// Logf logs the estimated and the processed bytes of every query, defaults to log.Printf.
+	Logf func(format string, v ...interface{})
+
+	// run the guard the bytes are accounted to, nil if the guard accounts the bytes itself
+	run *CostGuard
+
+	mu        sync.Mutex
+	reserved  int64
+	processed int64
+}
+
+// parseBytes parses the budget set as the number of bytes, the empty value means no limit.
+func parseBytes(name, v string) (int64, error) {
+	if v == "" {
+		return 0, nil
+	}
+	o, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || o < 0 {
+		return 0, errors.New("faulty " + name + " value " + v + ", the number of bytes expected")
+	}
+	return o, nil
+}
+
+// NewCostGuard init the guard with the budgets set as the number of bytes, the empty value means no limit.
+func NewCostGuard(maxBytesPerQuery, maxBytesPerRun string) (*CostGuard, error) {
+	perQuery, err := parseBytes("bytes per query", maxBytesPerQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	perRun, err := parseBytes("bytes per run", maxBytesPerRun)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CostGuard{MaxBytesPerQuery: perQuery, MaxBytesPerRun: perRun}, nil
+}
+
+// WithMaxBytesPerQuery returns the guard with the per query budget set as the number of bytes, the empty value
+// means no limit. The returned guard shares the run budget and the accounted bytes with g.
+func (g *CostGuard) WithMaxBytesPerQuery(maxBytesPerQuery string) (*CostGuard, error) {
+	perQuery, err := parseBytes("bytes per query", maxBytesPerQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	run := g.accountant()
+	return &CostGuard{MaxBytesPerQuery: perQuery, MaxBytesPerRun: run.MaxBytesPerRun, Logf: g.Logf, run: run}, nil
+}
+
+// accountant returns the guard which accounts the bytes of the run.
+func (g *CostGuard) accountant() *CostGuard {
+	if g.run != nil {
+		return g.run
+	}
+	return g
+}
+
+// Admit reserves the estimated bytes of the query, it returns the error matching ErrOverBudget
+// if the estimate exceeds the budgets.
+func (g *CostGuard) Admit(query string, estimated int64) error {
+	if g.MaxBytesPerQuery > 0 && estimated > g.MaxBytesPerQuery {
+		g.logf(
+			"query refused: %d bytes estimated, %d bytes allowed per query: %s",
+			estimated, g.MaxBytesPerQuery, shortQuery(query),
+		)
+		return NewError(
+			ErrOverBudget, errors.New(
+				"query is estimated to process "+strconv.FormatInt(estimated, 10)+" bytes, "+
+					strconv.FormatInt(g.MaxBytesPerQuery, 10)+" bytes allowed per query: "+shortQuery(query),
+			),
+		)
+	}
+
+	return g.accountant().reserve(query, estimated)
+}
+
+// reserve reserves the estimated bytes of the query from the run budget.
+func (g *CostGuard) reserve(query string, estimated int64) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.MaxBytesPerRun > 0 && g.processed+g.reserved+estimated > g.MaxBytesPerRun {
+		left := g.MaxBytesPerRun - g.processed - g.reserved
+		if left < 0 {
+			left = 0
+		}
+		g.logf(
+			"query refused: %d bytes estimated, %d bytes left of the run budget: %s",
+			estimated, left, shortQuery(query),
+		)
+		return NewError(
+			ErrOverBudget, errors.New(
+				"query is estimated to process "+strconv.FormatInt(estimated, 10)+" bytes, "+
+					strconv.FormatInt(left, 10)+" bytes left of the run budget of "+
+					strconv.FormatInt(g.MaxBytesPerRun, 10)+" bytes: "+shortQuery(query),
+			),
+		)
+	}
+
+	g.reserved += estimated
+	return nil
+}
+
+// Done releases the reservation of the admitted query and accounts the bytes it processed.
+func (g *CostGuard) Done(query string, estimated, processed int64) {
+	g = g.accountant()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.reserved -= estimated
+	g.processed += processed
+
+	g.logf(
+		"query done: %d bytes estimated, %d bytes processed, %d bytes processed by the run: %s",
+		estimated, processed, g.processed, shortQuery(query),
+	)
+}
+
+// Processed returns the bytes processed by the done queries.
+func (g *CostGuard) Processed() int64 {
+	g = g.accountant()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.processed
+}
+
+func (g *CostGuard) logf(format string, v ...interface{}) {
+	if g.Logf != nil {
+		g.Logf(format, v...)
+		return
+	}
+	log.Printf(format, v...)
+}
+
+// shortQuery returns the query on a single line, cut to 100 characters.
+func shortQuery(query string) string {
+	const maxLen = 100
+	o := strings.Join(strings.Fields(query), " ")
+	if len(o) > maxLen {
+		o = o[:maxLen] + "..."
+	}
+	return o
+}
@@ -0,0 +1,183 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestNewCostGuard(t *testing.T) {
+	tests := []struct {
+		name     string
+		perQuery string
+		perRun   string
+		want     [2]int64
+		wantErr  bool
+	}{
+		{
+			name: "no limits",
+		},
+		{
+			name:     "limits",
+			perQuery: "1000",
+			perRun:   "5000",
+			want:     [2]int64{1000, 5000},
+		},
+		{
+			name:     "faulty per query",
+			perQuery: "1GB",
+			wantErr:  true,
+		},
+		{
+			name:    "negative per run",
+			perRun:  "-1",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got, err := NewCostGuard(tt.perQuery, tt.perRun)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("NewCostGuard() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if err != nil {
+					return
+				}
+				if [2]int64{got.MaxBytesPerQuery, got.MaxBytesPerRun} != tt.want {
+					t.Errorf("NewCostGuard() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestCostGuard_Admit(t *testing.T) {
+	type query struct {
+		estimated, processed int64
+		done                 bool
+	}
+
+	tests := []struct {
+		name     string
+		guard    *CostGuard
+		queries  []query
+		want     []bool
+		wantUsed int64
+	}{
+		{
+			name:     "no limits",
+			guard:    &CostGuard{},
+			queries:  []query{{estimated: 1 << 40, processed: 1 << 40, done: true}},
+			want:     []bool{true},
+			wantUsed: 1 << 40,
+		},
+		{
+			name:  "over the query budget",
+			guard: &CostGuard{MaxBytesPerQuery: 100},
+			queries: []query{
+				{estimated: 100, processed: 90, done: true},
+				{estimated: 101},
+			},
+			want:     []bool{true, false},
+			wantUsed: 90,
+		},
+		{
+			name:  "run budget accounts the processed bytes",
+			guard: &CostGuard{MaxBytesPerRun: 100},
+			queries: []query{
+				{estimated: 60, processed: 40, done: true},
+				{estimated: 60, processed: 60, done: true},
+				{estimated: 1},
+			},
+			want:     []bool{true, true, false},
+			wantUsed: 100,
+		},
+		{
+			name:  "run budget accounts the queries in flight",
+			guard: &CostGuard{MaxBytesPerRun: 100},
+			queries: []query{
+				{estimated: 60},
+				{estimated: 60},
+			},
+			want: []bool{true, false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				var logs []string
+				tt.guard.Logf = func(format string, v ...interface{}) {
+					logs = append(logs, fmt.Sprintf(format, v...))
+				}
+
+				for i, q := range tt.queries {
+					err := tt.guard.Admit("SELECT 1", q.estimated)
+					if (err == nil) != tt.want[i] {
+						t.Fatalf("Admit() query %d error = %v, want admitted %v", i, err, tt.want[i])
+					}
+					if err != nil && !errors.Is(err, ErrOverBudget) {
+						t.Errorf("Admit() error = %v, want ErrOverBudget", err)
+					}
+					if err == nil && q.done {
+						tt.guard.Done("SELECT 1", q.estimated, q.processed)
+					}
+				}
+
+				if got := tt.guard.Processed(); got != tt.wantUsed {
+					t.Errorf("Processed() = %v, want %v", got, tt.wantUsed)
+				}
+				if len(logs) == 0 {
+					t.Error("estimated and processed bytes are expected to be logged")
+				}
+			},
+		)
+	}
+}
+
+func TestCostGuard_WithMaxBytesPerQuery(t *testing.T) {
+	run := &CostGuard{MaxBytesPerQuery: 50, MaxBytesPerRun: 100, Logf: func(string, ...interface{}) {}}
+
+	stage, err := run.WithMaxBytesPerQuery("80")
+	if err != nil {
+		t.Fatalf("WithMaxBytesPerQuery() unexpected error = %v", err)
+	}
+
+	if err := stage.Admit("SELECT 1", 90); !errors.Is(err, ErrOverBudget) {
+		t.Errorf("Admit() error = %v, want the stage's query budget to be exceeded", err)
+	}
+
+	if err := stage.Admit("SELECT 1", 70); err != nil {
+		t.Fatalf("Admit() unexpected error = %v, want the stage's query budget to override the run's", err)
+	}
+	stage.Done("SELECT 1", 70, 70)
+
+	if got := run.Processed(); got != 70 {
+		t.Errorf("run Processed() = %v, want the stage's bytes accounted to the run", got)
+	}
+
+	other, err := run.WithMaxBytesPerQuery("")
+	if err != nil {
+		t.Fatalf("WithMaxBytesPerQuery() unexpected error = %v", err)
+	}
+	if err := other.Admit("SELECT 1", 40); !errors.Is(err, ErrOverBudget) {
+		t.Errorf("Admit() error = %v, want the run budget shared by the stages to be exceeded", err)
+	}
+	if got := other.Processed(); got != 70 {
+		t.Errorf("Processed() = %v, want 70", got)
+	}
+
+	if _, err := run.WithMaxBytesPerQuery("foo"); err == nil {
+		t.Errorf("WithMaxBytesPerQuery() error expected for the faulty value")
+	}
+}
+
+func Test_shortQuery(t *testing.T) {
+	if got := shortQuery("SELECT\n\t1\n  FROM foo"); got != "SELECT 1 FROM foo" {
+		t.Errorf("shortQuery() = %v", got)
+	}
+	if got := shortQuery(strings.Repeat("a", 200)); len(got) != 103 {
+		t.Errorf("shortQuery() len = %v, want 103", len(got))
+	}
+}
@@ -0,0 +1,493 @@
+package dataextraction
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kislerdm/gomodanalysis/app/pipeline"
+)
+
+// ErrPageNotArchived the error returned when the page is missing in the archive.
+var ErrPageNotArchived = errors.New("page is not archived")
+
+// PageRef reference to the archived page, the body is addressed by its SHA256 hash.
+type PageRef struct {
+	URL        string    `json:"url" bigquery:"url"`
+	FetchedAt  time.Time `json:"fetched_at" bigquery:"timestamp"`
+	SHA256     string    `json:"sha256" bigquery:"sha256"`
+	StatusCode int       `json:"status_code" bigquery:"status_code"`
+}
+
+// Archive stores the raw pages fetched from https://pkg.go.dev keyed by URL and fetch time.
+type Archive interface {
+	// Put stores the page body.
+	Put(ctx context.Context, ref PageRef, body []byte) error
+
+	// List lists all archived pages.
+	List(ctx context.Context) ([]PageRef, error)
+
+	// Load reads the body of the archived page.
+	Load(ctx context.Context, ref PageRef) ([]byte, error)
+
+	// LoadAll reads the bodies of the archived pages keyed by the SHA256 hash, the missing pages are omitted.
+	LoadAll(ctx context.Context, refs []PageRef) (map[string][]byte, error)
+
+	// Latest returns the reference to the latest archived page for the URL.
+	Latest(ctx context.Context, url string) (PageRef, error)
+}
+
+// NewPageRef defines the reference to the page body fetched from the URL.
+func NewPageRef(url string, statusCode int, body []byte, fetchedAt time.Time) PageRef {
+	h := sha256.Sum256(body)
+	return PageRef{
+		URL:        url,
+		FetchedAt:  fetchedAt.UTC(),
+		SHA256:     hex.EncodeToString(h[:]),
+		StatusCode: statusCode,
+	}
+}
+
+// DiskArchive content-addressed archive on the local disk:
+//   - {{Dir}}/objects/{{sha256}}: the page body;
+//   - {{Dir}}/refs/{{sha256 of URL}}/{{fetch time as unix nanoseconds}}.json: the page reference.
+type DiskArchive struct {
+	Dir string
+}
+
+func (a DiskArchive) objectPath(hash string) string {
+	return filepath.Join(a.Dir, "objects", hash)
+}
+
+func (a DiskArchive) refsDir(url string) string {
+	h := sha256.Sum256([]byte(url))
+	return filepath.Join(a.Dir, "refs", hex.EncodeToString(h[:]))
+}
+
+func (a DiskArchive) Put(_ context.Context, ref PageRef, body []byte) error {
+	p := a.objectPath(ref.SHA256)
+	if _, err := os.Stat(p); errors.Is(err, fs.ErrNotExist) {
+		if err := writeFileAtomic(p, body); err != nil {
+			return err
+		}
+	}
+
+	b, err := json.Marshal(ref)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(
+		filepath.Join(a.refsDir(ref.URL), strconv.FormatInt(ref.FetchedAt.UnixNano(), 10)+".json"), b,
+	)
+}
+
+func writeFileAtomic(p string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), p)
+}
+
+func (a DiskArchive) List(_ context.Context) ([]PageRef, error) {
+	var o []PageRef
+
+	err := filepath.WalkDir(
+		filepath.Join(a.Dir, "refs"), func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			if d.IsDir() || filepath.Ext(p) != ".json" {
+				return nil
+			}
+
+			b, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+
+			var ref PageRef
+			if err := json.Unmarshal(b, &ref); err != nil {
+				return errors.New("corrupt page reference " + p + ": " + err.Error())
+			}
+			o = append(o, ref)
+
+			return nil
+		},
+	)
+
+	return o, err
+}
+
+func (a DiskArchive) Load(_ context.Context, ref PageRef) ([]byte, error) {
+	b, err := os.ReadFile(a.objectPath(ref.SHA256))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrPageNotArchived
+	}
+	return b, err
+}
+
+func (a DiskArchive) LoadAll(ctx context.Context, refs []PageRef) (map[string][]byte, error) {
+	o := make(map[string][]byte, len(refs))
+	for _, ref := range refs {
+		b, err := a.Load(ctx, ref)
+		if errors.Is(err, ErrPageNotArchived) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		o[ref.SHA256] = b
+	}
+	return o, nil
+}
+
+func (a DiskArchive) Latest(_ context.Context, url string) (PageRef, error) {
+	entries, err := os.ReadDir(a.refsDir(url))
+	if errors.Is(err, fs.ErrNotExist) {
+		return PageRef{}, ErrPageNotArchived
+	}
+	if err != nil {
+		return PageRef{}, err
+	}
+
+	var (
+		latest int64
+		name   string
+	)
+	for _, e := range entries {
+		ts, err := strconv.ParseInt(strings.TrimSuffix(e.Name(), ".json"), 10, 64)
+		if err != nil || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		if name == "" || ts > latest {
+			latest, name = ts, e.Name()
+		}
+	}
+	if name == "" {
+		return PageRef{}, ErrPageNotArchived
+	}
+
+	b, err := os.ReadFile(filepath.Join(a.refsDir(url), name))
+	if err != nil {
+		return PageRef{}, err
+	}
+
+	var ref PageRef
+	err = json.Unmarshal(b, &ref)
+	return ref, err
+}
+
+// GBQArchive archive in the warehouse table defined by the PkgGoDevPage proto message.
+type GBQArchive struct {
+	Client pipeline.GBQClient
+	Table  pipeline.TableRef
+}
+
+// Put stores the page, the body is not inserted again if the URL's page with the same SHA256 hash is stored.
+func (a GBQArchive) Put(ctx context.Context, ref PageRef, body []byte) error {
+	_, err := a.Client.Read(
+		ctx, "MERGE "+a.Table.ID()+" AS t USING (SELECT @url AS url, @timestamp AS timestamp, @sha256 AS sha256, "+
+			"@status_code AS status_code, @body AS body) AS s ON t.sha256 = s.sha256 AND t.url = s.url "+
+			"WHEN NOT MATCHED THEN INSERT (url, timestamp, sha256, status_code, body) "+
+			"VALUES (s.url, s.timestamp, s.sha256, s.status_code, s.body);",
+		pipeline.QueryParam{Name: "url", Value: ref.URL},
+		pipeline.QueryParam{Name: "timestamp", Value: ref.FetchedAt},
+		pipeline.QueryParam{Name: "sha256", Value: ref.SHA256},
+		pipeline.QueryParam{Name: "status_code", Value: ref.StatusCode},
+		pipeline.QueryParam{Name: "body", Value: body},
+	)
+	if err != nil {
+		return errors.New("GBQArchive.Put(): " + err.Error())
+	}
+	return nil
+}
+
+func (a GBQArchive) List(ctx context.Context) ([]PageRef, error) {
+	o, err := pipeline.ReadAll[PageRef](ctx, a.Client, "SELECT url, timestamp, sha256, status_code FROM "+a.Table.ID()+";")
+	if err != nil {
+		return nil, errors.New("GBQArchive.List(): " + err.Error())
+	}
+	return o, nil
+}
+
+func (a GBQArchive) Load(ctx context.Context, ref PageRef) ([]byte, error) {
+	r, err := a.Client.Read(
+		ctx, "SELECT body FROM "+a.Table.ID()+" WHERE sha256 = @sha256 LIMIT 1;",
+		pipeline.QueryParam{Name: "sha256", Value: ref.SHA256},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(r) == 0 {
+		return nil, ErrPageNotArchived
+	}
+
+	b, ok := r[0][0].([]byte)
+	if !ok {
+		return nil, errors.New("GBQArchive.Load(): cannot parse the page body")
+	}
+	return b, nil
+}
+
+func (a GBQArchive) LoadAll(ctx context.Context, refs []PageRef) (map[string][]byte, error) {
+	type page struct {
+		SHA256 string `bigquery:"sha256"`
+		Body   []byte `bigquery:"body"`
+	}
+
+	hashes := make([]string, len(refs))
+	for i, ref := range refs {
+		hashes[i] = ref.SHA256
+	}
+
+	pages, err := pipeline.ReadAll[page](
+		ctx, a.Client, "SELECT sha256, ANY_VALUE(body) AS body FROM "+a.Table.ID()+
+			" WHERE sha256 IN UNNEST(@sha256) GROUP BY sha256;",
+		pipeline.QueryParam{Name: "sha256", Value: hashes},
+	)
+	if err != nil {
+		return nil, errors.New("GBQArchive.LoadAll(): " + err.Error())
+	}
+
+	o := make(map[string][]byte, len(pages))
+	for _, p := range pages {
+		o[p.SHA256] = p.Body
+	}
+	return o, nil
+}
+
+func (a GBQArchive) Latest(ctx context.Context, url string) (PageRef, error) {
+	refs, err := pipeline.ReadAll[PageRef](
+		ctx, a.Client, "SELECT url, timestamp, sha256, status_code FROM "+a.Table.ID()+
+			" WHERE url = @url ORDER BY timestamp DESC LIMIT 1;",
+		pipeline.QueryParam{Name: "url", Value: url},
+	)
+	if err != nil {
+		return PageRef{}, errors.New("GBQArchive.Latest(): " + err.Error())
+	}
+	if len(refs) == 0 {
+		return PageRef{}, ErrPageNotArchived
+	}
+
+	return refs[0], nil
+}
+
+// ReplayHTTPClient serves the requests from the archive, the pages missing in the archive are reported as 404.
+type ReplayHTTPClient struct {
+	Archive Archive
+}
+
+func (c ReplayHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	ref, err := c.Archive.Latest(req.Context(), req.URL.String())
+	if errors.Is(err, ErrPageNotArchived) {
+		return &http.Response{
+			Status:     "404 Not Found",
+			StatusCode: http.StatusNotFound,
+			Body:       io.NopCloser(strings.NewReader("not found")),
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := c.Archive.Load(req.Context(), ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Response{
+		Status:     strconv.Itoa(ref.StatusCode) + " " + http.StatusText(ref.StatusCode),
+		StatusCode: ref.StatusCode,
+		Body:       io.NopCloser(bytes.NewReader(b)),
+	}, nil
+}
+
+const urlGoPackages = "https://pkg.go.dev/"
+
+// reparseBatchSize the number of modules which pages are loaded from the archive at once.
+const reparseBatchSize = 100
+
+// Reparse parses the latest archived pages of every module and passes the results to the function fn.
+// The modules which miss any of the main, imports, or importedby pages in the archive are skipped.
+// The modules which fail to be parsed are skipped and reported in the error once all modules are processed.
+// The metadata is extracted using the rules, DefaultRules are used if rules is nil.
+// The pages are loaded from the archive in batches of reparseBatchSize modules.
+// It returns the number of modules passed to fn.
+func Reparse(ctx context.Context, a Archive, rules *Ruleset, fn func(PkgData) error) (int, error) {
+	refs, err := a.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	type pages struct {
+		main, imports, importedBy *PageRef
+	}
+
+	latest := func(cur *PageRef, ref PageRef) *PageRef {
+		if cur == nil || ref.FetchedAt.After(cur.FetchedAt) {
+			return &ref
+		}
+		return cur
+	}
+
+	modules := map[string]*pages{}
+	for _, ref := range refs {
+		// the error responses are archived too, but only the pages fetched successfully can be parsed
+		if !strings.HasPrefix(ref.URL, urlGoPackages) || ref.StatusCode >= http.StatusMultipleChoices {
+			continue
+		}
+
+		route, tab, _ := strings.Cut(strings.TrimPrefix(ref.URL, urlGoPackages), "?tab=")
+
+		p, ok := modules[route]
+		if !ok {
+			p = &pages{}
+			modules[route] = p
+		}
+
+		switch tab {
+		case "":
+			p.main = latest(p.main, ref)
+		case "imports":
+			p.imports = latest(p.imports, ref)
+		case "importedby":
+			p.importedBy = latest(p.importedBy, ref)
+		}
+	}
+
+	routes := make([]string, 0, len(modules))
+	for k := range modules {
+		routes = append(routes, k)
+	}
+	sort.Strings(routes)
+
+	var bodies map[string][]byte
+	load := func(ref PageRef) (io.ReadCloser, error) {
+		b, ok := bodies[ref.SHA256]
+		if !ok {
+			return nil, ErrPageNotArchived
+		}
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+
+	parse := func(route string, p *pages) (PkgData, error) {
+		name, version, _ := strings.Cut(route, "@")
+		o := PkgData{path: name, version: version, status: statusAllOK}
+
+		r, err := load(*p.main)
+		if err != nil {
+			return PkgData{}, err
+		}
+		if o.meta, err = parseHTMLGoPackageMainWithRules(r, rules); err != nil {
+			return PkgData{}, pipeline.NewError(pipeline.ErrParse, err)
+		}
+
+		if r, err = load(*p.imports); err != nil {
+			return PkgData{}, err
+		}
+		if o.imports, err = parseHTMLGoPackageImports(r); err != nil {
+			return PkgData{}, pipeline.NewError(pipeline.ErrParse, err)
+		}
+
+		if r, err = load(*p.importedBy); err != nil {
+			return PkgData{}, err
+		}
+		if o.importedBy, err = parseHTMLGoPackageImportedBy(r); err != nil {
+			return PkgData{}, pipeline.NewError(pipeline.ErrParse, err)
+		}
+
+		return o, nil
+	}
+
+	complete := routes[:0]
+	for _, route := range routes {
+		if p := modules[route]; p.main != nil && p.imports != nil && p.importedBy != nil {
+			complete = append(complete, route)
+		}
+	}
+
+	var (
+		cnt    int
+		failed []string
+	)
+	for start := 0; start < len(complete); start += reparseBatchSize {
+		end := start + reparseBatchSize
+		if end > len(complete) {
+			end = len(complete)
+		}
+		batch := complete[start:end]
+
+		refs := make([]PageRef, 0, 3*len(batch))
+		for _, route := range batch {
+			p := modules[route]
+			refs = append(refs, *p.main, *p.imports, *p.importedBy)
+		}
+		if bodies, err = a.LoadAll(ctx, refs); err != nil {
+			return cnt, err
+		}
+
+		for _, route := range batch {
+			o, err := parse(route, modules[route])
+			if err != nil {
+				failed = append(failed, "[pkg:"+route+"] "+err.Error())
+				continue
+			}
+
+			if err := fn(o); err != nil {
+				return cnt, err
+			}
+			cnt++
+		}
+	}
+
+	if len(failed) > 0 {
+		return cnt, errors.New("failed to reparse " + strconv.Itoa(len(failed)) + " modules:\n" +
+			strings.Join(failed, "\n"))
+	}
+
+	return cnt, nil
+}
+
+// NewArchive init the archive on the disk if dir is set, or in the warehouse table if inWarehouse.
+// It returns nil if neither is set.
+func NewArchive(client pipeline.GBQClient, dir string, table pipeline.TableRef, inWarehouse bool) Archive {
+	switch {
+	case dir != "":
+		return DiskArchive{Dir: dir}
+	case inWarehouse:
+		return GBQArchive{Client: client, Table: table}
+	default:
+		return nil
+	}
+}
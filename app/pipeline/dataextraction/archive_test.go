@@ -0,0 +1,313 @@
+package dataextraction
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kislerdm/gomodanalysis/app/pipeline"
+)
+
+func TestDiskArchive(t *testing.T) {
+	a := DiskArchive{Dir: t.TempDir()}
+	ctx := context.TODO()
+
+	const url = "https://pkg.go.dev/foo"
+	t0 := time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC)
+
+	if _, err := a.Latest(ctx, url); !errors.Is(err, ErrPageNotArchived) {
+		t.Errorf("Latest() error = %v, want %v", err, ErrPageNotArchived)
+		return
+	}
+
+	pages := []struct {
+		body      string
+		fetchedAt time.Time
+	}{
+		{"old", t0},
+		{"new", t0.Add(time.Hour)},
+		{"old", t0.Add(-time.Hour)},
+	}
+	for _, p := range pages {
+		if err := a.Put(ctx, NewPageRef(url, 200, []byte(p.body), p.fetchedAt), []byte(p.body)); err != nil {
+			t.Errorf("Put() unexpected error = %v", err)
+			return
+		}
+	}
+
+	refs, err := a.List(ctx)
+	if err != nil {
+		t.Errorf("List() unexpected error = %v", err)
+		return
+	}
+	if len(refs) != len(pages) {
+		t.Errorf("List() got %d refs, want %d", len(refs), len(pages))
+	}
+
+	ref, err := a.Latest(ctx, url)
+	if err != nil {
+		t.Errorf("Latest() unexpected error = %v", err)
+		return
+	}
+	if want := NewPageRef(url, 200, []byte("new"), t0.Add(time.Hour)); ref != want {
+		t.Errorf("Latest() got = %v, want %v", ref, want)
+	}
+
+	b, err := a.Load(ctx, ref)
+	if err != nil {
+		t.Errorf("Load() unexpected error = %v", err)
+		return
+	}
+	if string(b) != "new" {
+		t.Errorf("Load() got = %s, want new", b)
+	}
+}
+
+func TestArchive_RecordReplayReparse(t *testing.T) {
+	ctx := context.TODO()
+	a := DiskArchive{Dir: t.TempDir()}
+
+	recorder := NewGoPackagesClient(mockHTTP{}, 1)
+	recorder.Archive = a
+
+	want, err := ExtractGoPkgData(ctx, "bar", "", recorder)
+	if err != nil {
+		t.Errorf("ExtractGoPkgData() unexpected error = %v", err)
+		return
+	}
+
+	// replay
+	got, err := ExtractGoPkgData(ctx, "bar", "", NewGoPackagesClient(ReplayHTTPClient{Archive: a}, 1))
+	if err != nil {
+		t.Errorf("ExtractGoPkgData() unexpected replay error = %v", err)
+		return
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ExtractGoPkgData() replay got = %v, want %v", got, want)
+	}
+
+	// the pages missing in the archive
+	if _, err := ExtractGoPkgData(ctx, "qux", "", NewGoPackagesClient(ReplayHTTPClient{Archive: a}, 1)); err == nil {
+		t.Errorf("ExtractGoPkgData() error expected for the page missing in the archive")
+	}
+
+	// reparse
+	var reparsed []PkgData
+	cnt, err := Reparse(
+		ctx, a, nil, func(d PkgData) error {
+			reparsed = append(reparsed, d)
+			return nil
+		},
+	)
+	if err != nil {
+		t.Errorf("Reparse() unexpected error = %v", err)
+		return
+	}
+	if cnt != 1 {
+		t.Errorf("Reparse() got = %v, want 1", cnt)
+	}
+	if !reflect.DeepEqual(reparsed, []PkgData{want}) {
+		t.Errorf("Reparse() got = %v, want %v", reparsed, []PkgData{want})
+	}
+}
+
+type failingArchive struct {
+	Archive
+}
+
+func (failingArchive) Put(_ context.Context, _ PageRef, _ []byte) error {
+	return errors.New("archive is unavailable")
+}
+
+func TestGoPackagesClient_archive(t *testing.T) {
+	ctx := context.TODO()
+
+	t.Run(
+		"the error responses are archived", func(t *testing.T) {
+			a := DiskArchive{Dir: t.TempDir()}
+			c := NewGoPackagesClient(mockHTTP{}, 1)
+			c.Archive = a
+
+			if _, err := c.GetImports(ctx, "qux"); !errors.Is(err, pipeline.ErrNotFound) {
+				t.Fatalf("GetImports() error = %v, want %v", err, pipeline.ErrNotFound)
+			}
+
+			ref, err := a.Latest(ctx, "https://pkg.go.dev/qux?tab=imports")
+			if err != nil {
+				t.Fatalf("Latest() unexpected error = %v", err)
+			}
+			if ref.StatusCode != http.StatusNotFound {
+				t.Errorf("Latest() status code = %v, want %v", ref.StatusCode, http.StatusNotFound)
+			}
+		},
+	)
+
+	t.Run(
+		"the archive error does not fail the extraction", func(t *testing.T) {
+			c := NewGoPackagesClient(mockHTTP{}, 1)
+			c.Archive = failingArchive{}
+
+			want, err := ExtractGoPkgData(ctx, "bar", "", NewGoPackagesClient(mockHTTP{}, 1))
+			if err != nil {
+				t.Fatalf("ExtractGoPkgData() unexpected error = %v", err)
+			}
+
+			got, err := ExtractGoPkgData(ctx, "bar", "", c)
+			if err != nil {
+				t.Fatalf("ExtractGoPkgData() unexpected error = %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("ExtractGoPkgData() got = %v, want %v", got, want)
+			}
+		},
+	)
+}
+
+func TestGBQArchive_Latest(t *testing.T) {
+	const url = "https://pkg.go.dev/foo"
+	ts := time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC)
+	columns := [][]string{{"url", "timestamp", "sha256", "status_code"}}
+
+	tests := []struct {
+		name    string
+		client  *mockGBQClient
+		want    PageRef
+		wantErr error
+	}{
+		{
+			name: "happy path",
+			client: &mockGBQClient{
+				columns: columns,
+				v:       []pipeline.DataReader{{{url, ts, "bar", int64(http.StatusNotFound)}}},
+			},
+			want: PageRef{URL: url, FetchedAt: ts, SHA256: "bar", StatusCode: http.StatusNotFound},
+		},
+		{
+			name:    "not archived",
+			client:  &mockGBQClient{columns: columns, v: []pipeline.DataReader{{}}},
+			wantErr: ErrPageNotArchived,
+		},
+		{
+			name: "faulty row",
+			client: &mockGBQClient{
+				columns: columns,
+				v:       []pipeline.DataReader{{{url, "2022-11-01", "bar", int64(http.StatusOK)}}},
+			},
+			wantErr: errors.New("GBQArchive.Latest(): row 0: cannot scan column timestamp: " +
+				"cannot assign string to time.Time"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				a := GBQArchive{Client: tt.client, Table: pipeline.TableRef{ProjectID: "p", Dataset: "d", Table: "t"}}
+				got, err := a.Latest(context.TODO(), url)
+				if tt.wantErr != nil {
+					if err == nil || (!errors.Is(err, tt.wantErr) && err.Error() != tt.wantErr.Error()) {
+						t.Fatalf("Latest() error = %v, want %v", err, tt.wantErr)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Latest() unexpected error = %v", err)
+				}
+				if got != tt.want {
+					t.Errorf("Latest() got = %v, want %v", got, tt.want)
+				}
+
+				wantParams := []pipeline.QueryParam{{Name: "url", Value: url}}
+				if !reflect.DeepEqual(tt.client.params[0], wantParams) {
+					t.Errorf("Latest() params = %v, want %v", tt.client.params[0], wantParams)
+				}
+			},
+		)
+	}
+}
+
+func TestGBQArchive_Put(t *testing.T) {
+	ts := time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC)
+	ref := PageRef{URL: "https://pkg.go.dev/foo", FetchedAt: ts, SHA256: "bar", StatusCode: http.StatusOK}
+
+	client := &mockGBQClient{}
+	a := GBQArchive{Client: client, Table: pipeline.TableRef{ProjectID: "p", Dataset: "d", Table: "t"}}
+	if err := a.Put(context.TODO(), ref, []byte("baz")); err != nil {
+		t.Fatalf("Put() unexpected error = %v", err)
+	}
+
+	wantQuery := "MERGE `p.d.t` AS t USING (SELECT @url AS url, @timestamp AS timestamp, @sha256 AS sha256, " +
+		"@status_code AS status_code, @body AS body) AS s ON t.sha256 = s.sha256 AND t.url = s.url " +
+		"WHEN NOT MATCHED THEN INSERT (url, timestamp, sha256, status_code, body) " +
+		"VALUES (s.url, s.timestamp, s.sha256, s.status_code, s.body);"
+	if client.queries[0] != wantQuery {
+		t.Errorf("Put() query = %v, want %v", client.queries[0], wantQuery)
+	}
+
+	wantParams := []pipeline.QueryParam{
+		{Name: "url", Value: ref.URL},
+		{Name: "timestamp", Value: ts},
+		{Name: "sha256", Value: "bar"},
+		{Name: "status_code", Value: http.StatusOK},
+		{Name: "body", Value: []byte("baz")},
+	}
+	if !reflect.DeepEqual(client.params[0], wantParams) {
+		t.Errorf("Put() params = %v, want %v", client.params[0], wantParams)
+	}
+
+	client.err = errors.New("foo")
+	if err := a.Put(context.TODO(), ref, []byte("baz")); err == nil {
+		t.Errorf("Put() expected error")
+	}
+}
+
+func TestGBQArchive_LoadAll(t *testing.T) {
+	refs := []PageRef{{SHA256: "foo"}, {SHA256: "bar"}, {SHA256: "qux"}}
+	columns := [][]string{{"sha256", "body"}}
+
+	tests := []struct {
+		name    string
+		client  *mockGBQClient
+		want    map[string][]byte
+		wantErr bool
+	}{
+		{
+			name: "happy path",
+			client: &mockGBQClient{
+				columns: columns,
+				v:       []pipeline.DataReader{{{"foo", []byte("a")}, {"bar", []byte("b")}}},
+			},
+			want: map[string][]byte{"foo": []byte("a"), "bar": []byte("b")},
+		},
+		{
+			name:    "query error",
+			client:  &mockGBQClient{err: errors.New("foo")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				a := GBQArchive{Client: tt.client, Table: pipeline.TableRef{ProjectID: "p", Dataset: "d", Table: "t"}}
+				got, err := a.LoadAll(context.TODO(), refs)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("LoadAll() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("LoadAll() got = %v, want %v", got, tt.want)
+				}
+
+				wantQuery := "SELECT sha256, ANY_VALUE(body) AS body FROM `p.d.t` " +
+					"WHERE sha256 IN UNNEST(@sha256) GROUP BY sha256;"
+				if tt.client.queries[0] != wantQuery {
+					t.Errorf("LoadAll() query = %v, want %v", tt.client.queries[0], wantQuery)
+				}
+				wantParams := []pipeline.QueryParam{{Name: "sha256", Value: []string{"foo", "bar", "qux"}}}
+				if !reflect.DeepEqual(tt.client.params[0], wantParams) {
+					t.Errorf("LoadAll() params = %v, want %v", tt.client.params[0], wantParams)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,314 @@
+package dataextraction
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/kislerdm/gomodanalysis/app/pipeline"
+	"github.com/kislerdm/gomodanalysis/app/pipeline/dataextraction/model"
+	"github.com/kislerdm/gomodanalysis/app/pipeline/retry"
+)
+
+// Sections of the module's data on pkg.go.dev.
+const (
+	SectionMain       = "main"
+	SectionImports    = "imports"
+	SectionImportedBy = "importedby"
+)
+
+var sectionErrTypes = map[string]string{
+	SectionMain:       errPkgTypeMain,
+	SectionImports:    errPkgTypeImports,
+	SectionImportedBy: errPkgTypeImportedBy,
+}
+
+func (s SectionsStatus) bySection() map[string]SectionStatus {
+	return map[string]SectionStatus{
+		SectionMain:       s.Main,
+		SectionImports:    s.Imports,
+		SectionImportedBy: s.ImportedBy,
+	}
+}
+
+// States of the dead letter.
+const (
+	DeadLetterPending  = "pending"
+	DeadLetterResolved = "resolved"
+	DeadLetterGivenUp  = "given_up"
+)
+
+// DeadLetter the failed extraction of the module's section.
+// The dead letters are appended to the store, the latest one per module's section defines its state.
+type DeadLetter struct {
+	Module
+	Section       string        `bigquery:"section"`
+	Class         SectionStatus `bigquery:"class"`
+	Msg           string        `bigquery:"error"`
+	Attempt       int           `bigquery:"attempt"`
+	NextAttemptAt time.Time     `bigquery:"next_attempt_at"`
+	State         string        `bigquery:"state"`
+	Timestamp     time.Time     `bigquery:"timestamp"`
+}
+
+// DeadLetterPolicy defines how the dead letters are retried.
+type DeadLetterPolicy struct {
+	// Base the delay before the second attempt, the delay doubles after every failed attempt.
+	Base time.Duration
+
+	// MaxAttempts the number of attempts including the first extraction before the dead letter is given up.
+	MaxAttempts int
+}
+
+// NewDeadLetterPolicy parses the policy, the base delay defaults to 1h, the max attempts default to 5.
+func NewDeadLetterPolicy(base, maxAttempts string) (DeadLetterPolicy, error) {
+	o := DeadLetterPolicy{Base: time.Hour, MaxAttempts: 5}
+
+	if base != "" {
+		v, err := time.ParseDuration(base)
+		if err != nil || v <= 0 {
+			return DeadLetterPolicy{}, errors.New("faulty dead letter base delay " + base)
+		}
+		o.Base = v
+	}
+
+	if maxAttempts != "" {
+		v, err := strconv.Atoi(maxAttempts)
+		if err != nil || v < 1 {
+			return DeadLetterPolicy{}, errors.New("faulty dead letter max attempts " + maxAttempts)
+		}
+		o.MaxAttempts = v
+	}
+
+	return o, nil
+}
+
+// DeadLetters returns the dead letters for the module's extraction outcome given its pending dead letters.
+// The pending sections which were extracted, or not found are resolved. The failed sections are scheduled for the
+// next attempt with the exponential spacing, or given up once the attempts are exhausted.
+// The sections not found do not yield dead letters.
+func (p DeadLetterPolicy) DeadLetters(d PkgData, err error, pending []DeadLetter, now time.Time) []DeadLetter {
+	var errs ErrExtractGoPkgData
+	_ = errors.As(err, &errs)
+
+	prev := map[string]DeadLetter{}
+	for _, l := range pending {
+		prev[l.Section] = l
+	}
+
+	status := d.status.bySection()
+
+	sections := make([]string, 0, len(status))
+	for k := range status {
+		sections = append(sections, k)
+	}
+	sort.Strings(sections)
+
+	m := Module{Name: d.path, Version: d.version}
+
+	var o []DeadLetter
+	for _, section := range sections {
+		s := status[section]
+		l, ok := prev[section]
+
+		if s == StatusOK || s == StatusNotFound || s == "" {
+			if ok {
+				l.Class = s
+				l.Msg = ""
+				l.State = DeadLetterResolved
+				l.NextAttemptAt = time.Time{}
+				l.Timestamp = now
+				o = append(o, l)
+			}
+			continue
+		}
+
+		if !ok {
+			l = DeadLetter{Module: m, Section: section}
+		}
+		l.Attempt++
+		l.Class = s
+		l.Msg = ""
+		if errs.v != nil {
+			if e, ok := errs.v[sectionErrTypes[section]]; ok {
+				l.Msg = e.Error()
+			}
+		}
+		l.Timestamp = now
+
+		if l.Attempt >= p.MaxAttempts {
+			l.State = DeadLetterGivenUp
+			l.NextAttemptAt = time.Time{}
+		} else {
+			l.State = DeadLetterPending
+			l.NextAttemptAt = now.Add(retry.Exponential{Base: p.Base, Factor: 2}.Delay(l.Attempt, 0))
+		}
+
+		o = append(o, l)
+	}
+
+	return o
+}
+
+// DeadLetterStore stores the dead letters.
+type DeadLetterStore interface {
+	// Put appends the dead letters.
+	Put(ctx context.Context, letters []DeadLetter) error
+
+	// Eligible returns up to lim pending dead letters due by now, the most overdue first.
+	Eligible(ctx context.Context, now time.Time, lim int) ([]DeadLetter, error)
+}
+
+// GBQDeadLetters dead letters in the warehouse table defined by the PkgGoDevDeadLetter proto message.
+type GBQDeadLetters struct {
+	Client pipeline.GBQClient
+	Table  pipeline.TableRef
+}
+
+func deadLetterMessages(letters []DeadLetter) []*model.PkgGoDevDeadLetter {
+	o := make([]*model.PkgGoDevDeadLetter, len(letters))
+	for i, l := range letters {
+		var next int64
+		if !l.NextAttemptAt.IsZero() {
+			next = l.NextAttemptAt.UnixMicro()
+		}
+
+		o[i] = &model.PkgGoDevDeadLetter{
+			Path:          l.Name,
+			Version:       l.Version,
+			Section:       l.Section,
+			Class:         string(l.Class),
+			Error:         l.Msg,
+			Attempt:       int64(l.Attempt),
+			NextAttemptAt: next,
+			State:         l.State,
+			Timestamp:     l.Timestamp.UnixMicro(),
+		}
+	}
+	return o
+}
+
+func (s GBQDeadLetters) Put(ctx context.Context, letters []DeadLetter) error {
+	if len(letters) == 0 {
+		return nil
+	}
+	data, err := pipeline.NewProtoData(deadLetterMessages(letters)...)
+	if err != nil {
+		return err
+	}
+	return s.Client.Write(ctx, data, s.Table.Path())
+}
+
+func (s GBQDeadLetters) Eligible(ctx context.Context, now time.Time, lim int) ([]DeadLetter, error) {
+	o, err := pipeline.ReadAll[DeadLetter](
+		ctx, s.Client, queryEligibleDeadLetters(s.Table.ID()),
+		pipeline.QueryParam{Name: "now", Value: now},
+		pipeline.QueryParam{Name: "limit", Value: lim},
+	)
+	if err != nil {
+		return nil, errors.New("GBQDeadLetters.Eligible(): " + err.Error())
+	}
+	return o, nil
+}
+
+func queryEligibleDeadLetters(table string) string {
+	return `SELECT path, version, section, class, error, attempt, next_attempt_at, state, timestamp
+FROM (
+	SELECT * FROM ` + table + `
+	WHERE TRUE
+	QUALIFY ROW_NUMBER() OVER (PARTITION BY path, version, section ORDER BY timestamp DESC) = 1
+)
+WHERE state = '` + DeadLetterPending + `' AND next_attempt_at <= @now
+ORDER BY next_attempt_at, path, version, section
+LIMIT @limit;`
+}
+
+// DeadLettersReport the outcome of the dead letters retry.
+type DeadLettersReport struct {
+	Modules  int
+	Resolved int
+	Pending  int
+	GivenUp  int
+}
+
+// failedSections returns the data of the module with only the sections of its pending dead letters failed.
+// The class of the dead letter which is not transient, e.g. the parse error, is set to StatusError to retry it.
+// The other sections have no status because they are not extracted.
+func failedSections(m Module, pending []DeadLetter) PkgData {
+	o := PkgData{path: m.Name, version: m.Version}
+	for _, l := range pending {
+		s := l.Class
+		if !s.IsTransient() {
+			s = StatusError
+		}
+
+		switch l.Section {
+		case SectionMain:
+			o.status.Main = s
+		case SectionImports:
+			o.status.Imports = s
+		case SectionImportedBy:
+			o.status.ImportedBy = s
+		}
+	}
+	return o
+}
+
+// RetryDeadLetters extracts again the sections of the modules with up to lim eligible dead letters
+// and updates their state. Only the dead-lettered sections are extracted, the other sections of the data
+// passed to the function fn have no status. The data are not passed if the sections failed because of
+// transient errors.
+func RetryDeadLetters(
+	ctx context.Context, store DeadLetterStore, c *GoPackagesClient, p DeadLetterPolicy, lim int,
+	fn func(PkgData) error,
+) (DeadLettersReport, error) {
+	var report DeadLettersReport
+
+	letters, err := store.Eligible(ctx, time.Now(), lim)
+	if err != nil {
+		return report, err
+	}
+
+	var modules []Module
+	pending := map[Module][]DeadLetter{}
+	for _, l := range letters {
+		if _, ok := pending[l.Module]; !ok {
+			modules = append(modules, l.Module)
+		}
+		pending[l.Module] = append(pending[l.Module], l)
+	}
+
+	for _, m := range modules {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		d, err := RetryFailedSections(ctx, failedSections(m, pending[m]), c)
+		if err == nil || d.status.IsStorable() {
+			if err := fn(d); err != nil {
+				return report, err
+			}
+		}
+
+		updates := p.DeadLetters(d, err, pending[m], time.Now())
+		if err := store.Put(ctx, updates); err != nil {
+			return report, err
+		}
+
+		report.Modules++
+		for _, l := range updates {
+			switch l.State {
+			case DeadLetterResolved:
+				report.Resolved++
+			case DeadLetterPending:
+				report.Pending++
+			case DeadLetterGivenUp:
+				report.GivenUp++
+			}
+		}
+	}
+
+	return report, nil
+}
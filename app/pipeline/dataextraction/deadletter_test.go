@@ -0,0 +1,354 @@
+package dataextraction
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kislerdm/gomodanalysis/app/pipeline"
+)
+
+func TestNewDeadLetterPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		base        string
+		maxAttempts string
+		want        DeadLetterPolicy
+		wantErr     bool
+	}{
+		{
+			name:    "happy path: defaults",
+			want:    DeadLetterPolicy{Base: time.Hour, MaxAttempts: 5},
+			wantErr: false,
+		},
+		{
+			name:        "happy path",
+			base:        "10m",
+			maxAttempts: "3",
+			want:        DeadLetterPolicy{Base: 10 * time.Minute, MaxAttempts: 3},
+			wantErr:     false,
+		},
+		{
+			name:    "unhappy path: faulty base",
+			base:    "foo",
+			wantErr: true,
+		},
+		{
+			name:        "unhappy path: zero attempts",
+			maxAttempts: "0",
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got, err := NewDeadLetterPolicy(tt.base, tt.maxAttempts)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("NewDeadLetterPolicy() error = %v, wantErr %v", err, tt.wantErr)
+					return
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("NewDeadLetterPolicy() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestDeadLetterPolicy_DeadLetters(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := DeadLetterPolicy{Base: time.Hour, MaxAttempts: 3}
+	m := Module{Name: "foo", Version: "v1.0.0"}
+
+	errs := ErrExtractGoPkgData{v: map[string]error{errPkgTypeImportedBy: errors.New("bar")}, m: &sync.Mutex{}}
+
+	type args struct {
+		d       PkgData
+		err     error
+		pending []DeadLetter
+	}
+	tests := []struct {
+		name string
+		args args
+		want []DeadLetter
+	}{
+		{
+			name: "ok",
+			args: args{d: PkgData{path: "foo", version: "v1.0.0", status: statusAllOK}},
+			want: nil,
+		},
+		{
+			name: "not found",
+			args: args{
+				d: PkgData{
+					path: "foo", version: "v1.0.0",
+					status: SectionsStatus{Main: StatusNotFound, Imports: StatusNotFound, ImportedBy: StatusNotFound},
+				},
+				err: errs,
+			},
+			want: nil,
+		},
+		{
+			name: "new failure",
+			args: args{
+				d: PkgData{
+					path: "foo", version: "v1.0.0",
+					status: SectionsStatus{Main: StatusOK, Imports: StatusOK, ImportedBy: StatusRateLimited},
+				},
+				err: errs,
+			},
+			want: []DeadLetter{
+				{
+					Module:        m,
+					Section:       SectionImportedBy,
+					Class:         StatusRateLimited,
+					Msg:           "bar",
+					Attempt:       1,
+					NextAttemptAt: now.Add(time.Hour),
+					State:         DeadLetterPending,
+					Timestamp:     now,
+				},
+			},
+		},
+		{
+			name: "repeated failure is spaced exponentially",
+			args: args{
+				d: PkgData{
+					path: "foo", version: "v1.0.0",
+					status: SectionsStatus{Main: StatusOK, Imports: StatusOK, ImportedBy: StatusTimeout},
+				},
+				err: errs,
+				pending: []DeadLetter{
+					{Module: m, Section: SectionImportedBy, Attempt: 1, State: DeadLetterPending},
+				},
+			},
+			want: []DeadLetter{
+				{
+					Module:        m,
+					Section:       SectionImportedBy,
+					Class:         StatusTimeout,
+					Msg:           "bar",
+					Attempt:       2,
+					NextAttemptAt: now.Add(2 * time.Hour),
+					State:         DeadLetterPending,
+					Timestamp:     now,
+				},
+			},
+		},
+		{
+			name: "given up",
+			args: args{
+				d: PkgData{
+					path: "foo", version: "v1.0.0",
+					status: SectionsStatus{Main: StatusOK, Imports: StatusOK, ImportedBy: StatusError},
+				},
+				err: errs,
+				pending: []DeadLetter{
+					{Module: m, Section: SectionImportedBy, Attempt: 2, State: DeadLetterPending},
+				},
+			},
+			want: []DeadLetter{
+				{
+					Module:    m,
+					Section:   SectionImportedBy,
+					Class:     StatusError,
+					Msg:       "bar",
+					Attempt:   3,
+					State:     DeadLetterGivenUp,
+					Timestamp: now,
+				},
+			},
+		},
+		{
+			name: "resolved",
+			args: args{
+				d: PkgData{path: "foo", version: "v1.0.0", status: statusAllOK},
+				pending: []DeadLetter{
+					{
+						Module: m, Section: SectionMain, Class: StatusParseError, Msg: "baz", Attempt: 1,
+						State: DeadLetterPending,
+					},
+				},
+			},
+			want: []DeadLetter{
+				{
+					Module:    m,
+					Section:   SectionMain,
+					Class:     StatusOK,
+					Attempt:   1,
+					State:     DeadLetterResolved,
+					Timestamp: now,
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got := p.DeadLetters(tt.args.d, tt.args.err, tt.args.pending, now)
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("DeadLetters() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+// mockDeadLetterStore keeps the dead letters in memory.
+type mockDeadLetterStore struct {
+	letters []DeadLetter
+}
+
+func (s *mockDeadLetterStore) Put(_ context.Context, letters []DeadLetter) error {
+	s.letters = append(s.letters, letters...)
+	return nil
+}
+
+func (s *mockDeadLetterStore) Eligible(_ context.Context, now time.Time, lim int) ([]DeadLetter, error) {
+	latest := map[string]DeadLetter{}
+	var keys []string
+	for _, l := range s.letters {
+		k := l.String() + "/" + l.Section
+		if _, ok := latest[k]; !ok {
+			keys = append(keys, k)
+		}
+		latest[k] = l
+	}
+
+	var o []DeadLetter
+	for _, k := range keys {
+		l := latest[k]
+		if l.State == DeadLetterPending && !l.NextAttemptAt.After(now) && len(o) < lim {
+			o = append(o, l)
+		}
+	}
+	return o, nil
+}
+
+func TestRetryDeadLetters(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	store := &mockDeadLetterStore{
+		letters: []DeadLetter{
+			{
+				Module: Module{Name: "bar"}, Section: SectionImportedBy, Class: StatusRateLimited, Attempt: 1,
+				NextAttemptAt: past, State: DeadLetterPending,
+			},
+			{
+				Module: Module{Name: "qux"}, Section: SectionMain, Class: StatusTimeout, Attempt: 1,
+				NextAttemptAt: past, State: DeadLetterPending,
+			},
+			{
+				Module: Module{Name: "foo"}, Section: SectionMain, Class: StatusTimeout, Attempt: 1,
+				NextAttemptAt: time.Now().Add(time.Hour), State: DeadLetterPending,
+			},
+		},
+	}
+
+	var (
+		mu        sync.Mutex
+		requested []string
+	)
+	httpClient := httpFunc(
+		func(req *http.Request) (*http.Response, error) {
+			mu.Lock()
+			requested = append(requested, req.URL.Path+"?"+req.URL.RawQuery)
+			mu.Unlock()
+			return mockHTTP{}.Do(req)
+		},
+	)
+
+	var stored []SectionsStatus
+	report, err := RetryDeadLetters(
+		context.TODO(), store, NewGoPackagesClient(httpClient, 1), DeadLetterPolicy{Base: time.Hour, MaxAttempts: 3},
+		10, func(d PkgData) error {
+			stored = append(stored, d.status)
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("RetryDeadLetters() unexpected error = %v", err)
+	}
+
+	wantReport := DeadLettersReport{Modules: 2, Resolved: 2}
+	if report != wantReport {
+		t.Errorf("RetryDeadLetters() report = %v, want %v", report, wantReport)
+	}
+
+	wantStored := []SectionsStatus{{ImportedBy: StatusOK}, {Main: StatusNotFound}}
+	if !reflect.DeepEqual(stored, wantStored) {
+		t.Errorf("RetryDeadLetters() stored = %v, want %v", stored, wantStored)
+	}
+
+	sort.Strings(requested)
+	wantRequested := []string{"/bar?tab=importedby", "/qux?"}
+	if !reflect.DeepEqual(requested, wantRequested) {
+		t.Errorf("RetryDeadLetters() requested = %v, want only the dead-lettered sections %v", requested, wantRequested)
+	}
+
+	if got, _ := store.Eligible(context.TODO(), time.Now(), 10); len(got) != 0 {
+		t.Errorf("RetryDeadLetters() dead letters left = %v", got)
+	}
+}
+
+func TestGBQDeadLetters_Eligible(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	columns := []string{
+		"path", "version", "section", "class", "error", "attempt", "next_attempt_at", "state", "timestamp",
+	}
+
+	client := &mockGBQClient{
+		columns: [][]string{columns},
+		v: []pipeline.DataReader{
+			{
+				{
+					"foo", "v1.0.0", SectionImports, string(StatusTimeout), "bar", int64(2), now, DeadLetterPending,
+					now.Add(-time.Hour),
+				},
+			},
+		},
+	}
+
+	s := GBQDeadLetters{Client: client, Table: pipeline.TableRef{ProjectID: "p", Dataset: "d", Table: "t"}}
+
+	got, err := s.Eligible(context.TODO(), now, 10)
+	if err != nil {
+		t.Fatalf("Eligible() unexpected error = %v", err)
+	}
+
+	want := []DeadLetter{
+		{
+			Module:        Module{Name: "foo", Version: "v1.0.0"},
+			Section:       SectionImports,
+			Class:         StatusTimeout,
+			Msg:           "bar",
+			Attempt:       2,
+			NextAttemptAt: now,
+			State:         DeadLetterPending,
+			Timestamp:     now.Add(-time.Hour),
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Eligible() got = %v, want %v", got, want)
+	}
+
+	if q := client.queries[0]; !strings.Contains(q, "FROM `p.d.t`") || !strings.Contains(q, "LIMIT @limit;") {
+		t.Errorf("Eligible() unexpected query = %v", q)
+	}
+
+	wantParams := []pipeline.QueryParam{{Name: "now", Value: now}, {Name: "limit", Value: 10}}
+	if !reflect.DeepEqual(client.params[0], wantParams) {
+		t.Errorf("Eligible() params = %v, want %v", client.params[0], wantParams)
+	}
+
+	client = &mockGBQClient{columns: [][]string{columns}, v: []pipeline.DataReader{{{"foo", int64(1)}}}}
+	if _, err := (GBQDeadLetters{Client: client}).Eligible(context.TODO(), now, 10); err == nil {
+		t.Errorf("Eligible() error expected for the faulty rows")
+	}
+}
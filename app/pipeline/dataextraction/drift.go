@@ -0,0 +1,181 @@
+package dataextraction
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Fields tracked to detect the parser drift.
+const (
+	FieldVersion      = "meta.version"
+	FieldLicense      = "meta.license"
+	FieldRepository   = "meta.repository"
+	FieldIsModule     = "meta.is_module"
+	FieldIsValidGoMod = "meta.is_valid_go_mod"
+	FieldImportsStd   = "imports.std"
+	FieldImportedBy   = "importedby"
+)
+
+// DefaultDriftThresholds the min population rates of the fields expected for the majority of modules.
+var DefaultDriftThresholds = map[string]float64{
+	FieldVersion:    0.9,
+	FieldRepository: 0.5,
+	FieldIsModule:   0.5,
+}
+
+// populatedFields flags the fields of the extracted data which have non-zero values.
+func populatedFields(d PkgData) map[string]bool {
+	return map[string]bool{
+		FieldVersion:      d.meta.Version != "",
+		FieldLicense:      d.meta.License != "",
+		FieldRepository:   d.meta.Repository != "",
+		FieldIsModule:     d.meta.IsModule,
+		FieldIsValidGoMod: d.meta.IsValidGoMod,
+		FieldImportsStd:   len(d.imports.Std) > 0,
+		FieldImportedBy:   len(d.importedBy) > 0,
+	}
+}
+
+// ErrParserDrift the error returned when the extracted data look corrupted.
+type ErrParserDrift struct {
+	// Fields the fields which values are missing, or the rates below the thresholds.
+	Fields []string
+	Msg    string
+}
+
+func (e ErrParserDrift) Error() string {
+	return "parser drift: " + e.Msg + ": " + strings.Join(e.Fields, ", ")
+}
+
+// FieldStats tracks the population rate of the extracted fields per run. It is safe for concurrent use.
+type FieldStats struct {
+	cnt       int
+	populated map[string]int
+	mu        sync.Mutex
+}
+
+// NewFieldStats init the population rate tracker.
+func NewFieldStats() *FieldStats {
+	return &FieldStats{populated: map[string]int{}}
+}
+
+// Observe accounts the extracted module's data.
+func (s *FieldStats) Observe(d PkgData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cnt++
+	for k, ok := range populatedFields(d) {
+		if ok {
+			s.populated[k]++
+		}
+	}
+}
+
+// Count returns the number of observed modules.
+func (s *FieldStats) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cnt
+}
+
+// Rates returns the population rates per field.
+func (s *FieldStats) Rates() map[string]float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o := map[string]float64{}
+	for k := range populatedFields(PkgData{}) {
+		if s.cnt > 0 {
+			o[k] = float64(s.populated[k]) / float64(s.cnt)
+		} else {
+			o[k] = 0
+		}
+	}
+	return o
+}
+
+// Check returns ErrParserDrift if the population rate of any field is below its threshold.
+// The check is skipped until minSamples modules are observed.
+func (s *FieldStats) Check(thresholds map[string]float64, minSamples int) error {
+	if s.Count() < minSamples {
+		return nil
+	}
+
+	rates := s.Rates()
+
+	var fields []string
+	for k, th := range thresholds {
+		if rates[k] < th {
+			fields = append(
+				fields,
+				k+"="+strconv.FormatFloat(rates[k], 'f', 3, 64)+"<"+strconv.FormatFloat(th, 'f', 3, 64),
+			)
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	sort.Strings(fields)
+	return ErrParserDrift{Fields: fields, Msg: "population rates below thresholds"}
+}
+
+// ParseDriftThresholds parses the thresholds from comma separated key=value pairs, e.g. meta.version=0.9.
+// The empty string yields DefaultDriftThresholds.
+func ParseDriftThresholds(s string) (map[string]float64, error) {
+	if s == "" {
+		return DefaultDriftThresholds, nil
+	}
+
+	known := populatedFields(PkgData{})
+
+	o := map[string]float64{}
+	for _, kv := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(kv), "=")
+		if !ok {
+			return nil, errors.New("faulty drift threshold " + kv)
+		}
+		if _, ok := known[k]; !ok {
+			return nil, errors.New("unknown drift threshold field " + k)
+		}
+
+		th, err := strconv.ParseFloat(v, 64)
+		if err != nil || th < 0 || th > 1 {
+			return nil, errors.New("faulty drift threshold value " + kv)
+		}
+		o[k] = th
+	}
+
+	return o, nil
+}
+
+// CanaryModule the module with all tracked fields populated on pkg.go.dev.
+const CanaryModule = "github.com/fsouza/go-dockerclient"
+
+// RunCanary extracts the known module and returns ErrParserDrift if any tracked field is missing.
+func RunCanary(ctx context.Context, c *GoPackagesClient, name string) error {
+	d, err := ExtractGoPkgData(ctx, name, "", c)
+	if err != nil {
+		return errors.New("canary " + name + " extraction error: " + err.Error())
+	}
+
+	var fields []string
+	for k, ok := range populatedFields(d) {
+		if !ok {
+			fields = append(fields, k)
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	sort.Strings(fields)
+	return ErrParserDrift{Fields: fields, Msg: "canary " + name + " misses fields"}
+}
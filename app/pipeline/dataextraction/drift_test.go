@@ -0,0 +1,145 @@
+package dataextraction
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestFieldStats_Check(t *testing.T) {
+	valid := PkgData{
+		path: "foo",
+		meta: Meta{Version: "v1.0.0", Repository: "https://github.com/foo/foo", IsModule: true},
+	}
+	corrupt := PkgData{path: "bar", meta: Meta{IsModule: true}}
+
+	tests := []struct {
+		name       string
+		observed   []PkgData
+		minSamples int
+		wantFields []string
+		wantErr    bool
+	}{
+		{
+			name:       "no drift",
+			observed:   []PkgData{valid, valid, valid},
+			minSamples: 1,
+			wantErr:    false,
+		},
+		{
+			name:       "drift",
+			observed:   []PkgData{valid, corrupt, corrupt, corrupt},
+			minSamples: 1,
+			wantFields: []string{"meta.repository=0.250<0.500", "meta.version=0.250<0.900"},
+			wantErr:    true,
+		},
+		{
+			name:       "not enough samples",
+			observed:   []PkgData{corrupt},
+			minSamples: 10,
+			wantErr:    false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				s := NewFieldStats()
+				for _, d := range tt.observed {
+					s.Observe(d)
+				}
+
+				err := s.Check(DefaultDriftThresholds, tt.minSamples)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("Check() error = %v, wantErr %v", err, tt.wantErr)
+					return
+				}
+
+				var e ErrParserDrift
+				if errors.As(err, &e) && !reflect.DeepEqual(e.Fields, tt.wantFields) {
+					t.Errorf("Check() fields = %v, want %v", e.Fields, tt.wantFields)
+				}
+			},
+		)
+	}
+}
+
+func TestParseDriftThresholds(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    map[string]float64
+		wantErr bool
+	}{
+		{
+			name:    "default",
+			s:       "",
+			want:    DefaultDriftThresholds,
+			wantErr: false,
+		},
+		{
+			name:    "custom",
+			s:       "meta.version=0.99, imports.std=0.5",
+			want:    map[string]float64{FieldVersion: 0.99, FieldImportsStd: 0.5},
+			wantErr: false,
+		},
+		{
+			name:    "unknown field",
+			s:       "meta.foo=0.5",
+			wantErr: true,
+		},
+		{
+			name:    "rate above one",
+			s:       "meta.version=2",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got, err := ParseDriftThresholds(tt.s)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("ParseDriftThresholds() error = %v, wantErr %v", err, tt.wantErr)
+					return
+				}
+				if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("ParseDriftThresholds() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestRunCanary(t *testing.T) {
+	tests := []struct {
+		name    string
+		module  string
+		wantErr bool
+	}{
+		{
+			name:    "happy path",
+			module:  "go-dockerclient",
+			wantErr: false,
+		},
+		{
+			name:    "unhappy path: fields missing",
+			module:  "github.com/hzysmail/multiple-knapsack-problem",
+			wantErr: true,
+		},
+		{
+			name:    "unhappy path: not found",
+			module:  "qux",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				err := RunCanary(context.TODO(), NewGoPackagesClient(mockHTTP{}, 1), tt.module)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("RunCanary() error = %v, wantErr %v", err, tt.wantErr)
+				}
+			},
+		)
+	}
+}
@@ -1,60 +1,121 @@
 package dataextraction
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 	"sync"
 	"time"
 
-	"cloud.google.com/go/bigquery/storage/managedwriter/adapt"
+	"github.com/kislerdm/gomodanalysis/app/pipeline"
 	"github.com/kislerdm/gomodanalysis/app/pipeline/dataextraction/model"
-	"google.golang.org/protobuf/proto"
-	"google.golang.org/protobuf/types/descriptorpb"
 )
 
 type PkgData struct {
 	path       string
+	version    string
 	meta       Meta
 	imports    ModuleImports
 	importedBy ModuleImportedBy
+	status     SectionsStatus
+
+	// errs the errors of the failed sections by the section's error type
+	errs map[string]error
 }
 
-func (d PkgData) Descriptor() *descriptorpb.DescriptorProto {
-	m := &model.PkgGoDev{}
-	descriptorProto, err := adapt.NormalizeDescriptor(m.ProtoReflect().Descriptor())
-	if err != nil {
-		panic("PkgData.Descriptor() error: " + err.Error())
-	}
-	return descriptorProto
-}
-
-func (d PkgData) Data() [][]byte {
-	b, err := proto.Marshal(
-		&model.PkgGoDev{
-			Path:    d.path,
-			Version: d.meta.Version,
-			Meta: &model.PkgGoDev_Meta{
-				License:                    d.meta.License,
-				Repository:                 d.meta.Repository,
-				IsModule:                   d.meta.IsModule,
-				IsLatestVersion:            d.meta.IsLatestVersion,
-				IsValidGoMod:               d.meta.IsValidGoMod,
-				WithRedistributableLicense: d.meta.WithRedistributableLicense,
-				IsTaggedVersion:            d.meta.IsTaggedVersion,
-				IsStableVersion:            d.meta.IsStableVersion,
-			},
-			Imports: &model.PkgGoDev_Imports{
-				Std:    d.imports.Std,
-				Nonstd: d.imports.NonStd,
-			},
-			Importedby: d.importedBy,
-			Timestamp:  time.Now().UTC().UnixMicro(),
+// Message returns the row of the module to persist to the table defined by the PkgGoDev proto message.
+func (d PkgData) Message() *model.PkgGoDev {
+	// the requested version takes precedence to track the extraction state per version
+	version := d.version
+	if version == "" {
+		version = d.meta.Version
+	}
+
+	return &model.PkgGoDev{
+		Path:    d.path,
+		Version: version,
+		Meta: &model.PkgGoDev_Meta{
+			License:                    d.meta.License,
+			Repository:                 d.meta.Repository,
+			IsModule:                   d.meta.IsModule,
+			IsLatestVersion:            d.meta.IsLatestVersion,
+			IsValidGoMod:               d.meta.IsValidGoMod,
+			WithRedistributableLicense: d.meta.WithRedistributableLicense,
+			IsTaggedVersion:            d.meta.IsTaggedVersion,
+			IsStableVersion:            d.meta.IsStableVersion,
 		},
-	)
-	if err != nil {
-		panic("PkgData.Data() error: " + err.Error())
+		Imports: &model.PkgGoDev_Imports{
+			Std:    d.imports.Std,
+			Nonstd: d.imports.NonStd,
+		},
+		Importedby: d.importedBy,
+		Status: &model.PkgGoDev_Status{
+			Main:       string(d.status.Main),
+			Imports:    string(d.status.Imports),
+			Importedby: string(d.status.ImportedBy),
+		},
+		Timestamp: time.Now().UTC().UnixMicro(),
 	}
-	return [][]byte{b}
+}
+
+// SectionStatus the extraction status of a pkg.go.dev page section.
+type SectionStatus string
+
+const (
+	StatusOK          SectionStatus = "ok"
+	StatusNotFound    SectionStatus = "not_found"
+	StatusRateLimited SectionStatus = "rate_limited"
+	StatusParseError  SectionStatus = "parse_error"
+	StatusTimeout     SectionStatus = "timeout"
+	// StatusError any other failure, e.g. the server, or transport error.
+	StatusError SectionStatus = "error"
+)
+
+// IsTransient flags the failures which may be resolved by the retry.
+func (s SectionStatus) IsTransient() bool {
+	switch s {
+	case StatusRateLimited, StatusTimeout, StatusError:
+		return true
+	default:
+		return false
+	}
+}
+
+// SectionsStatus the extraction status per section of the module's data.
+type SectionsStatus struct {
+	Main       SectionStatus
+	Imports    SectionStatus
+	ImportedBy SectionStatus
+}
+
+// IsOK flags if all sections were extracted.
+func (s SectionsStatus) IsOK() bool {
+	return s.Main == StatusOK && s.Imports == StatusOK && s.ImportedBy == StatusOK
+}
+
+// AnyOK flags if at least one section was extracted.
+func (s SectionsStatus) AnyOK() bool {
+	return s.Main == StatusOK || s.Imports == StatusOK || s.ImportedBy == StatusOK
+}
+
+// IsTransient flags if any section failed with the transient error.
+func (s SectionsStatus) IsTransient() bool {
+	return s.Main.IsTransient() || s.Imports.IsTransient() || s.ImportedBy.IsTransient()
+}
+
+// IsStorable flags if the data shall be stored: at least one section was extracted,
+// or the failures are not transient, e.g. the module is not found.
+func (s SectionsStatus) IsStorable() bool {
+	return s.AnyOK() || !s.IsTransient()
+}
+
+var statusAllOK = SectionsStatus{Main: StatusOK, Imports: StatusOK, ImportedBy: StatusOK}
+
+// Status returns the extraction status per section.
+func (d PkgData) Status() SectionsStatus {
+	return d.status
 }
 
 const (
@@ -63,26 +124,29 @@ const (
 	errPkgTypeImportedBy = "pkg.go.dev/importedby"
 )
 
-// ErrExtractGoPkgData error returned by ExtractGoPkgData
+// ErrExtractGoPkgData error returned by ExtractGoPkgData, it collects the errors per page section.
+// It matches the sections' errors with errors.Is and errors.As.
 type ErrExtractGoPkgData struct {
-	v map[string]ErrGoPackageClient
+	v map[string]error
 	m *sync.Mutex
 }
 
 func (e ErrExtractGoPkgData) Add(t string, err error) {
 	e.m.Lock()
-	er, ok := err.(ErrGoPackageClient)
-	if !ok {
-		panic("ErrExtractGoPkgData.Add(): wrong error type")
-	}
-	e.v[t] = er
+	e.v[t] = err
 	e.m.Unlock()
 }
 
 func (e ErrExtractGoPkgData) Error() string {
+	keys := make([]string, 0, len(e.v))
+	for k := range e.v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
 	o := ""
-	for k, v := range e.v {
-		o += "[Type:" + k + "]" + v.Error() + "\n"
+	for _, k := range keys {
+		o += "[Type:" + k + "]" + e.v[k].Error() + "\n"
 	}
 	return o
 }
@@ -93,91 +157,165 @@ func (e ErrExtractGoPkgData) IsNil() bool {
 
 func (e ErrExtractGoPkgData) IsHTTPStatus(status int) bool {
 	for _, err := range e.v {
-		if err.StatusCode == status {
+		var er ErrGoPackageClient
+		if errors.As(err, &er) && er.StatusCode == status {
 			return true
 		}
 	}
 	return false
 }
 
+func (e ErrExtractGoPkgData) Is(target error) bool {
+	for _, err := range e.v {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e ErrExtractGoPkgData) As(target interface{}) bool {
+	for _, err := range e.v {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// sectionStatus classifies the section's extraction error.
+func sectionStatus(ctx context.Context, err error) SectionStatus {
+	var errTimeout interface{ Timeout() bool }
+	switch {
+	case ctx.Err() != nil, errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &errTimeout) && errTimeout.Timeout():
+		return StatusTimeout
+	case errors.Is(err, pipeline.ErrNotFound):
+		return StatusNotFound
+	case errors.Is(err, pipeline.ErrRateLimited):
+		return StatusRateLimited
+	case errors.Is(err, pipeline.ErrParse):
+		return StatusParseError
+	default:
+		return StatusError
+	}
+}
+
 // ExtractGoPkgData extracts module's data from https://pkg.go.dev
-func ExtractGoPkgData(name, version string, c *GoPackagesClient) (PkgData, error) {
-	o := PkgData{path: name}
+// The default module's page is fetched if the version is not set.
+// The requests are cancelled when the context is done.
+// The sections extracted successfully are returned along with the error, see PkgData.Status.
+func ExtractGoPkgData(ctx context.Context, name, version string, c *GoPackagesClient) (PkgData, error) {
+	return extractSections(ctx, PkgData{path: name, version: version}, c, true, true, true)
+}
 
-	if version != "" {
-		name += "@" + version
+// RetryFailedSections extracts again only the sections of d which failed with the transient error.
+// The errors of the sections which are not retried, e.g. the parse errors, are returned along with
+// the errors of the retried sections.
+func RetryFailedSections(ctx context.Context, d PkgData, c *GoPackagesClient) (PkgData, error) {
+	return extractSections(
+		ctx, d, c, d.status.Main.IsTransient(), d.status.Imports.IsTransient(), d.status.ImportedBy.IsTransient(),
+	)
+}
+
+func extractSections(ctx context.Context, o PkgData, c *GoPackagesClient, main, imports, importedBy bool) (
+	PkgData, error,
+) {
+	name := o.path
+	if o.version != "" {
+		name += "@" + o.version
 	}
 
 	if c == nil {
 		c = NewGoPackagesClient(&http.Client{Timeout: 60 * time.Second}, 30)
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(3)
 	errs := ErrExtractGoPkgData{
-		v: map[string]ErrGoPackageClient{},
+		v: map[string]error{},
 		m: &sync.Mutex{},
 	}
 
-	go func(name string, wg *sync.WaitGroup, o *PkgData) {
-		defer wg.Done()
-		var err error
-		defer func() {
-			if r := recover(); r != nil {
-				errs.Add(
-					errPkgTypeMain,
-					ErrGoPackageClient{
-						StatusCode: -1,
-						Msg:        fmt.Sprintf("%v", r),
-					},
-				)
-			}
-		}()
-		o.meta, err = c.GetMeta(name)
-		if err != nil {
-			errs.Add(errPkgTypeMain, err)
+	retried := map[string]bool{errPkgTypeMain: main, errPkgTypeImports: imports, errPkgTypeImportedBy: importedBy}
+	for t, err := range o.errs {
+		if !retried[t] {
+			errs.v[t] = err
 		}
-	}(name, &wg, &o)
-
-	go func(name string, wg *sync.WaitGroup, o *PkgData) {
-		defer wg.Done()
-		var err error
-		defer func() {
-			if r := recover(); r != nil {
-				errs.Add(
-					errPkgTypeImports,
-					ErrGoPackageClient{
-						StatusCode: -1,
-						Msg:        fmt.Sprintf("%v", r),
-					},
-				)
+	}
+	o.errs = nil
+
+	type section struct {
+		t      string
+		status *SectionStatus
+		fetch  func() error
+	}
+
+	var sections []section
+	if main {
+		sections = append(
+			sections, section{
+				errPkgTypeMain, &o.status.Main, func() error {
+					v, err := c.GetMeta(ctx, name)
+					if err == nil {
+						o.meta = v
+					}
+					return err
+				},
+			},
+		)
+	}
+	if imports {
+		sections = append(
+			sections, section{
+				errPkgTypeImports, &o.status.Imports, func() error {
+					v, err := c.GetImports(ctx, name)
+					if err == nil {
+						o.imports = v
+					}
+					return err
+				},
+			},
+		)
+	}
+	if importedBy {
+		sections = append(
+			sections, section{
+				errPkgTypeImportedBy, &o.status.ImportedBy, func() error {
+					v, err := c.GetImportedBy(ctx, name)
+					if err == nil {
+						o.importedBy = v
+					}
+					return err
+				},
+			},
+		)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(sections))
+
+	for _, s := range sections {
+		go func(s section) {
+			defer wg.Done()
+
+			fail := func(err error) {
+				errs.Add(s.t, err)
+				*s.status = sectionStatus(ctx, err)
 			}
-		}()
-		o.imports, err = c.GetImports(name)
-		if err != nil {
-			errs.Add(errPkgTypeImports, err)
-		}
-	}(name, &wg, &o)
-
-	go func(name string, wg *sync.WaitGroup, o *PkgData) {
-		defer wg.Done()
-		var err error
-		defer func() {
-			if r := recover(); r != nil {
-				errs.Add(
-					errPkgTypeImportedBy,
-					ErrGoPackageClient{
-						StatusCode: -1,
-						Msg:        fmt.Sprintf("%v", r),
-					},
-				)
+
+			// the unexpected HTML content may break the parsers
+			defer func() {
+				if r := recover(); r != nil {
+					fail(pipeline.NewError(pipeline.ErrParse, errors.New(fmt.Sprintf("%v", r))))
+				}
+			}()
+
+			if err := s.fetch(); err != nil {
+				fail(err)
+				return
 			}
-		}()
-		o.importedBy, err = c.GetImportedBy(name)
-		if err != nil {
-			errs.Add(errPkgTypeImportedBy, err)
-		}
-	}(name, &wg, &o)
+			*s.status = StatusOK
+		}(s)
+	}
 
 	wg.Wait()
 
@@ -185,5 +323,6 @@ func ExtractGoPkgData(name, version string, c *GoPackagesClient) (PkgData, error
 		return o, nil
 	}
 
-	return PkgData{path: name}, errs
+	o.errs = errs.v
+	return o, errs
 }
@@ -1,8 +1,18 @@
 package dataextraction
 
 import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/kislerdm/gomodanalysis/app/pipeline"
 )
 
 func TestExtractGoPkgData(t *testing.T) {
@@ -87,6 +97,7 @@ func TestExtractGoPkgData(t *testing.T) {
 					"bitbucket.org/blackxcloudeng/scope/probe/docker",
 					"bldy.build/build/namespace/docker",
 				},
+				status: statusAllOK,
 			},
 			wantErr: false,
 		},
@@ -97,18 +108,37 @@ func TestExtractGoPkgData(t *testing.T) {
 				version: "",
 				c:       NewGoPackagesClient(mockHTTP{}, 1),
 			},
-			want:    PkgData{path: "qux"},
+			want: PkgData{
+				path:   "qux",
+				status: SectionsStatus{Main: StatusNotFound, Imports: StatusNotFound, ImportedBy: StatusNotFound},
+			},
+			wantErr: true,
+		},
+		{
+			name: "happy path: package version not found",
+			args: args{
+				name:    "qux",
+				version: "v1.0.0",
+				c:       NewGoPackagesClient(mockHTTP{}, 1),
+			},
+			want: PkgData{
+				path:    "qux",
+				version: "v1.0.0",
+				status:  SectionsStatus{Main: StatusNotFound, Imports: StatusNotFound, ImportedBy: StatusNotFound},
+			},
 			wantErr: true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(
 			tt.name, func(t *testing.T) {
-				got, err := ExtractGoPkgData(tt.args.name, tt.args.version, tt.args.c)
+				got, err := ExtractGoPkgData(context.TODO(), tt.args.name, tt.args.version, tt.args.c)
 				if (err != nil) != tt.wantErr {
 					t.Errorf("ExtractGoPkgData() error = %v, wantErr %v", err, tt.wantErr)
 					return
 				}
+				// the sections' errors are returned as the error
+				got.errs = nil
 				if !reflect.DeepEqual(got, tt.want) {
 					t.Errorf("ExtractGoPkgData() got = %v, want %v", got, tt.want)
 				}
@@ -116,3 +146,193 @@ func TestExtractGoPkgData(t *testing.T) {
 		)
 	}
 }
+
+// flakyHTTP mimics the rate limit for the tabs until the number of failures is reached.
+type flakyHTTP struct {
+	failures map[string]int
+	calls    []string
+	mu       sync.Mutex
+}
+
+func (c *flakyHTTP) Do(req *http.Request) (*http.Response, error) {
+	tab := req.URL.Query().Get("tab")
+
+	c.mu.Lock()
+	c.calls = append(c.calls, tab)
+	fail := c.failures[tab] > 0
+	if fail {
+		c.failures[tab]--
+	}
+	c.mu.Unlock()
+
+	if fail {
+		return &http.Response{
+			Status:     "Mimic Too Many Requests",
+			StatusCode: http.StatusTooManyRequests,
+			Body:       io.NopCloser(strings.NewReader("")),
+		}, nil
+	}
+	return mockHTTP{}.Do(req)
+}
+
+func TestRetryFailedSections(t *testing.T) {
+	httpClient := &flakyHTTP{failures: map[string]int{"importedby": 2}}
+	c := NewGoPackagesClient(httpClient, 1)
+
+	want, err := ExtractGoPkgData(context.TODO(), "bar", "", NewGoPackagesClient(mockHTTP{}, 1))
+	if err != nil {
+		t.Fatalf("ExtractGoPkgData() unexpected error = %v", err)
+	}
+
+	got, err := ExtractGoPkgData(context.TODO(), "bar", "", c)
+	if err == nil {
+		t.Fatalf("ExtractGoPkgData() error expected")
+	}
+
+	wantStatus := SectionsStatus{Main: StatusOK, Imports: StatusOK, ImportedBy: StatusRateLimited}
+	if got.Status() != wantStatus {
+		t.Errorf("ExtractGoPkgData() status got = %v, want %v", got.Status(), wantStatus)
+	}
+	if !reflect.DeepEqual(got.meta, want.meta) || !reflect.DeepEqual(got.imports, want.imports) {
+		t.Errorf("ExtractGoPkgData() the successful sections must be kept")
+	}
+	if got.importedBy != nil {
+		t.Errorf("ExtractGoPkgData() the failed section must be empty, got = %v", got.importedBy)
+	}
+
+	httpClient.calls = nil
+
+	got, err = RetryFailedSections(context.TODO(), got, c)
+	if err != nil {
+		t.Fatalf("RetryFailedSections() unexpected error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RetryFailedSections() got = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(httpClient.calls, []string{"importedby"}) {
+		t.Errorf("RetryFailedSections() must fetch only the failed sections, got = %v", httpClient.calls)
+	}
+}
+
+// sectionHTTP mimics the failure of the tab with the status code until the number of failures is reached,
+// the main page is corrupt.
+type sectionHTTP struct {
+	code     map[string]int
+	failures map[string]int
+	calls    []string
+	mu       sync.Mutex
+}
+
+func (c *sectionHTTP) Do(req *http.Request) (*http.Response, error) {
+	tab := req.URL.Query().Get("tab")
+
+	c.mu.Lock()
+	c.calls = append(c.calls, tab)
+	fail := c.failures[tab] > 0
+	if fail {
+		c.failures[tab]--
+	}
+	c.mu.Unlock()
+
+	if fail {
+		return &http.Response{
+			Status:     http.StatusText(c.code[tab]),
+			StatusCode: c.code[tab],
+			Body:       io.NopCloser(strings.NewReader("")),
+		}, nil
+	}
+	if tab == "" {
+		// the corrupt main page fails the parser
+		return &http.Response{
+			Status:     http.StatusText(http.StatusOK),
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(iotest.ErrReader(errors.New("corrupt page"))),
+		}, nil
+	}
+	return mockHTTP{}.Do(req)
+}
+
+func TestRetryFailedSections_keepsNotRetriedErrors(t *testing.T) {
+	httpClient := &sectionHTTP{
+		code:     map[string]int{"imports": http.StatusGatewayTimeout},
+		failures: map[string]int{"imports": 1},
+	}
+	c := NewGoPackagesClient(httpClient, 1)
+	c.retry.MaxAttempts = 1
+
+	got, err := ExtractGoPkgData(context.TODO(), "bar", "", c)
+	if err == nil {
+		t.Fatalf("ExtractGoPkgData() error expected")
+	}
+	if got.Status().Main != StatusParseError || !got.Status().Imports.IsTransient() {
+		t.Fatalf("ExtractGoPkgData() status = %v, want main parse_error and imports transient", got.Status())
+	}
+
+	httpClient.calls = nil
+
+	got, err = RetryFailedSections(context.TODO(), got, c)
+	if !reflect.DeepEqual(httpClient.calls, []string{"imports"}) {
+		t.Errorf("RetryFailedSections() must fetch only the transiently failed sections, got = %v", httpClient.calls)
+	}
+
+	wantStatus := SectionsStatus{Main: StatusParseError, Imports: StatusOK, ImportedBy: StatusOK}
+	if got.Status() != wantStatus {
+		t.Errorf("RetryFailedSections() status = %v, want %v", got.Status(), wantStatus)
+	}
+
+	if !errors.Is(err, pipeline.ErrParse) {
+		t.Fatalf("RetryFailedSections() error = %v, want the parse error of the main section kept", err)
+	}
+
+	letters := DeadLetterPolicy{Base: time.Hour, MaxAttempts: 3}.DeadLetters(got, err, nil, time.Now())
+	if len(letters) != 1 || letters[0].Section != SectionMain || letters[0].Msg == "" {
+		t.Errorf("DeadLetters() = %v, want the main section dead-lettered with its error", letters)
+	}
+}
+
+func TestSectionsStatus(t *testing.T) {
+	tests := []struct {
+		name          string
+		s             SectionsStatus
+		wantOK        bool
+		wantAnyOK     bool
+		wantTransient bool
+	}{
+		{
+			name:          "all ok",
+			s:             statusAllOK,
+			wantOK:        true,
+			wantAnyOK:     true,
+			wantTransient: false,
+		},
+		{
+			name:          "not found",
+			s:             SectionsStatus{Main: StatusNotFound, Imports: StatusNotFound, ImportedBy: StatusNotFound},
+			wantOK:        false,
+			wantAnyOK:     false,
+			wantTransient: false,
+		},
+		{
+			name:          "partial with timeout",
+			s:             SectionsStatus{Main: StatusOK, Imports: StatusParseError, ImportedBy: StatusTimeout},
+			wantOK:        false,
+			wantAnyOK:     true,
+			wantTransient: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if got := tt.s.IsOK(); got != tt.wantOK {
+					t.Errorf("IsOK() = %v, want %v", got, tt.wantOK)
+				}
+				if got := tt.s.AnyOK(); got != tt.wantAnyOK {
+					t.Errorf("AnyOK() = %v, want %v", got, tt.wantAnyOK)
+				}
+				if got := tt.s.IsTransient(); got != tt.wantTransient {
+					t.Errorf("IsTransient() = %v, want %v", got, tt.wantTransient)
+				}
+			},
+		)
+	}
+}
@@ -1,83 +1,69 @@
 package dataextraction
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"io"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/kislerdm/gomodanalysis/app/pipeline"
+	"github.com/kislerdm/gomodanalysis/app/pipeline/retry"
 	"golang.org/x/net/html"
 )
 
+// ErrGoPackageClient the error returned by GoPackagesClient.
+// It unwraps to the cause, use errors.Is to classify the failure, e.g. pipeline.ErrNotFound.
 type ErrGoPackageClient struct {
+	// StatusCode the HTTP status of the response, 0 if no response was received.
 	StatusCode int
 	Msg        string
+	Err        error
 }
 
 func (e ErrGoPackageClient) Error() string {
 	return "[StatusCode:" + strconv.Itoa(e.StatusCode) + "] " + e.Msg
 }
 
-type HttpClient interface {
-	Get(url string) (*http.Response, error)
+func (e ErrGoPackageClient) Unwrap() error {
+	return e.Err
 }
 
-type backoff struct {
-	v   map[string]int8
-	max int8
-	mu  *sync.RWMutex
+// HttpClient sends the HTTP requests, the request's context governs cancellation.
+type HttpClient interface {
+	Do(req *http.Request) (*http.Response, error)
 }
 
-func (b backoff) multiplier(route string) int8 {
-	b.mu.RLock()
-	multiplier, ok := b.v[route]
-	b.mu.RUnlock()
-	if !ok {
-		multiplier = 0
-	}
-	return multiplier
-}
+// GoPackagesClient client to extract data from https://pkg.go.dev.
+type GoPackagesClient struct {
+	HTTPClient HttpClient
 
-func (b backoff) Reset(route string) {
-	b.mu.Lock()
-	delete(b.v, route)
-	b.mu.Unlock()
-}
+	// RateLimiter limits requests to the host, it shall be shared by all workers.
+	RateLimiter *pipeline.RateLimiter
 
-func (b backoff) Sleep(route string) error {
-	m := b.multiplier(route)
-	if m > b.max {
-		delete(b.v, route)
-		return errors.New("max backoff duration was reached")
-	}
-	time.Sleep(time.Duration(m) * time.Second)
-	return nil
-}
+	// Archive stores the raw fetched pages, including the error responses, if set.
+	Archive Archive
 
-func (b backoff) Increment(route string) {
-	base := b.multiplier(route)
-	b.mu.Lock()
-	b.v[route] = base + 1
-	b.mu.Unlock()
-}
+	// Rules defines how to extract the module's metadata, DefaultRules are used if not set.
+	Rules *Ruleset
 
-// GoPackagesClient client to extract data from https://pkg.go.dev.
-type GoPackagesClient struct {
-	HTTPClient HttpClient
-	backoff    backoff
+	retry retry.Policy
 }
 
 // NewGoPackagesClient init a client to fetch data from https://pkg.go.dev.
+// The requests rate is not limited by default, the client only pauses when the host sets Retry-After.
 func NewGoPackagesClient(httpClient HttpClient, maxBackoffSec int8) *GoPackagesClient {
 	return &GoPackagesClient{
-		HTTPClient: httpClient,
-		backoff: backoff{
-			v:   map[string]int8{},
-			max: maxBackoffSec,
-			mu:  &sync.RWMutex{},
+		HTTPClient:  httpClient,
+		RateLimiter: pipeline.NewRateLimiter(0, 1, time.Duration(maxBackoffSec)*time.Second),
+		retry: retry.Policy{
+			Strategy:    retry.Linear{Step: time.Second},
+			MaxAttempts: int(maxBackoffSec) + 1,
+			MaxDelay:    time.Duration(maxBackoffSec) * time.Second,
 		},
 	}
 }
@@ -90,8 +76,8 @@ type ModuleImports struct {
 
 // GetImports extracts the modules imported by the given module identified by the name.
 // The name with version concatenated with the @ sign is acceptable: {{name}}@{{version}}
-func (c GoPackagesClient) GetImports(name string) (ModuleImports, error) {
-	r, err := c.get(name + "?tab=imports")
+func (c GoPackagesClient) GetImports(ctx context.Context, name string) (ModuleImports, error) {
+	r, err := c.get(ctx, name+"?tab=imports")
 	defer func() {
 		if r != nil {
 			_ = r.Close()
@@ -103,8 +89,9 @@ func (c GoPackagesClient) GetImports(name string) (ModuleImports, error) {
 	o, err := parseHTMLGoPackageImports(r)
 	if err != nil {
 		return ModuleImports{}, ErrGoPackageClient{
-			StatusCode: 0,
+			StatusCode: http.StatusOK,
 			Msg:        err.Error(),
+			Err:        pipeline.NewError(pipeline.ErrParse, err),
 		}
 	}
 	return o, nil
@@ -176,8 +163,8 @@ type ModuleImportedBy []string
 
 // GetImportedBy extracts the modules importing the given module identified by the name.
 // The name with version concatenated with the @ sign is acceptable: {{name}}@{{version}}
-func (c GoPackagesClient) GetImportedBy(name string) (ModuleImportedBy, error) {
-	r, err := c.get(name + "?tab=importedby")
+func (c GoPackagesClient) GetImportedBy(ctx context.Context, name string) (ModuleImportedBy, error) {
+	r, err := c.get(ctx, name+"?tab=importedby")
 	defer func() {
 		if r != nil {
 			_ = r.Close()
@@ -189,8 +176,9 @@ func (c GoPackagesClient) GetImportedBy(name string) (ModuleImportedBy, error) {
 	o, err := parseHTMLGoPackageImportedBy(r)
 	if err != nil {
 		return ModuleImportedBy{}, ErrGoPackageClient{
-			StatusCode: 0,
+			StatusCode: http.StatusOK,
 			Msg:        err.Error(),
+			Err:        pipeline.NewError(pipeline.ErrParse, err),
 		}
 	}
 	return o, nil
@@ -241,8 +229,8 @@ type Meta struct {
 }
 
 // GetMeta extracts the module's metadata:
-func (c GoPackagesClient) GetMeta(name string) (Meta, error) {
-	r, err := c.get(name)
+func (c GoPackagesClient) GetMeta(ctx context.Context, name string) (Meta, error) {
+	r, err := c.get(ctx, name)
 	defer func() {
 		if r != nil {
 			_ = r.Close()
@@ -252,135 +240,149 @@ func (c GoPackagesClient) GetMeta(name string) (Meta, error) {
 		return Meta{}, err
 	}
 
-	o, err := parseHTMLGoPackageMain(r)
+	o, err := parseHTMLGoPackageMainWithRules(r, c.Rules)
 	if err != nil {
 		return Meta{}, ErrGoPackageClient{
-			StatusCode: 0,
+			StatusCode: http.StatusOK,
 			Msg:        err.Error(),
+			Err:        pipeline.NewError(pipeline.ErrParse, err),
 		}
 	}
 	return o, nil
 }
 
+// defaultRules the rules shipped with the app, they are parsed once.
+var defaultRules = DefaultRules()
+
 func parseHTMLGoPackageMain(r io.ReadCloser) (Meta, error) {
+	return parseHTMLGoPackageMainWithRules(r, defaultRules)
+}
+
+func parseHTMLGoPackageMainWithRules(r io.ReadCloser, rules *Ruleset) (Meta, error) {
+	if rules == nil {
+		rules = defaultRules
+	}
+
 	doc, err := html.Parse(r)
 	if err != nil {
 		return Meta{}, err
 	}
 
-	var (
-		o              Meta
-		f              func(*html.Node)
-		cntFlagSummary uint8
-	)
+	return rules.Apply(doc)
+}
+
+func (c GoPackagesClient) get(ctx context.Context, route string) (io.ReadCloser, error) {
+	const URL = "https://pkg.go.dev"
 
-	extractFlagFromSummary := func(n *html.Node) bool {
-		if n.NextSibling.Data == "img" {
-			for _, a := range n.NextSibling.Attr {
-				if a.Key == "alt" {
-					return a.Val == "checked"
+	var body io.ReadCloser
+
+	err := c.retry.Do(
+		ctx, func(ctx context.Context) error {
+			if c.RateLimiter != nil {
+				if err := c.RateLimiter.Wait(ctx); err != nil {
+					return ErrGoPackageClient{
+						Msg: err.Error(),
+						Err: err,
+					}
 				}
 			}
-		}
-		return false
-	}
 
-	f = func(n *html.Node) {
-		if n.Type == html.ElementNode {
-			switch n.Data {
-			case "a":
-				for _, a := range n.Attr {
-					if a.Key == "data-test-id" && a.Val == "UnitHeader-license" {
-						o.License = n.LastChild.Data
-					}
-					if a.Key == "href" && a.Val == "?tab=versions" {
-						o.Version = "v" + strings.Split(n.LastChild.Data, "v")[1]
-					}
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, URL+"/"+route, nil)
+			if err != nil {
+				return ErrGoPackageClient{
+					Msg: err.Error(),
+					Err: err,
 				}
-			case "span":
-				for _, a := range n.Attr {
-					if a.Key == "class" {
-						if a.Val == "go-Chip DetailsHeader-span--latest" {
-							o.IsLatestVersion = n.LastChild.Data == "Latest"
-						}
-						if a.Val == "go-Chip go-Chip--inverted" && n.LastChild.Data == "module" {
-							o.IsModule = true
-						}
-					}
+			}
+
+			res, err := c.HTTPClient.Do(req)
+			if err != nil {
+				errRes := ErrGoPackageClient{
+					Msg: err.Error(),
+					Err: pipeline.NewError(pipeline.ErrTransport, err),
 				}
-			case "summary":
-				for _, a := range n.Attr {
-					if a.Key == "class" && a.Val == "go-textSubtle" {
-						switch cntFlagSummary {
-						case 0:
-							o.IsValidGoMod = extractFlagFromSummary(n.FirstChild)
-						case 1:
-							o.WithRedistributableLicense = extractFlagFromSummary(n.FirstChild)
-						case 2:
-							o.IsTaggedVersion = extractFlagFromSummary(n.FirstChild)
-						case 3:
-							o.IsStableVersion = extractFlagFromSummary(n.FirstChild)
-						}
-						cntFlagSummary++
-					}
+				if ctx.Err() != nil {
+					return errRes
 				}
-			case "div":
-				for _, a := range n.Attr {
-					if a.Key == "class" && a.Val == "UnitMeta-repo" {
-						if n.FirstChild.NextSibling != nil {
-							for _, aa := range n.FirstChild.NextSibling.Attr {
-								if aa.Key == "href" {
-									o.Repository = aa.Val
-								}
-							}
-						}
-					}
+				return retry.Retryable(errRes)
+			}
+
+			// every fetched body is archived, including the error responses;
+			// the archive is optional, so its failure must not fail the extraction
+			if c.Archive != nil && res.Body != nil {
+				b, err := io.ReadAll(res.Body)
+				_ = res.Body.Close()
+				if err != nil {
+					return retry.Retryable(
+						ErrGoPackageClient{
+							StatusCode: res.StatusCode,
+							Msg:        err.Error(),
+							Err:        pipeline.NewError(pipeline.ErrTransport, err),
+						},
+					)
 				}
+
+				if err := c.Archive.Put(ctx, NewPageRef(req.URL.String(), res.StatusCode, b, time.Now()), b); err != nil {
+					log.Printf("error archiving %s: %v", req.URL.String(), err)
+				}
+
+				res.Body = io.NopCloser(bytes.NewReader(b))
 			}
-		}
 
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			f(c)
-		}
-	}
+			if res.StatusCode <= 209 {
+				body = res.Body
+				return nil
+			}
 
-	f(doc)
+			errRes := ErrGoPackageClient{
+				StatusCode: res.StatusCode,
+				Msg:        res.Status,
+				Err:        pipeline.HTTPStatusError(res.StatusCode, res.Status),
+			}
 
-	return o, nil
-}
+			// the statuses are classified the same way as for index.golang.org
+			if retry.IsRetryableStatus(res.StatusCode) {
+				if res.Body != nil {
+					_ = res.Body.Close()
+				}
+				retryAfter, ok := pipeline.ParseRetryAfter(res.Header.Get("Retry-After"), time.Now())
+				switch {
+				case ok && c.RateLimiter != nil:
+					// the host asks all clients to pause
+					c.RateLimiter.Pause(retryAfter)
+				case ok:
+					return retry.After(errRes, retryAfter)
+				}
+				return retry.Retryable(errRes)
+			}
 
-func (c GoPackagesClient) get(route string) (io.ReadCloser, error) {
-	const URL = "https://pkg.go.dev"
+			body = res.Body
+			return errRes
+		},
+	)
 
-	if err := c.backoff.Sleep(route); err != nil {
-		return nil, ErrGoPackageClient{
-			StatusCode: 0,
-			Msg:        err.Error(),
+	// the error unwraps to the last attempt's error to classify the failure
+	if errors.Is(err, pipeline.ErrBackoffExhausted) {
+		o := ErrGoPackageClient{
+			Msg: err.Error(),
+			Err: err,
 		}
-	}
-
-	res, err := c.HTTPClient.Get(URL + "/" + route)
-	if err != nil {
-		return nil, ErrGoPackageClient{
-			StatusCode: -1,
-			Msg:        err.Error(),
+		var last ErrGoPackageClient
+		if errors.As(err, &last) {
+			o.StatusCode = last.StatusCode
 		}
+		return nil, o
 	}
 
-	if res.StatusCode > 209 {
-		if res.StatusCode == http.StatusTooManyRequests {
-			c.backoff.Increment(route)
-			return c.get(route)
-		}
-
-		c.backoff.Reset(route)
-
-		return res.Body, ErrGoPackageClient{
-			StatusCode: res.StatusCode,
-			Msg:        res.Status,
+	// the context is done while waiting for the next attempt
+	if err != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+		if _, ok := err.(ErrGoPackageClient); !ok {
+			return nil, ErrGoPackageClient{
+				Msg: err.Error(),
+				Err: err,
+			}
 		}
 	}
 
-	c.backoff.Reset(route)
-	return res.Body, nil
+	return body, err
 }
@@ -2,14 +2,19 @@ package dataextraction
 
 import (
 	"bytes"
+	"context"
 	"embed"
+	"errors"
 	"io"
 	"io/fs"
 	"net/http"
-	"net/url"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/kislerdm/gomodanalysis/app/pipeline"
+	"github.com/kislerdm/gomodanalysis/app/pipeline/retry"
 )
 
 //go:embed fixtures
@@ -17,12 +22,13 @@ var fixtures embed.FS
 
 type mockHTTP struct{}
 
-func (c mockHTTP) Get(s string) (*http.Response, error) {
-	u, err := url.Parse(s)
-	if err != nil {
+func (c mockHTTP) Do(req *http.Request) (*http.Response, error) {
+	if err := req.Context().Err(); err != nil {
 		return nil, err
 	}
 
+	u := req.URL
+
 	p := "main"
 	if len(u.Query()["tab"]) > 0 {
 		p = u.Query()["tab"][0]
@@ -35,6 +41,15 @@ func (c mockHTTP) Get(s string) (*http.Response, error) {
 		}, nil
 	}
 
+	if len(u.Query()["mimic_503"]) > 0 {
+		return &http.Response{
+			Status:     "Mimic Service Unavailable",
+			StatusCode: http.StatusServiceUnavailable,
+			Header:     http.Header{"Retry-After": []string{"0"}},
+			Body:       io.NopCloser(strings.NewReader("")),
+		}, nil
+	}
+
 	b, err := fixtures.ReadFile("fixtures" + u.Path + "/" + p + ".html")
 	switch err.(type) {
 	case nil:
@@ -127,12 +142,21 @@ func TestGoPackagesClient_get(t *testing.T) {
 			want:    nil,
 			wantErr: true,
 		},
+		{
+			name:   "unhappy path: 503 with Retry-After",
+			fields: fields{HTTPClient: &mockHTTP{}, maxBackoffSec: 1},
+			args: args{
+				route: "?mimic_503",
+			},
+			want:    nil,
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(
 			tt.name, func(t *testing.T) {
 				c := NewGoPackagesClient(tt.fields.HTTPClient, tt.fields.maxBackoffSec)
-				got, err := c.get(tt.args.route)
+				got, err := c.get(context.TODO(), tt.args.route)
 				if (err != nil) != tt.wantErr {
 					t.Errorf("get() error = %v, wantErr %v", err, tt.wantErr)
 					return
@@ -225,7 +249,7 @@ func TestGoPackagesClient_GetImportedBy(t *testing.T) {
 		t.Run(
 			tt.name, func(t *testing.T) {
 				c := NewGoPackagesClient(tt.fields.HTTPClient, tt.fields.maxBackoffSec)
-				got, err := c.GetImportedBy(tt.args.name)
+				got, err := c.GetImportedBy(context.TODO(), tt.args.name)
 				if (err != nil) != tt.wantErr {
 					t.Errorf("GetImportedBy() error = %v, wantErr %v", err, tt.wantErr)
 					return
@@ -438,7 +462,7 @@ func TestGoPackagesClient_GetImports(t *testing.T) {
 		t.Run(
 			tt.name, func(t *testing.T) {
 				c := NewGoPackagesClient(tt.fields.HTTPClient, tt.fields.maxBackoffSec)
-				got, err := c.GetImports(tt.args.name)
+				got, err := c.GetImports(context.TODO(), tt.args.name)
 				if (err != nil) != tt.wantErr {
 					t.Errorf("GetImports() error = %v, wantErr %v", err, tt.wantErr)
 					return
@@ -551,7 +575,7 @@ func TestGoPackagesClient_GetMeta(t *testing.T) {
 		t.Run(
 			tt.name, func(t *testing.T) {
 				c := NewGoPackagesClient(tt.fields.HTTPClient, tt.fields.maxBackoffSec)
-				got, err := c.GetMeta(tt.args.name)
+				got, err := c.GetMeta(context.TODO(), tt.args.name)
 				if (err != nil) != tt.wantErr {
 					t.Errorf("GetMeta() error = %v, wantErr %v", err, tt.wantErr)
 					return
@@ -563,3 +587,159 @@ func TestGoPackagesClient_GetMeta(t *testing.T) {
 		)
 	}
 }
+
+func TestGoPackagesClient_getCancelled(t *testing.T) {
+	c := NewGoPackagesClient(mockHTTP{}, 30)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	defer cancel()
+
+	t0 := time.Now()
+	_, err := c.get(ctx, "?mimic_429")
+	if err == nil {
+		t.Errorf("get() error expected")
+		return
+	}
+	if _, ok := err.(ErrGoPackageClient); !ok {
+		t.Errorf("get() unexpected error type %T", err)
+	}
+	if time.Since(t0) > time.Second {
+		t.Errorf("get() shall return once the context is done")
+	}
+}
+
+type httpFunc func(req *http.Request) (*http.Response, error)
+
+func (f httpFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestGoPackagesClient_errors(t *testing.T) {
+	respond := func(code int, body string) HttpClient {
+		return httpFunc(
+			func(req *http.Request) (*http.Response, error) {
+				return &http.Response{
+					Status:     http.StatusText(code),
+					StatusCode: code,
+					Body:       io.NopCloser(strings.NewReader(body)),
+				}, nil
+			},
+		)
+	}
+
+	tests := []struct {
+		name       string
+		httpClient HttpClient
+		wantErrIs  []error
+		wantStatus SectionStatus
+	}{
+		{
+			name:       "not found",
+			httpClient: respond(http.StatusNotFound, "not found"),
+			wantErrIs:  []error{pipeline.ErrNotFound},
+			wantStatus: StatusNotFound,
+		},
+		{
+			name:       "rate limited",
+			httpClient: respond(http.StatusTooManyRequests, ""),
+			wantErrIs:  []error{pipeline.ErrRateLimited, pipeline.ErrBackoffExhausted},
+			wantStatus: StatusRateLimited,
+		},
+		{
+			name:       "server error",
+			httpClient: respond(http.StatusBadGateway, ""),
+			wantErrIs:  []error{pipeline.ErrBackoffExhausted},
+			wantStatus: StatusError,
+		},
+		{
+			name:       "parse error",
+			httpClient: respond(http.StatusOK, "<html></html>"),
+			wantErrIs:  []error{pipeline.ErrParse},
+			wantStatus: StatusParseError,
+		},
+		{
+			name: "transport error",
+			httpClient: httpFunc(
+				func(req *http.Request) (*http.Response, error) {
+					return nil, errors.New("connection reset")
+				},
+			),
+			wantErrIs:  []error{pipeline.ErrTransport, pipeline.ErrBackoffExhausted},
+			wantStatus: StatusError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				c := NewGoPackagesClient(tt.httpClient, 0)
+
+				_, err := c.GetImports(context.TODO(), "foo")
+				for _, target := range tt.wantErrIs {
+					if !errors.Is(err, target) {
+						t.Errorf("GetImports() error = %v, must match %v", err, target)
+					}
+				}
+
+				var e ErrGoPackageClient
+				if !errors.As(err, &e) {
+					t.Errorf("GetImports() error = %v, must be ErrGoPackageClient", err)
+				}
+
+				if got := sectionStatus(context.TODO(), err); got != tt.wantStatus {
+					t.Errorf("sectionStatus() = %v, want %v", got, tt.wantStatus)
+				}
+			},
+		)
+	}
+}
+
+func TestGoPackagesClient_getRetriesServerErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		code int
+	}{
+		{name: "500", code: http.StatusInternalServerError},
+		{name: "502", code: http.StatusBadGateway},
+		{name: "503 without Retry-After", code: http.StatusServiceUnavailable},
+		{name: "504", code: http.StatusGatewayTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				var attempts int
+				c := NewGoPackagesClient(
+					httpFunc(
+						func(req *http.Request) (*http.Response, error) {
+							attempts++
+							if attempts == 1 {
+								return &http.Response{
+									Status:     http.StatusText(tt.code),
+									StatusCode: tt.code,
+									Body:       io.NopCloser(strings.NewReader("")),
+								}, nil
+							}
+							return &http.Response{
+								Status:     "OK",
+								StatusCode: http.StatusOK,
+								Body:       io.NopCloser(strings.NewReader("ok")),
+							}, nil
+						},
+					), 1,
+				)
+
+				c.retry.Strategy = retry.Linear{Step: time.Millisecond}
+
+				got, err := c.get(context.TODO(), "foo")
+				if err != nil {
+					t.Fatalf("get() unexpected error = %v", err)
+				}
+				if b, _ := io.ReadAll(got); string(b) != "ok" {
+					t.Errorf("get() got = %s, want ok", b)
+				}
+				if attempts != 2 {
+					t.Errorf("get() attempts = %d, want 2", attempts)
+				}
+			},
+		)
+	}
+}
@@ -3,44 +3,376 @@ package dataextraction
 import (
 	"context"
 	"errors"
-	"os"
 	"strconv"
+	"time"
 
 	"github.com/kislerdm/gomodanalysis/app/pipeline"
 )
 
 type Module struct {
-	Name, Version string
+	Name    string `bigquery:"path"`
+	Version string `bigquery:"version"`
+}
+
+// String returns the module identifier in the form {{name}}@{{version}}, or {{name}} if version is not set.
+func (m Module) String() string {
+	if m.Version == "" {
+		return m.Name
+	}
+	return m.Name + "@" + m.Version
+}
+
+// FetchMode defines which modules' versions to select for extraction.
+type FetchMode string
+
+const (
+	// FetchModeDefault selects the paths never extracted before, the default page is fetched for every path.
+	FetchModeDefault FetchMode = "default"
+
+	// FetchModeFirstLast selects the earliest and the latest versions of every path from the index_stat view.
+	// The extraction state is tracked per (path, version) pair.
+	FetchModeFirstLast FetchMode = "firstlast"
+)
+
+// NewFetchMode parses the fetch mode, the empty string yields FetchModeDefault.
+func NewFetchMode(s string) (FetchMode, error) {
+	switch FetchMode(s) {
+	case "", FetchModeDefault:
+		return FetchModeDefault, nil
+	case FetchModeFirstLast:
+		return FetchModeFirstLast, nil
+	default:
+		return "", errors.New("unknown fetch mode " + s)
+	}
+}
+
+// RefreshPolicy defines when the modules extracted before shall be re-extracted.
+type RefreshPolicy struct {
+	// NewVersion re-selects the modules which have a version in the index newer than the stored one.
+	// It is only applicable to FetchModeDefault, because FetchModeFirstLast tracks every version separately.
+	NewVersion bool
+
+	// MaxAge re-selects the modules extracted earlier than MaxAge ago. Zero value disables the check.
+	MaxAge time.Duration
+
+	// StaleShare defines the share of the budget reserved for stale modules, it shall be within [0, 1].
+	// New modules take the rest of the budget, the unused quota of either group is given to the other.
+	StaleShare float64
+}
+
+// IsEnabled returns true if any refresh condition is set.
+func (p RefreshPolicy) IsEnabled() bool {
+	return p.NewVersion || p.MaxAge > 0
+}
+
+// NewRefreshPolicy parses the refresh policy from the env variables' values.
+// Empty strings are treated as unset values.
+func NewRefreshPolicy(newVersion, maxAge, staleShare string) (RefreshPolicy, error) {
+	var (
+		o   RefreshPolicy
+		err error
+	)
+
+	if newVersion != "" {
+		if o.NewVersion, err = strconv.ParseBool(newVersion); err != nil {
+			return RefreshPolicy{}, errors.New("faulty refresh new version flag: " + err.Error())
+		}
+	}
+
+	if maxAge != "" {
+		if o.MaxAge, err = time.ParseDuration(maxAge); err != nil {
+			return RefreshPolicy{}, errors.New("faulty refresh max age: " + err.Error())
+		}
+		if o.MaxAge < 0 {
+			return RefreshPolicy{}, errors.New("faulty refresh max age: negative duration")
+		}
+	}
+
+	if staleShare != "" {
+		if o.StaleShare, err = strconv.ParseFloat(staleShare, 64); err != nil {
+			return RefreshPolicy{}, errors.New("faulty refresh stale share: " + err.Error())
+		}
+		if o.StaleShare < 0 || o.StaleShare > 1 {
+			return RefreshPolicy{}, errors.New("faulty refresh stale share: must be within [0, 1]")
+		}
+	}
+
+	return o, nil
+}
+
+// ListConfig configuration to select modules to fetch.
+type ListConfig struct {
+	Mode    FetchMode
+	Refresh RefreshPolicy
+
+	// Priority defines the order of the modules never extracted before.
+	// The modules to re-extract are ordered by the time of the last extraction.
+	Priority PriorityConfig
+
+	// Warehouse the location of the index and the extracted data.
+	Warehouse pipeline.Warehouse
+
+	// Limit the max number of modules to select, defaults to 1000.
+	Limit int
+}
+
+func queryModulesToFetch(wh pipeline.Warehouse, mode FetchMode) string {
+	switch mode {
+	case FetchModeFirstLast:
+		return "SELECT a.path, a.version FROM (" + queryFirstLastVersions(wh) + ") AS a " +
+			"LEFT JOIN " + wh.Table(pipeline.TablePkgGoDev).ID() + " AS b USING (path, version) " +
+			"WHERE b.path IS NULL LIMIT @limit;"
+	default:
+		return "SELECT DISTINCT a.path " +
+			"FROM " + wh.Table(pipeline.TableIndex).ID() + " AS a " +
+			"LEFT JOIN " + wh.Table(pipeline.TablePkgGoDev).ID() + " AS b USING (path) " +
+			"WHERE b.path IS NULL LIMIT @limit;"
+	}
+}
+
+func queryFirstLastVersions(wh pipeline.Warehouse) string {
+	indexStat := wh.Table(pipeline.TableIndexStat).ID()
+	return "SELECT path, earliest AS version FROM " + indexStat + " " +
+		"UNION DISTINCT " +
+		"SELECT path, latest AS version FROM " + indexStat
+}
+
+// queryCandidatesToFetch defines the query to select the modules never extracted before
+// together with the attributes required to prioritise extraction.
+func queryCandidatesToFetch(wh pipeline.Warehouse, mode FetchMode, p PriorityConfig) (string, []pipeline.QueryParam) {
+	var (
+		indexStat = wh.Table(pipeline.TableIndexStat).ID()
+		pkgGoDev  = wh.Table(pipeline.TablePkgGoDev).ID()
+	)
+
+	queryImportedBy := queryImportedByModule(wh)
+
+	var q string
+	switch mode {
+	case FetchModeFirstLast:
+		q = "WITH imp AS (" + queryImportedBy + "), " +
+			"a AS (" +
+			"SELECT path, earliest AS version, cache_latest, cnt_versions FROM " + indexStat + " " +
+			"UNION DISTINCT " +
+			"SELECT path, latest AS version, cache_latest, cnt_versions FROM " + indexStat + ") " +
+			"SELECT a.path, a.version, a.cache_latest, a.cnt_versions, COALESCE(imp.cnt_importedby, 0) AS cnt_importedby " +
+			"FROM a " +
+			"LEFT JOIN " + pkgGoDev + " AS b USING (path, version) " +
+			"LEFT JOIN imp USING (path) " +
+			"WHERE b.path IS NULL"
+	default:
+		q = "WITH imp AS (" + queryImportedBy + ") " +
+			"SELECT a.path, '' AS version, a.cache_latest, a.cnt_versions, COALESCE(imp.cnt_importedby, 0) AS cnt_importedby " +
+			"FROM " + indexStat + " AS a " +
+			"LEFT JOIN " + pkgGoDev + " AS b USING (path) " +
+			"LEFT JOIN imp USING (path) " +
+			"WHERE b.path IS NULL"
+	}
+
+	poolSize := p.PoolSize
+	if poolSize == 0 {
+		poolSize = DefaultPoolSize
+	}
+
+	var params []pipeline.QueryParam
+	// the watchlist modules shall not be cut off by the pool size
+	if len(p.Watchlist) > 0 {
+		q += " ORDER BY a.path IN UNNEST(@watchlist) DESC"
+		params = append(params, pipeline.QueryParam{Name: "watchlist", Value: p.Watchlist})
+	}
+	q += " LIMIT @pool_size"
+	params = append(params, pipeline.QueryParam{Name: "pool_size", Value: poolSize})
+
+	return q + ";", params
+}
+
+// queryImportedByModule defines the query to count the extracted modules importing the packages of every module.
+// The imported package is attributed to the module with the longest path which is the package's path prefix,
+// e.g. github.com/foo/bar/baz to github.com/foo/bar, so the imports of the module's subpackages are counted.
+func queryImportedByModule(wh pipeline.Warehouse) string {
+	var (
+		indexStat = wh.Table(pipeline.TableIndexStat).ID()
+		pkgGoDev  = wh.Table(pipeline.TablePkgGoDev).ID()
+	)
+
+	// every path prefix of the imported package, e.g. github.com, github.com/foo, github.com/foo/bar
+	queryPrefixes := "SELECT p.path AS importer, i AS pkg, " +
+		"ARRAY_TO_STRING(" +
+		"ARRAY(SELECT el FROM UNNEST(SPLIT(i, '/')) AS el WITH OFFSET o WHERE o < n ORDER BY o), '/'" +
+		") AS prefix " +
+		"FROM " + pkgGoDev + " AS p, UNNEST(p.imports.nonstd) AS i, " +
+		"UNNEST(GENERATE_ARRAY(1, ARRAY_LENGTH(SPLIT(i, '/')))) AS n"
+
+	queryPkgModule := "SELECT pre.importer, pre.pkg, " +
+		"ARRAY_AGG(m.path ORDER BY LENGTH(m.path) DESC LIMIT 1)[OFFSET(0)] AS path " +
+		"FROM (" + queryPrefixes + ") AS pre " +
+		"INNER JOIN (SELECT DISTINCT path FROM " + indexStat + ") AS m ON m.path = pre.prefix " +
+		"GROUP BY pre.importer, pre.pkg"
+
+	return "SELECT path, COUNT(DISTINCT importer) AS cnt_importedby " +
+		"FROM (" + queryPkgModule + ") GROUP BY path"
+}
+
+// queryStaleModules defines the query to select the modules to re-extract, the oldest extractions come first.
+// The rows without the version are ignored: the dead letters retries store only the retried sections,
+// the version is empty unless the main page is retried.
+// It returns the empty string if the policy is disabled.
+func queryStaleModules(wh pipeline.Warehouse, mode FetchMode, p RefreshPolicy) (string, []pipeline.QueryParam) {
+	var (
+		condMaxAge string
+		params     []pipeline.QueryParam
+	)
+	if p.MaxAge > 0 {
+		condMaxAge = "TIMESTAMP_SUB(CURRENT_TIMESTAMP(), INTERVAL @max_age SECOND)"
+		params = append(params, pipeline.QueryParam{Name: "max_age", Value: int64(p.MaxAge.Seconds())})
+	}
+
+	var (
+		index    = wh.Table(pipeline.TableIndex).ID()
+		pkgGoDev = wh.Table(pipeline.TablePkgGoDev).ID()
+	)
+
+	switch mode {
+	case FetchModeFirstLast:
+		if condMaxAge == "" {
+			return "", nil
+		}
+		return "SELECT b.path, b.version FROM (" + queryFirstLastVersions(wh) + ") AS a " +
+			"INNER JOIN " + pkgGoDev + " AS b USING (path, version) " +
+			"GROUP BY b.path, b.version " +
+			"HAVING MAX(b.timestamp) < " + condMaxAge + " " +
+			"ORDER BY MAX(b.timestamp) LIMIT @limit;", params
+
+	default:
+		var cond string
+		if p.NewVersion {
+			// the module stored without the version found in the index, e.g. not found at pkg.go.dev,
+			// has no version to compare with and must not be re-selected on every run
+			cond = "(ver.cache_ts IS NOT NULL AND idx.cache_latest > ver.cache_ts)"
+		}
+		if condMaxAge != "" {
+			if cond != "" {
+				cond += " OR "
+			}
+			cond += "ext.last.timestamp < " + condMaxAge
+		}
+		if cond == "" {
+			return "", nil
+		}
+
+		return "WITH " +
+			"idx AS (SELECT path, MAX(timestamp) AS cache_latest " +
+			"FROM " + index + " GROUP BY path), " +
+			"ver AS (SELECT path, version, MIN(timestamp) AS cache_ts " +
+			"FROM " + index + " GROUP BY path, version), " +
+			"ext AS (SELECT path, ARRAY_AGG(STRUCT(version, timestamp) ORDER BY timestamp DESC LIMIT 1)[OFFSET(0)] AS last " +
+			"FROM " + pkgGoDev + " WHERE version != '' GROUP BY path) " +
+			"SELECT ext.path FROM ext " +
+			"INNER JOIN idx USING (path) " +
+			"LEFT JOIN ver ON ver.path = ext.path AND ver.version = ext.last.version " +
+			"WHERE " + cond + " " +
+			"ORDER BY ext.last.timestamp LIMIT @limit;", params
+	}
 }
 
 // ListModulesToFetch lists modules to extract data for.
-func ListModulesToFetch(ctx context.Context, client pipeline.GBQClient) ([]Module, error) {
-	lim := os.Getenv("LIMIT")
-	if lim == "" {
-		lim = "1000"
+func ListModulesToFetch(ctx context.Context, client pipeline.GBQClient, cfg ListConfig) ([]Module, error) {
+	lim := cfg.Limit
+	switch {
+	case lim == 0:
+		lim = 1000
+	case lim < 0:
+		return nil, errors.New("ListModulesToFetch(): faulty limit " + strconv.Itoa(lim))
 	}
+	paramLimit := pipeline.QueryParam{Name: "limit", Value: lim}
 
-	q := "SELECT DISTINCT a.path " +
-		"FROM `go-mod-analysis.raw.index` AS a " +
-		"LEFT JOIN `go-mod-analysis.raw.pkggodev` AS b USING (path) " +
-		"WHERE b.path IS NULL LIMIT " + lim + ";"
+	var (
+		fresh []Module
+		err   error
+	)
+	if cfg.Priority.IsEnabled() {
+		q, params := queryCandidatesToFetch(cfg.Warehouse, cfg.Mode, cfg.Priority)
+		candidates, err := readCandidates(ctx, client, q, params...)
+		if err != nil {
+			return nil, err
+		}
 
-	r, err := client.Read(ctx, q)
+		fresh = Prioritize(candidates, cfg.Priority, time.Now().UTC())
+		if len(fresh) > lim {
+			fresh = fresh[:lim]
+		}
+	} else {
+		fresh, err = readModules(ctx, client, cfg.Mode, queryModulesToFetch(cfg.Warehouse, cfg.Mode), paramLimit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !cfg.Refresh.IsEnabled() {
+		return fresh, nil
+	}
+
+	q, params := queryStaleModules(cfg.Warehouse, cfg.Mode, cfg.Refresh)
+	if q == "" {
+		return fresh, nil
+	}
+
+	stale, err := readModules(ctx, client, cfg.Mode, q, append(params, paramLimit)...)
 	if err != nil {
 		return nil, err
 	}
 
-	var o []Module
+	return combineWithinBudget(fresh, stale, lim, cfg.Refresh.StaleShare), nil
+}
+
+func readModules(
+	ctx context.Context, client pipeline.GBQClient, mode FetchMode, query string, params ...pipeline.QueryParam,
+) ([]Module, error) {
+	o, err := pipeline.ReadAll[Module](ctx, client, query, params...)
+	if err != nil {
+		return nil, errors.New("ListModulesToFetch(): " + err.Error())
+	}
 
-	for i, row := range r {
-		v, ok := row[0].(string)
-		if !ok {
-			return nil, errors.New("ListModulesToFetch(): cannot parse values of row " + strconv.Itoa(i))
+	for i, m := range o {
+		if mode == FetchModeFirstLast && m.Version == "" {
+			return nil, errors.New("ListModulesToFetch(): version is missing in row " + strconv.Itoa(i))
 		}
-		o = append(
-			o, Module{Name: v},
-		)
 	}
 
 	return o, nil
 }
+
+func readCandidates(
+	ctx context.Context, client pipeline.GBQClient, query string, params ...pipeline.QueryParam,
+) ([]Candidate, error) {
+	// the attributes are nullable, missing values do not contribute to the priority
+	o, err := pipeline.ReadAll[Candidate](ctx, client, query, params...)
+	if err != nil {
+		return nil, errors.New("ListModulesToFetch(): " + err.Error())
+	}
+	return o, nil
+}
+
+// combineWithinBudget merges new and stale modules keeping the total count within the budget.
+// The share of the budget reserved for stale modules is defined by staleShare,
+// the quota unused by either group is given to the other one.
+func combineWithinBudget(fresh, stale []Module, budget int, staleShare float64) []Module {
+	quotaStale := int(float64(budget) * staleShare)
+	if quotaStale > len(stale) {
+		quotaStale = len(stale)
+	}
+
+	nFresh := budget - quotaStale
+	if nFresh > len(fresh) {
+		nFresh = len(fresh)
+	}
+
+	nStale := budget - nFresh
+	if nStale > len(stale) {
+		nStale = len(stale)
+	}
+
+	o := make([]Module, 0, nFresh+nStale)
+	o = append(o, fresh[:nFresh]...)
+	return append(o, stale[:nStale]...)
+}
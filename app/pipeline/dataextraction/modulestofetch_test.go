@@ -0,0 +1,531 @@
+package dataextraction
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kislerdm/gomodanalysis/app/pipeline"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+type mockGBQClient struct {
+	// v results of the consecutive Read, or Iterate calls
+	v []pipeline.DataReader
+	// columns the columns of the results of the consecutive Iterate calls
+	columns [][]string
+	err     error
+	queries []string
+	params  [][]pipeline.QueryParam
+}
+
+func (c *mockGBQClient) Read(_ context.Context, query string, params ...pipeline.QueryParam) (
+	pipeline.DataReader, error,
+) {
+	c.queries = append(c.queries, query)
+	c.params = append(c.params, params)
+	if c.err != nil {
+		return nil, c.err
+	}
+	if len(c.queries) > len(c.v) {
+		return nil, nil
+	}
+	return c.v[len(c.queries)-1], nil
+}
+
+func (c *mockGBQClient) Iterate(ctx context.Context, query string, params ...pipeline.QueryParam) (
+	pipeline.Rows, error,
+) {
+	r, err := c.Read(ctx, query, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	var columns []string
+	if len(c.queries) <= len(c.columns) {
+		columns = c.columns[len(c.queries)-1]
+	}
+	return pipeline.NewRows(columns, r), nil
+}
+
+func (c *mockGBQClient) Write(_ context.Context, _ pipeline.DataWriter, _ string) error {
+	return nil
+}
+
+func (c *mockGBQClient) OpenStream(_ context.Context, _ string, _ *descriptorpb.DescriptorProto) (
+	pipeline.Stream, error,
+) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *mockGBQClient) Close() error {
+	return nil
+}
+
+func TestListModulesToFetch(t *testing.T) {
+	type args struct {
+		client *mockGBQClient
+		cfg    ListConfig
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []Module
+		wantErr bool
+	}{
+		{
+			name: "happy path: default",
+			args: args{
+				client: &mockGBQClient{
+					v:       []pipeline.DataReader{{{"foo"}, {"bar"}}},
+					columns: [][]string{{"path"}},
+				},
+				cfg: ListConfig{Mode: FetchModeDefault},
+			},
+			want:    []Module{{Name: "foo"}, {Name: "bar"}},
+			wantErr: false,
+		},
+		{
+			name: "happy path: first and last versions",
+			args: args{
+				client: &mockGBQClient{
+					v:       []pipeline.DataReader{{{"foo", "v0.1.0"}, {"foo", "v1.2.0"}, {"bar", "v0.0.1"}}},
+					columns: [][]string{{"path", "version"}},
+				},
+				cfg: ListConfig{Mode: FetchModeFirstLast},
+			},
+			want: []Module{
+				{Name: "foo", Version: "v0.1.0"},
+				{Name: "foo", Version: "v1.2.0"},
+				{Name: "bar", Version: "v0.0.1"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "happy path: new and stale modules",
+			args: args{
+				client: &mockGBQClient{
+					v:       []pipeline.DataReader{{{"foo"}, {"bar"}}, {{"baz"}}},
+					columns: [][]string{{"path"}, {"path"}},
+				},
+				cfg: ListConfig{
+					Mode:    FetchModeDefault,
+					Refresh: RefreshPolicy{NewVersion: true},
+				},
+			},
+			want:    []Module{{Name: "foo"}, {Name: "bar"}, {Name: "baz"}},
+			wantErr: false,
+		},
+		{
+			name: "happy path: new version refresh is not applicable for first and last versions",
+			args: args{
+				client: &mockGBQClient{
+					v:       []pipeline.DataReader{{{"foo", "v0.1.0"}}, {{"bar", "v0.0.1"}}},
+					columns: [][]string{{"path", "version"}, {"path", "version"}},
+				},
+				cfg: ListConfig{
+					Mode:    FetchModeFirstLast,
+					Refresh: RefreshPolicy{NewVersion: true},
+				},
+			},
+			want:    []Module{{Name: "foo", Version: "v0.1.0"}},
+			wantErr: false,
+		},
+		{
+			name: "happy path: prioritised",
+			args: args{
+				client: &mockGBQClient{
+					v: []pipeline.DataReader{
+						{
+							{"foo", "", time.Now().Add(-720 * time.Hour), int64(3), int64(0)},
+							{"bar", "", time.Now(), int64(1), nil},
+						},
+					},
+					columns: [][]string{{"path", "version", "cache_latest", "cnt_versions", "cnt_importedby"}},
+				},
+				cfg: ListConfig{
+					Mode:     FetchModeDefault,
+					Priority: PriorityConfig{Recency: 1},
+				},
+			},
+			want:    []Module{{Name: "bar"}, {Name: "foo"}},
+			wantErr: false,
+		},
+		{
+			name: "unhappy path: version is missing",
+			args: args{
+				client: &mockGBQClient{
+					v:       []pipeline.DataReader{{{"foo"}}},
+					columns: [][]string{{"path"}},
+				},
+				cfg: ListConfig{Mode: FetchModeFirstLast},
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "unhappy path: faulty path type",
+			args: args{
+				client: &mockGBQClient{
+					v:       []pipeline.DataReader{{{1}}},
+					columns: [][]string{{"path"}},
+				},
+				cfg: ListConfig{Mode: FetchModeDefault},
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "unhappy path: read error",
+			args: args{
+				client: &mockGBQClient{err: errors.New("foo")},
+				cfg:    ListConfig{Mode: FetchModeDefault},
+			},
+			want:    nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got, err := ListModulesToFetch(context.TODO(), tt.args.client, tt.args.cfg)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("ListModulesToFetch() error = %v, wantErr %v", err, tt.wantErr)
+					return
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("ListModulesToFetch() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestListModulesToFetch_queries(t *testing.T) {
+	wh := pipeline.Warehouse{
+		ProjectID: "p",
+		Dataset:   "d",
+		Tables: map[string]pipeline.TableRef{
+			pipeline.TablePkgGoDev: {ProjectID: "p", Dataset: "dev", Table: "pkggodev"},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		cfg        ListConfig
+		wantTables []string
+		wantParams [][]pipeline.QueryParam
+	}{
+		{
+			name:       "default",
+			cfg:        ListConfig{Mode: FetchModeDefault, Warehouse: wh, Limit: 10},
+			wantTables: []string{"`p.d.index`", "`p.dev.pkggodev`"},
+			wantParams: [][]pipeline.QueryParam{{{Name: "limit", Value: 10}}},
+		},
+		{
+			name:       "first and last versions with default limit",
+			cfg:        ListConfig{Mode: FetchModeFirstLast, Warehouse: wh},
+			wantTables: []string{"`p.d.index_stat`", "`p.dev.pkggodev`"},
+			wantParams: [][]pipeline.QueryParam{{{Name: "limit", Value: 1000}}},
+		},
+		{
+			name: "prioritised and stale",
+			cfg: ListConfig{
+				Mode:      FetchModeDefault,
+				Warehouse: wh,
+				Limit:     10,
+				Priority:  PriorityConfig{Recency: 1, PoolSize: 100, Watchlist: []string{"foo"}},
+				Refresh:   RefreshPolicy{MaxAge: time.Hour},
+			},
+			wantTables: []string{"`p.d.index_stat`", "`p.d.index`", "`p.dev.pkggodev`"},
+			wantParams: [][]pipeline.QueryParam{
+				{{Name: "watchlist", Value: []string{"foo"}}, {Name: "pool_size", Value: 100}},
+				{{Name: "max_age", Value: int64(3600)}, {Name: "limit", Value: 10}},
+			},
+		},
+		{
+			name: "prioritised with default pool size",
+			cfg: ListConfig{
+				Mode:      FetchModeDefault,
+				Warehouse: wh,
+				Limit:     10,
+				Priority:  PriorityConfig{Recency: 1},
+			},
+			wantTables: []string{"`p.d.index_stat`", "`p.dev.pkggodev`"},
+			wantParams: [][]pipeline.QueryParam{{{Name: "pool_size", Value: DefaultPoolSize}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				client := &mockGBQClient{}
+				if _, err := ListModulesToFetch(context.TODO(), client, tt.cfg); err != nil {
+					t.Fatalf("ListModulesToFetch() unexpected error = %v", err)
+				}
+
+				queries := strings.Join(client.queries, " ")
+				for _, table := range tt.wantTables {
+					if !strings.Contains(queries, table) {
+						t.Errorf("ListModulesToFetch() table %v is not queried: %v", table, queries)
+					}
+				}
+				if strings.Contains(queries, "go-mod-analysis") {
+					t.Errorf("ListModulesToFetch() queries the hardcoded table: %v", queries)
+				}
+
+				if !reflect.DeepEqual(client.params, tt.wantParams) {
+					t.Errorf("ListModulesToFetch() params = %v, want %v", client.params, tt.wantParams)
+				}
+			},
+		)
+	}
+}
+
+func Test_queryImportedByModule(t *testing.T) {
+	got := queryImportedByModule(pipeline.Warehouse{ProjectID: "p", Dataset: "d"})
+
+	for _, s := range []string{
+		// the imported packages are split to their path prefixes
+		"FROM `p.d.pkggodev` AS p, UNNEST(p.imports.nonstd) AS i, " +
+			"UNNEST(GENERATE_ARRAY(1, ARRAY_LENGTH(SPLIT(i, '/')))) AS n",
+		// the prefixes are matched against the modules in the index
+		"INNER JOIN (SELECT DISTINCT path FROM `p.d.index_stat`) AS m ON m.path = pre.prefix",
+		// the package belongs to the module with the longest matching path
+		"ARRAY_AGG(m.path ORDER BY LENGTH(m.path) DESC LIMIT 1)[OFFSET(0)] AS path",
+		"COUNT(DISTINCT importer) AS cnt_importedby",
+	} {
+		if !strings.Contains(got, s) {
+			t.Errorf("queryImportedByModule() = %v, want it to contain %v", got, s)
+		}
+	}
+}
+
+func Test_queryStaleModules(t *testing.T) {
+	wh := pipeline.Warehouse{ProjectID: "p", Dataset: "d"}
+
+	tests := []struct {
+		name           string
+		policy         RefreshPolicy
+		wantContains   []string
+		wantNotContain []string
+	}{
+		{
+			name:   "new version: the module stored as not found is not re-selected",
+			policy: RefreshPolicy{NewVersion: true},
+			wantContains: []string{
+				"LEFT JOIN ver ON ver.path = ext.path AND ver.version = ext.last.version",
+				"WHERE (ver.cache_ts IS NOT NULL AND idx.cache_latest > ver.cache_ts) ",
+			},
+			wantNotContain: []string{"COALESCE(ver.cache_ts"},
+		},
+		{
+			name:   "new version or max age",
+			policy: RefreshPolicy{NewVersion: true, MaxAge: time.Hour},
+			wantContains: []string{
+				"WHERE (ver.cache_ts IS NOT NULL AND idx.cache_latest > ver.cache_ts) OR ext.last.timestamp < ",
+			},
+		},
+		{
+			name:   "max age: the dead letters retries without the version are ignored",
+			policy: RefreshPolicy{MaxAge: time.Hour},
+			wantContains: []string{
+				"FROM `p.d.pkggodev` WHERE version != '' GROUP BY path) ",
+				"WHERE ext.last.timestamp < ",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got, _ := queryStaleModules(wh, FetchModeDefault, tt.policy)
+				for _, s := range tt.wantContains {
+					if !strings.Contains(got, s) {
+						t.Errorf("queryStaleModules() = %v, want it to contain %v", got, s)
+					}
+				}
+				for _, s := range tt.wantNotContain {
+					if strings.Contains(got, s) {
+						t.Errorf("queryStaleModules() = %v, want it not to contain %v", got, s)
+					}
+				}
+			},
+		)
+	}
+}
+
+func TestNewFetchMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    FetchMode
+		wantErr bool
+	}{
+		{
+			name:    "empty string",
+			s:       "",
+			want:    FetchModeDefault,
+			wantErr: false,
+		},
+		{
+			name:    "firstlast",
+			s:       "firstlast",
+			want:    FetchModeFirstLast,
+			wantErr: false,
+		},
+		{
+			name:    "unknown",
+			s:       "foo",
+			want:    "",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got, err := NewFetchMode(tt.s)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("NewFetchMode() error = %v, wantErr %v", err, tt.wantErr)
+					return
+				}
+				if got != tt.want {
+					t.Errorf("NewFetchMode() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestNewRefreshPolicy(t *testing.T) {
+	type args struct {
+		newVersion, maxAge, staleShare string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    RefreshPolicy
+		wantErr bool
+	}{
+		{
+			name:    "happy path: disabled",
+			args:    args{},
+			want:    RefreshPolicy{},
+			wantErr: false,
+		},
+		{
+			name: "happy path: all set",
+			args: args{newVersion: "true", maxAge: "720h", staleShare: "0.2"},
+			want: RefreshPolicy{
+				NewVersion: true,
+				MaxAge:     720 * time.Hour,
+				StaleShare: 0.2,
+			},
+			wantErr: false,
+		},
+		{
+			name:    "unhappy path: faulty flag",
+			args:    args{newVersion: "foo"},
+			want:    RefreshPolicy{},
+			wantErr: true,
+		},
+		{
+			name:    "unhappy path: negative max age",
+			args:    args{maxAge: "-1h"},
+			want:    RefreshPolicy{},
+			wantErr: true,
+		},
+		{
+			name:    "unhappy path: share above one",
+			args:    args{staleShare: "1.1"},
+			want:    RefreshPolicy{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got, err := NewRefreshPolicy(tt.args.newVersion, tt.args.maxAge, tt.args.staleShare)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("NewRefreshPolicy() error = %v, wantErr %v", err, tt.wantErr)
+					return
+				}
+				if got != tt.want {
+					t.Errorf("NewRefreshPolicy() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func Test_combineWithinBudget(t *testing.T) {
+	modules := func(names ...string) []Module {
+		o := make([]Module, len(names))
+		for i, n := range names {
+			o[i] = Module{Name: n}
+		}
+		return o
+	}
+
+	type args struct {
+		fresh, stale []Module
+		budget       int
+		staleShare   float64
+	}
+	tests := []struct {
+		name string
+		args args
+		want []Module
+	}{
+		{
+			name: "new modules first",
+			args: args{
+				fresh:  modules("a", "b", "c"),
+				stale:  modules("x", "y"),
+				budget: 4,
+			},
+			want: modules("a", "b", "c", "x"),
+		},
+		{
+			name: "stale quota is reserved",
+			args: args{
+				fresh:      modules("a", "b", "c"),
+				stale:      modules("x", "y"),
+				budget:     4,
+				staleShare: 0.5,
+			},
+			want: modules("a", "b", "x", "y"),
+		},
+		{
+			name: "unused stale quota is given to new modules",
+			args: args{
+				fresh:      modules("a", "b", "c"),
+				stale:      modules("x"),
+				budget:     4,
+				staleShare: 0.5,
+			},
+			want: modules("a", "b", "c", "x"),
+		},
+		{
+			name: "unused new quota is given to stale modules",
+			args: args{
+				fresh:      modules("a"),
+				stale:      modules("x", "y", "z"),
+				budget:     3,
+				staleShare: 0.1,
+			},
+			want: modules("a", "x", "y"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got := combineWithinBudget(tt.args.fresh, tt.args.stale, tt.args.budget, tt.args.staleShare)
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("combineWithinBudget() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
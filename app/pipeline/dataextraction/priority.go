@@ -0,0 +1,173 @@
+package dataextraction
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Candidate module to fetch with the attributes used to prioritise extraction.
+type Candidate struct {
+	Module
+
+	// LastRelease the time the latest version was cached by proxy.golang.org.
+	LastRelease time.Time `bigquery:"cache_latest"`
+
+	// CntVersions the number of module's versions in the index.
+	CntVersions int64 `bigquery:"cnt_versions"`
+
+	// CntImportedBy the number of extracted modules known to import the module.
+	CntImportedBy int64 `bigquery:"cnt_importedby"`
+}
+
+// PriorityConfig defines the order in which the modules are extracted.
+// The modules from the watchlist come first in the order of the list,
+// the rest is ordered by the weighted sum of the scores within [0, 1]:
+//   - recency of the last release, it is halved after 30 days since the release;
+//   - number of versions, log-scaled relatively to the max count among candidates;
+//   - number of known importers, log-scaled relatively to the max count among candidates.
+type PriorityConfig struct {
+	Recency    float64
+	Versions   float64
+	ImportedBy float64
+
+	Watchlist []string
+
+	// PoolSize the max number of candidates to rank, defaults to DefaultPoolSize.
+	PoolSize int
+}
+
+// DefaultPoolSize the default max number of candidates to rank, the candidates are read into memory to be ranked.
+const DefaultPoolSize = 100000
+
+// IsEnabled returns true if any priority criteria is set.
+func (p PriorityConfig) IsEnabled() bool {
+	return p.Recency > 0 || p.Versions > 0 || p.ImportedBy > 0 || len(p.Watchlist) > 0
+}
+
+// NewPriorityConfig parses the priority configuration from the env variables' values:
+//   - weights: comma separated key=value pairs, the keys are recency, versions and importedby;
+//   - watchlist: comma separated modules' paths;
+//   - poolSize: integer.
+//
+// Empty strings are treated as unset values.
+func NewPriorityConfig(weights, watchlist, poolSize string) (PriorityConfig, error) {
+	var o PriorityConfig
+
+	if weights != "" {
+		for _, kv := range strings.Split(weights, ",") {
+			k, v, ok := strings.Cut(strings.TrimSpace(kv), "=")
+			if !ok {
+				return PriorityConfig{}, errors.New("faulty priority weight " + kv)
+			}
+
+			w, err := strconv.ParseFloat(v, 64)
+			if err != nil || w < 0 {
+				return PriorityConfig{}, errors.New("faulty priority weight value " + kv)
+			}
+
+			switch k {
+			case "recency":
+				o.Recency = w
+			case "versions":
+				o.Versions = w
+			case "importedby":
+				o.ImportedBy = w
+			default:
+				return PriorityConfig{}, errors.New("unknown priority weight " + k)
+			}
+		}
+	}
+
+	if watchlist != "" {
+		for _, p := range strings.Split(watchlist, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				o.Watchlist = append(o.Watchlist, p)
+			}
+		}
+	}
+
+	if poolSize != "" {
+		var err error
+		if o.PoolSize, err = strconv.Atoi(poolSize); err != nil || o.PoolSize < 0 {
+			return PriorityConfig{}, errors.New("faulty priority pool size " + poolSize)
+		}
+	}
+
+	return o, nil
+}
+
+// Prioritize orders the candidates according to the configuration.
+// The ties are resolved by module's name and version to keep the order deterministic.
+func Prioritize(candidates []Candidate, cfg PriorityConfig, now time.Time) []Module {
+	watchlist := make(map[string]int, len(cfg.Watchlist))
+	for i, p := range cfg.Watchlist {
+		if _, ok := watchlist[p]; !ok {
+			watchlist[p] = i
+		}
+	}
+
+	var maxVersions, maxImportedBy float64
+	for _, c := range candidates {
+		maxVersions = math.Max(maxVersions, math.Log1p(float64(c.CntVersions)))
+		maxImportedBy = math.Max(maxImportedBy, math.Log1p(float64(c.CntImportedBy)))
+	}
+
+	scaled := func(v int64, max float64) float64 {
+		if max == 0 || v <= 0 {
+			return 0
+		}
+		return math.Log1p(float64(v)) / max
+	}
+
+	type ranked struct {
+		Candidate
+		watchIndex int
+		score      float64
+	}
+
+	r := make([]ranked, len(candidates))
+	for i, c := range candidates {
+		el := ranked{Candidate: c, watchIndex: -1}
+		if v, ok := watchlist[c.Name]; ok {
+			el.watchIndex = v
+		}
+
+		if cfg.Recency > 0 && !c.LastRelease.IsZero() {
+			days := math.Max(now.Sub(c.LastRelease).Hours()/24, 0)
+			el.score += cfg.Recency / (1 + days/30)
+		}
+		el.score += cfg.Versions * scaled(c.CntVersions, maxVersions)
+		el.score += cfg.ImportedBy * scaled(c.CntImportedBy, maxImportedBy)
+
+		r[i] = el
+	}
+
+	sort.SliceStable(
+		r, func(i, j int) bool {
+			a, b := r[i], r[j]
+			if (a.watchIndex >= 0) != (b.watchIndex >= 0) {
+				return a.watchIndex >= 0
+			}
+			if a.watchIndex != b.watchIndex {
+				return a.watchIndex < b.watchIndex
+			}
+			if a.score != b.score {
+				return a.score > b.score
+			}
+			if a.Name != b.Name {
+				return a.Name < b.Name
+			}
+			return a.Version < b.Version
+		},
+	)
+
+	o := make([]Module, len(r))
+	for i, el := range r {
+		o[i] = el.Module
+	}
+	return o
+}
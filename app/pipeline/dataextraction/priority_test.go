@@ -0,0 +1,150 @@
+package dataextraction
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPrioritize(t *testing.T) {
+	now := time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC)
+
+	candidates := []Candidate{
+		{
+			Module:        Module{Name: "old"},
+			LastRelease:   now.Add(-365 * 24 * time.Hour),
+			CntVersions:   100,
+			CntImportedBy: 1,
+		},
+		{
+			Module:        Module{Name: "recent"},
+			LastRelease:   now.Add(-24 * time.Hour),
+			CntVersions:   2,
+			CntImportedBy: 0,
+		},
+		{
+			Module:        Module{Name: "popular"},
+			LastRelease:   now.Add(-180 * 24 * time.Hour),
+			CntVersions:   10,
+			CntImportedBy: 1000,
+		},
+		{
+			Module: Module{Name: "watched"},
+		},
+	}
+
+	type args struct {
+		candidates []Candidate
+		cfg        PriorityConfig
+	}
+	tests := []struct {
+		name string
+		args args
+		want []Module
+	}{
+		{
+			name: "no criteria: order by name",
+			args: args{candidates: candidates},
+			want: []Module{{Name: "old"}, {Name: "popular"}, {Name: "recent"}, {Name: "watched"}},
+		},
+		{
+			name: "recency",
+			args: args{candidates: candidates, cfg: PriorityConfig{Recency: 1}},
+			want: []Module{{Name: "recent"}, {Name: "popular"}, {Name: "old"}, {Name: "watched"}},
+		},
+		{
+			name: "number of versions",
+			args: args{candidates: candidates, cfg: PriorityConfig{Versions: 1}},
+			want: []Module{{Name: "old"}, {Name: "popular"}, {Name: "recent"}, {Name: "watched"}},
+		},
+		{
+			name: "importers with the watchlist",
+			args: args{
+				candidates: candidates,
+				cfg:        PriorityConfig{ImportedBy: 1, Watchlist: []string{"watched", "recent"}},
+			},
+			want: []Module{{Name: "watched"}, {Name: "recent"}, {Name: "popular"}, {Name: "old"}},
+		},
+		{
+			name: "empty input",
+			args: args{cfg: PriorityConfig{Recency: 1}},
+			want: []Module{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if got := Prioritize(tt.args.candidates, tt.args.cfg, now); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Prioritize() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestNewPriorityConfig(t *testing.T) {
+	type args struct {
+		weights, watchlist, poolSize string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    PriorityConfig
+		wantErr bool
+	}{
+		{
+			name:    "happy path: disabled",
+			args:    args{},
+			want:    PriorityConfig{},
+			wantErr: false,
+		},
+		{
+			name: "happy path: all set",
+			args: args{
+				weights:   "recency=1, versions=0.5,importedby=2",
+				watchlist: "github.com/foo/bar, github.com/foo/baz",
+				poolSize:  "10000",
+			},
+			want: PriorityConfig{
+				Recency:    1,
+				Versions:   0.5,
+				ImportedBy: 2,
+				Watchlist:  []string{"github.com/foo/bar", "github.com/foo/baz"},
+				PoolSize:   10000,
+			},
+			wantErr: false,
+		},
+		{
+			name:    "unhappy path: unknown weight",
+			args:    args{weights: "stars=1"},
+			want:    PriorityConfig{},
+			wantErr: true,
+		},
+		{
+			name:    "unhappy path: negative weight",
+			args:    args{weights: "recency=-1"},
+			want:    PriorityConfig{},
+			wantErr: true,
+		},
+		{
+			name:    "unhappy path: faulty pool size",
+			args:    args{poolSize: "foo"},
+			want:    PriorityConfig{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got, err := NewPriorityConfig(tt.args.weights, tt.args.watchlist, tt.args.poolSize)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("NewPriorityConfig() error = %v, wantErr %v", err, tt.wantErr)
+					return
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("NewPriorityConfig() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
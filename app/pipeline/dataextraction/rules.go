@@ -0,0 +1,289 @@
+package dataextraction
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// RulesVersion the version of the rules file format supported by the engine.
+const RulesVersion = 1
+
+//go:embed rules/main.json
+var defaultMainRules []byte
+
+// Transform defines the operation to apply to the extracted value.
+//   - split: splits the value by Arg and takes the element Index, the value is dropped if the index is out of range;
+//   - prefix: prepends Arg;
+//   - trim: trims the white spaces;
+//   - equals: yields "true" if the value equals Arg, "false" otherwise.
+type Transform struct {
+	Op    string `json:"op"`
+	Arg   string `json:"arg,omitempty"`
+	Index int    `json:"index,omitempty"`
+}
+
+// Rule defines how to extract the field's value from the HTML tree.
+// The value is extracted from every element matching Element and Attrs, the last extracted value wins.
+type Rule struct {
+	// Field the Meta field to set, see the json tags of the PkgGoDev_Meta proto message and "version".
+	Field string `json:"field"`
+
+	// Element the HTML tag name.
+	Element string `json:"element"`
+
+	// Attrs the attributes' values to match exactly.
+	Attrs map[string]string `json:"attrs,omitempty"`
+
+	// Nth restricts the extraction to the n-th matching element counted from 0.
+	Nth *int `json:"nth,omitempty"`
+
+	// Path the navigation steps from the matching element: first_child, last_child, next_sibling, prev_sibling, parent.
+	Path []string `json:"path,omitempty"`
+
+	// Target the tag name the node at the end of the path must have.
+	Target string `json:"target,omitempty"`
+
+	// Value defines the value of the node at the end of the path: "data" for the node's data, or "attr:{{key}}".
+	Value string `json:"value"`
+
+	// OnlyIf skips the node unless its value equals OnlyIf before the transforms.
+	OnlyIf string `json:"only_if,omitempty"`
+
+	Transforms []Transform `json:"transforms,omitempty"`
+}
+
+// Ruleset the versioned set of extraction rules.
+type Ruleset struct {
+	Version int    `json:"version"`
+	Rules   []Rule `json:"rules"`
+}
+
+var metaSetters = map[string]func(o *Meta, v string) error{
+	"version":    func(o *Meta, v string) error { o.Version = v; return nil },
+	"license":    func(o *Meta, v string) error { o.License = v; return nil },
+	"repository": func(o *Meta, v string) error { o.Repository = v; return nil },
+	"is_module": func(o *Meta, v string) (err error) {
+		o.IsModule, err = strconv.ParseBool(v)
+		return err
+	},
+	"is_latest_version": func(o *Meta, v string) (err error) {
+		o.IsLatestVersion, err = strconv.ParseBool(v)
+		return err
+	},
+	"is_valid_go_mod": func(o *Meta, v string) (err error) {
+		o.IsValidGoMod, err = strconv.ParseBool(v)
+		return err
+	},
+	"with_redistributable_license": func(o *Meta, v string) (err error) {
+		o.WithRedistributableLicense, err = strconv.ParseBool(v)
+		return err
+	},
+	"is_tagged_version": func(o *Meta, v string) (err error) {
+		o.IsTaggedVersion, err = strconv.ParseBool(v)
+		return err
+	},
+	"is_stable_version": func(o *Meta, v string) (err error) {
+		o.IsStableVersion, err = strconv.ParseBool(v)
+		return err
+	},
+}
+
+// LoadRules reads and validates the JSON rules file.
+func LoadRules(r io.Reader) (*Ruleset, error) {
+	var o Ruleset
+	if err := json.NewDecoder(r).Decode(&o); err != nil {
+		return nil, errors.New("faulty rules file: " + err.Error())
+	}
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// DefaultRules returns the rules shipped with the app.
+func DefaultRules() *Ruleset {
+	o, err := LoadRules(strings.NewReader(string(defaultMainRules)))
+	if err != nil {
+		panic("DefaultRules() error: " + err.Error())
+	}
+	return o
+}
+
+func (s Ruleset) validate() error {
+	if s.Version != RulesVersion {
+		return errors.New("unsupported rules version " + strconv.Itoa(s.Version))
+	}
+
+	for i, r := range s.Rules {
+		prefix := "rule " + strconv.Itoa(i) + ": "
+
+		if _, ok := metaSetters[r.Field]; !ok {
+			return errors.New(prefix + "unknown field " + r.Field)
+		}
+		if r.Element == "" {
+			return errors.New(prefix + "element must be set")
+		}
+		if r.Nth != nil && *r.Nth < 0 {
+			return errors.New(prefix + "nth must be non-negative")
+		}
+		for _, step := range r.Path {
+			switch step {
+			case "first_child", "last_child", "next_sibling", "prev_sibling", "parent":
+			default:
+				return errors.New(prefix + "unknown path step " + step)
+			}
+		}
+		if r.Value != "data" && !strings.HasPrefix(r.Value, "attr:") {
+			return errors.New(prefix + "unknown value " + r.Value)
+		}
+		for _, t := range r.Transforms {
+			switch t.Op {
+			case "split", "prefix", "trim", "equals":
+			default:
+				return errors.New(prefix + "unknown transform " + t.Op)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r Rule) matches(n *html.Node) bool {
+	if n.Type != html.ElementNode || n.Data != r.Element {
+		return false
+	}
+	for k, v := range r.Attrs {
+		if val, ok := attr(n, k); !ok || val != v {
+			return false
+		}
+	}
+	return true
+}
+
+func attr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// extract returns the value of the matching node, false is returned if the value cannot be extracted.
+func (r Rule) extract(n *html.Node) (string, bool) {
+	for _, step := range r.Path {
+		switch step {
+		case "first_child":
+			n = n.FirstChild
+		case "last_child":
+			n = n.LastChild
+		case "next_sibling":
+			n = n.NextSibling
+		case "prev_sibling":
+			n = n.PrevSibling
+		case "parent":
+			n = n.Parent
+		}
+		if n == nil {
+			return "", false
+		}
+	}
+
+	if r.Target != "" && (n.Type != html.ElementNode || n.Data != r.Target) {
+		return "", false
+	}
+
+	var v string
+	if r.Value == "data" {
+		v = n.Data
+	} else {
+		var ok bool
+		if v, ok = attr(n, strings.TrimPrefix(r.Value, "attr:")); !ok {
+			return "", false
+		}
+	}
+
+	if r.OnlyIf != "" && v != r.OnlyIf {
+		return "", false
+	}
+
+	for _, t := range r.Transforms {
+		switch t.Op {
+		case "split":
+			els := strings.Split(v, t.Arg)
+			if t.Index < 0 || t.Index >= len(els) {
+				return "", false
+			}
+			v = els[t.Index]
+		case "prefix":
+			v = t.Arg + v
+		case "trim":
+			v = strings.TrimSpace(v)
+		case "equals":
+			v = strconv.FormatBool(v == t.Arg)
+		}
+	}
+
+	return v, true
+}
+
+// Apply evaluates the rules over the HTML tree.
+func (s Ruleset) Apply(doc *html.Node) (Meta, error) {
+	var (
+		o   Meta
+		err error
+		f   func(*html.Node)
+	)
+
+	cnt := make([]int, len(s.Rules))
+
+	f = func(n *html.Node) {
+		for i, r := range s.Rules {
+			if !r.matches(n) {
+				continue
+			}
+
+			nth := cnt[i]
+			cnt[i]++
+			if r.Nth != nil && *r.Nth != nth {
+				continue
+			}
+
+			if v, ok := r.extract(n); ok {
+				if e := metaSetters[r.Field](&o, v); e != nil && err == nil {
+					err = errors.New("rule for field " + r.Field + ": " + e.Error())
+				}
+			}
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+
+	f(doc)
+
+	return o, err
+}
+
+// LoadRulesFile reads the rules from the file, nil is returned if the path is empty.
+func LoadRulesFile(path string) (*Ruleset, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	return LoadRules(f)
+}
@@ -0,0 +1,140 @@
+package dataextraction
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestLoadRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		wantErr bool
+	}{
+		{
+			name:    "happy path",
+			in:      `{"version": 1, "rules": [{"field": "license", "element": "a", "value": "data"}]}`,
+			wantErr: false,
+		},
+		{
+			name:    "unhappy path: unsupported version",
+			in:      `{"version": 2, "rules": []}`,
+			wantErr: true,
+		},
+		{
+			name:    "unhappy path: unknown field",
+			in:      `{"version": 1, "rules": [{"field": "foo", "element": "a", "value": "data"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "unhappy path: unknown path step",
+			in:      `{"version": 1, "rules": [{"field": "license", "element": "a", "path": ["foo"], "value": "data"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "unhappy path: unknown value",
+			in:      `{"version": 1, "rules": [{"field": "license", "element": "a", "value": "foo"}]}`,
+			wantErr: true,
+		},
+		{
+			name: "unhappy path: unknown transform",
+			in: `{"version": 1, "rules": [{"field": "license", "element": "a", "value": "data",
+"transforms": [{"op": "foo"}]}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "unhappy path: corrupt JSON",
+			in:      `{`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				_, err := LoadRules(strings.NewReader(tt.in))
+				if (err != nil) != tt.wantErr {
+					t.Errorf("LoadRules() error = %v, wantErr %v", err, tt.wantErr)
+				}
+			},
+		)
+	}
+}
+
+func TestRuleset_Apply(t *testing.T) {
+	const page = `<html><body>
+<div class="Meta-repo-v2"><a href="https://github.com/foo/foo">repo</a></div>
+<span class="Chip">package</span><span class="Chip">module</span><span class="Chip">other</span>
+<a class="Version">Version: v1.2.3 </a>
+<a class="Version">Version:</a>
+</body></html>`
+
+	tests := []struct {
+		name    string
+		rules   string
+		want    Meta
+		wantErr bool
+	}{
+		{
+			name: "custom markup",
+			rules: `{"version": 1, "rules": [
+{"field": "repository", "element": "div", "attrs": {"class": "Meta-repo-v2"}, "path": ["first_child"],
+"target": "a", "value": "attr:href"},
+{"field": "is_module", "element": "span", "attrs": {"class": "Chip"}, "path": ["last_child"], "value": "data",
+"only_if": "module", "transforms": [{"op": "equals", "arg": "module"}]},
+{"field": "version", "element": "a", "attrs": {"class": "Version"}, "path": ["last_child"], "value": "data",
+"transforms": [{"op": "split", "arg": ":", "index": 1}, {"op": "trim"}]}
+]}`,
+			want: Meta{
+				Repository: "https://github.com/foo/foo",
+				IsModule:   true,
+				Version:    "",
+			},
+			wantErr: false,
+		},
+		{
+			name: "nth element",
+			rules: `{"version": 1, "rules": [
+{"field": "version", "element": "a", "attrs": {"class": "Version"}, "nth": 0,
+"path": ["last_child"], "value": "data", "transforms": [{"op": "split", "arg": ":", "index": 1}, {"op": "trim"}]}
+]}`,
+			want:    Meta{Version: "v1.2.3"},
+			wantErr: false,
+		},
+		{
+			name: "unhappy path: non-boolean value for the flag",
+			rules: `{"version": 1, "rules": [
+{"field": "is_module", "element": "span", "attrs": {"class": "Chip"}, "path": ["last_child"], "value": "data"}
+]}`,
+			want:    Meta{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				rules, err := LoadRules(strings.NewReader(tt.rules))
+				if err != nil {
+					t.Errorf("LoadRules() unexpected error = %v", err)
+					return
+				}
+
+				doc, err := html.Parse(strings.NewReader(page))
+				if err != nil {
+					panic(err)
+				}
+
+				got, err := rules.Apply(doc)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("Apply() error = %v, wantErr %v", err, tt.wantErr)
+					return
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Apply() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
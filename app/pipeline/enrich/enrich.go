@@ -0,0 +1,44 @@
+// Package enrich enriches the extracted modules with the attributes of their repositories
+// to the module_repository table.
+package enrich
+
+import (
+	"context"
+	"errors"
+
+	"github.com/kislerdm/gomodanalysis/app/pipeline"
+)
+
+// Patterns to split the repository link, e.g. https://github.com/foo/bar, to the host, the owner and the name.
+const (
+	patternHost  = `^(?:[a-z]+://)?([^/]+)`
+	patternOwner = `^(?:[a-z]+://)?[^/]+/([^/]+)`
+	patternName  = `^(?:[a-z]+://)?[^/]+/[^/]+/([^/]+?)(?:\.git)?(?:/|$)`
+)
+
+// query defines the query to append the repository of every module given its latest extraction with
+// the repository link. The rows stored before the extraction status was introduced have no status
+// and are considered extracted.
+func query(wh pipeline.Warehouse) string {
+	queryLatest := "SELECT path, LOWER(meta.repository) AS repository " +
+		"FROM " + wh.Table(pipeline.TablePkgGoDev).ID() + " " +
+		"WHERE IFNULL(status.main, 'ok') = 'ok' AND IFNULL(meta.repository, '') != '' " +
+		"QUALIFY ROW_NUMBER() OVER (PARTITION BY path ORDER BY timestamp DESC) = 1"
+
+	return "INSERT INTO " + wh.Table(pipeline.TableModuleRepository).ID() + " " +
+		"(path, repository, host, owner, name, timestamp) " +
+		"SELECT path, repository, " +
+		"IFNULL(REGEXP_EXTRACT(repository, r'" + patternHost + "'), ''), " +
+		"IFNULL(REGEXP_EXTRACT(repository, r'" + patternOwner + "'), ''), " +
+		"IFNULL(REGEXP_EXTRACT(repository, r'" + patternName + "'), ''), " +
+		"CURRENT_TIMESTAMP() " +
+		"FROM (" + queryLatest + ");"
+}
+
+// Enrich appends the repository of every extracted module to the module_repository table.
+func Enrich(ctx context.Context, client pipeline.GBQClient, wh pipeline.Warehouse) error {
+	if _, err := client.Read(ctx, query(wh)); err != nil {
+		return errors.New("error enriching modules: " + err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package enrich
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/kislerdm/gomodanalysis/app/pipeline"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+type mockGBQClient struct {
+	err     error
+	queries []string
+}
+
+func (c *mockGBQClient) Read(_ context.Context, query string, _ ...pipeline.QueryParam) (
+	pipeline.DataReader, error,
+) {
+	c.queries = append(c.queries, query)
+	return nil, c.err
+}
+
+func (c *mockGBQClient) Iterate(_ context.Context, _ string, _ ...pipeline.QueryParam) (pipeline.Rows, error) {
+	panic("not implemented")
+}
+
+func (c *mockGBQClient) Write(_ context.Context, _ pipeline.DataWriter, _ string) error {
+	panic("not implemented")
+}
+
+func (c *mockGBQClient) OpenStream(_ context.Context, _ string, _ *descriptorpb.DescriptorProto) (
+	pipeline.Stream, error,
+) {
+	panic("not implemented")
+}
+
+func (c *mockGBQClient) Close() error {
+	return nil
+}
+
+// Test_patterns checks the patterns with the Go regexp, BigQuery uses the same RE2 syntax.
+func Test_patterns(t *testing.T) {
+	extract := func(pattern, s string) string {
+		m := regexp.MustCompile(pattern).FindStringSubmatch(s)
+		if m == nil {
+			return ""
+		}
+		return m[1]
+	}
+
+	tests := []struct {
+		repository string
+		host       string
+		owner      string
+		name       string
+	}{
+		{repository: "https://github.com/foo/bar", host: "github.com", owner: "foo", name: "bar"},
+		{repository: "https://github.com/foo/bar.git", host: "github.com", owner: "foo", name: "bar"},
+		{repository: "https://gitlab.com/foo/bar/baz", host: "gitlab.com", owner: "foo", name: "bar"},
+		{repository: "github.com/foo/bar/", host: "github.com", owner: "foo", name: "bar"},
+		{repository: "https://go.googlesource.com/tools", host: "go.googlesource.com", owner: "tools"},
+		{repository: "https://example.com", host: "example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.repository, func(t *testing.T) {
+				if got := extract(patternHost, tt.repository); got != tt.host {
+					t.Errorf("host = %v, want %v", got, tt.host)
+				}
+				if got := extract(patternOwner, tt.repository); got != tt.owner {
+					t.Errorf("owner = %v, want %v", got, tt.owner)
+				}
+				if got := extract(patternName, tt.repository); got != tt.name {
+					t.Errorf("name = %v, want %v", got, tt.name)
+				}
+			},
+		)
+	}
+}
+
+func TestEnrich(t *testing.T) {
+	wh := pipeline.Warehouse{
+		ProjectID: "p",
+		Dataset:   "d",
+		Tables: map[string]pipeline.TableRef{
+			pipeline.TableModuleRepository: {ProjectID: "p", Dataset: "stats", Table: "module_repository"},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		client       *mockGBQClient
+		wantContains []string
+		wantErr      bool
+	}{
+		{
+			name:   "happy path",
+			client: &mockGBQClient{},
+			wantContains: []string{
+				"INSERT INTO `p.stats.module_repository` (path, repository, host, owner, name, timestamp)",
+				"FROM `p.d.pkggodev` WHERE IFNULL(status.main, 'ok') = 'ok'",
+				"QUALIFY ROW_NUMBER() OVER (PARTITION BY path ORDER BY timestamp DESC) = 1",
+				"IFNULL(REGEXP_EXTRACT(repository, r'" + patternName + "'), '')",
+			},
+		},
+		{
+			name:    "query error",
+			client:  &mockGBQClient{err: errors.New("foo")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if err := Enrich(context.TODO(), tt.client, wh); (err != nil) != tt.wantErr {
+					t.Fatalf("Enrich() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if len(tt.client.queries) != 1 {
+					t.Fatalf("Enrich() run %d queries, want 1", len(tt.client.queries))
+				}
+				for _, s := range tt.wantContains {
+					if !strings.Contains(tt.client.queries[0], s) {
+						t.Errorf("Enrich() query = %s, want it to contain %s", tt.client.queries[0], s)
+					}
+				}
+			},
+		)
+	}
+}
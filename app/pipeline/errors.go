@@ -0,0 +1,63 @@
+package pipeline
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/kislerdm/gomodanalysis/app/pipeline/retry"
+)
+
+// Sentinel errors to classify the failures with errors.Is.
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrRateLimited = errors.New("rate limited")
+	ErrParse       = errors.New("parse error")
+	ErrTransport   = errors.New("transport error")
+
+	// ErrOverBudget matches the queries refused by CostGuard.
+	ErrOverBudget = errors.New("query over budget")
+
+	// ErrBackoffExhausted matches the errors returned when the retry attempts are exhausted.
+	ErrBackoffExhausted = retry.ErrExhausted
+)
+
+// Error the failure of the Kind caused by Err.
+// It matches Kind with errors.Is and unwraps to Err.
+type Error struct {
+	Kind error
+	Err  error
+}
+
+// NewError wraps the error err into the failure of the given kind.
+func NewError(kind, err error) error {
+	return Error{Kind: kind, Err: err}
+}
+
+func (e Error) Error() string {
+	if e.Err == nil {
+		return e.Kind.Error()
+	}
+	return e.Kind.Error() + ": " + e.Err.Error()
+}
+
+func (e Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e Error) Unwrap() error {
+	return e.Err
+}
+
+// HTTPStatusError returns the error with the message msg for the failed HTTP response with the status code.
+// The codes 404, 429 and 503 match ErrNotFound and ErrRateLimited respectively.
+func HTTPStatusError(code int, msg string) error {
+	err := errors.New(msg)
+	switch code {
+	case http.StatusNotFound:
+		return NewError(ErrNotFound, err)
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return NewError(ErrRateLimited, err)
+	default:
+		return err
+	}
+}
@@ -0,0 +1,79 @@
+package pipeline
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/kislerdm/gomodanalysis/app/pipeline/retry"
+)
+
+func TestHTTPStatusError(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    int
+		want    error
+		wantNot error
+	}{
+		{
+			name:    "404",
+			code:    http.StatusNotFound,
+			want:    ErrNotFound,
+			wantNot: ErrRateLimited,
+		},
+		{
+			name:    "429",
+			code:    http.StatusTooManyRequests,
+			want:    ErrRateLimited,
+			wantNot: ErrNotFound,
+		},
+		{
+			name:    "503",
+			code:    http.StatusServiceUnavailable,
+			want:    ErrRateLimited,
+			wantNot: ErrNotFound,
+		},
+		{
+			name:    "500",
+			code:    http.StatusInternalServerError,
+			want:    nil,
+			wantNot: ErrRateLimited,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				err := HTTPStatusError(tt.code, "foo")
+				if tt.want != nil && !errors.Is(err, tt.want) {
+					t.Errorf("HTTPStatusError() = %v, must match %v", err, tt.want)
+				}
+				if errors.Is(err, tt.wantNot) {
+					t.Errorf("HTTPStatusError() = %v, must not match %v", err, tt.wantNot)
+				}
+			},
+		)
+	}
+}
+
+func TestError(t *testing.T) {
+	cause := errors.New("foo")
+	err := error(&retry.ExhaustedError{Attempts: 2, Err: NewError(ErrTransport, cause)})
+
+	for _, target := range []error{ErrBackoffExhausted, ErrTransport, cause} {
+		if !errors.Is(err, target) {
+			t.Errorf("errors.Is(%v, %v) = false", err, target)
+		}
+	}
+	if errors.Is(err, ErrParse) {
+		t.Errorf("errors.Is(%v, %v) = true", err, ErrParse)
+	}
+
+	var e Error
+	if !errors.As(err, &e) || e.Kind != ErrTransport {
+		t.Errorf("errors.As(%v) must yield the Error of the kind %v", err, ErrTransport)
+	}
+
+	if got := NewError(ErrParse, cause).Error(); got != "parse error: foo" {
+		t.Errorf("Error() = %v", got)
+	}
+}
@@ -6,7 +6,6 @@ import (
 
 	"cloud.google.com/go/bigquery"
 	"cloud.google.com/go/bigquery/storage/managedwriter"
-	"google.golang.org/api/iterator"
 	"google.golang.org/protobuf/types/descriptorpb"
 )
 
@@ -18,6 +17,13 @@ type DataWriter interface {
 
 type DataReader [][]interface{}
 
+// QueryParam the query parameter referenced in the query as @Name.
+// The parameter type is derived from the Go type of the Value, e.g. int is INT64, []string is ARRAY<STRING>.
+type QueryParam struct {
+	Name  string
+	Value interface{}
+}
+
 func (d DataReader) NRows() int {
 	return len(d)
 }
@@ -31,12 +37,18 @@ func (d DataReader) NCols() int {
 
 // GBQClient IO client to communicate with GBQ.
 type GBQClient interface {
-	// Read reads the data using the query/path.
-	Read(ctx context.Context, query string) (DataReader, error)
+	// Read reads the data using the query with the parameters.
+	Read(ctx context.Context, query string, params ...QueryParam) (DataReader, error)
+
+	// Iterate runs the query with the parameters and streams the result, see ReadAll and Iterate to scan typed rows.
+	Iterate(ctx context.Context, query string, params ...QueryParam) (Rows, error)
 
 	// Write writes data to the specified path in persistence layer.
 	Write(ctx context.Context, data DataWriter, path string) error
 
+	// OpenStream opens the stream to append rows defined by the descriptor to the specified path.
+	OpenStream(ctx context.Context, path string, descriptor *descriptorpb.DescriptorProto) (Stream, error)
+
 	Close() error
 }
 
@@ -45,6 +57,8 @@ type gbq struct {
 
 	w *managedwriter.Client
 	r *bigquery.Client
+
+	guard *CostGuard
 }
 
 func (c gbq) Close() error {
@@ -54,47 +68,132 @@ func (c gbq) Close() error {
 	return c.r.Close()
 }
 
-func (c gbq) Read(ctx context.Context, query string) (DataReader, error) {
+func (c gbq) Read(ctx context.Context, query string, params ...QueryParam) (DataReader, error) {
+	rows, err := c.Iterate(ctx, query, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	var o DataReader
+	for {
+		row, err := rows.Next()
+		if err == Done {
+			return o, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		o = append(o, row)
+	}
+}
+
+func (c gbq) Iterate(ctx context.Context, query string, params ...QueryParam) (Rows, error) {
 	q := c.r.Query(query)
+	for _, p := range params {
+		q.Parameters = append(q.Parameters, bigquery.QueryParameter{Name: p.Name, Value: p.Value})
+	}
 
-	job, err := q.Run(ctx)
+	job, err := c.run(ctx, q, query)
 	if err != nil {
 		return nil, err
 	}
-	status, err := job.Wait(ctx)
+
+	it, err := job.Read(ctx)
 	if err != nil {
 		return nil, err
 	}
-	if err := status.Err(); err != nil {
-		return nil, err
+
+	// the schema is known once the first page is fetched
+	o := &gbqRows{it: it}
+	o.row, o.err = o.fetch()
+	for _, f := range it.Schema {
+		o.columns = append(o.columns, f.Name)
 	}
+	return o, nil
+}
 
-	it, err := job.Read(ctx)
+// run runs the query and waits for its completion.
+// The query is run dry first to be admitted by the cost guard if it is set.
+func (c gbq) run(ctx context.Context, q *bigquery.Query, query string) (*bigquery.Job, error) {
+	if c.guard == nil {
+		job, _, err := runJob(ctx, q)
+		return job, err
+	}
+
+	q.DryRun = true
+	dry, err := q.Run(ctx)
 	if err != nil {
+		return nil, errors.New("dry run: " + err.Error())
+	}
+	estimated := bytesProcessed(dry.LastStatus())
+	q.DryRun = false
+
+	if err := c.guard.Admit(query, estimated); err != nil {
 		return nil, err
 	}
 
-	var o DataReader
-	for {
-		var row []bigquery.Value
-		err := it.Next(&row)
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			return nil, err
-		}
+	job, status, err := runJob(ctx, q)
+	c.guard.Done(query, estimated, bytesProcessed(status))
+	return job, err
+}
 
-		var tmp []interface{}
-		for _, v := range row {
-			tmp = append(tmp, v)
-		}
-		o = append(o, tmp)
+func runJob(ctx context.Context, q *bigquery.Query) (*bigquery.Job, *bigquery.JobStatus, error) {
+	job, err := q.Run(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	status, err := job.Wait(ctx)
+	if err != nil {
+		return nil, status, err
 	}
+	if err := status.Err(); err != nil {
+		return nil, status, err
+	}
+	return job, status, nil
+}
+
+func bytesProcessed(status *bigquery.JobStatus) int64 {
+	if status == nil || status.Statistics == nil {
+		return 0
+	}
+	return status.Statistics.TotalBytesProcessed
+}
+
+// gbqRows the rows fetched page by page.
+type gbqRows struct {
+	it      *bigquery.RowIterator
+	columns []string
+
+	// row the prefetched row
+	row []interface{}
+	err error
+}
 
+func (r *gbqRows) fetch() ([]interface{}, error) {
+	var row []bigquery.Value
+	if err := r.it.Next(&row); err != nil {
+		return nil, err
+	}
+
+	o := make([]interface{}, len(row))
+	for i, v := range row {
+		o[i] = v
+	}
 	return o, nil
 }
 
+func (r *gbqRows) Columns() []string {
+	return r.columns
+}
+
+func (r *gbqRows) Next() ([]interface{}, error) {
+	row, err := r.row, r.err
+	if err == nil {
+		r.row, r.err = r.fetch()
+	}
+	return row, err
+}
+
 func (c gbq) Write(ctx context.Context, data DataWriter, path string) error {
 	managedStream, err := c.w.NewManagedStream(
 		ctx,
@@ -114,8 +213,59 @@ func (c gbq) Write(ctx context.Context, data DataWriter, path string) error {
 	return err
 }
 
+func (c gbq) OpenStream(ctx context.Context, path string, descriptor *descriptorpb.DescriptorProto) (Stream, error) {
+	managedStream, err := c.w.NewManagedStream(
+		ctx,
+		managedwriter.WithDestinationTable("projects/"+c.ProjectID+"/"+path),
+		managedwriter.WithSchemaDescriptor(descriptor),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return gbqStream{s: managedStream}, nil
+}
+
+type gbqStream struct {
+	s *managedwriter.ManagedStream
+}
+
+func (s gbqStream) Append(ctx context.Context, rows [][]byte) (map[int]error, error) {
+	result, err := s.s.AppendRows(ctx, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := result.FullResponse(ctx)
+
+	var rowErrs map[int]error
+	if resp != nil && len(resp.GetRowErrors()) > 0 {
+		rowErrs = make(map[int]error, len(resp.GetRowErrors()))
+		for _, e := range resp.GetRowErrors() {
+			rowErrs[int(e.GetIndex())] = errors.New(e.GetMessage())
+		}
+		return rowErrs, nil
+	}
+
+	return nil, err
+}
+
+func (s gbqStream) Close() error {
+	return s.s.Close()
+}
+
+// GBQConfig configuration of the GBQ client.
+type GBQConfig struct {
+	// CostGuard the guard to admit the queries, the queries are not guarded if it is not set.
+	CostGuard *CostGuard
+}
+
 // NewGBQClient init GBQ client.
-func NewGBQClient(ctx context.Context, projectID string) (GBQClient, error) {
+func NewGBQClient(ctx context.Context, projectID string, cfg ...GBQConfig) (GBQClient, error) {
+	var c GBQConfig
+	if len(cfg) > 0 {
+		c = cfg[0]
+	}
+
 	writer, err := managedwriter.NewClient(ctx, projectID)
 	if err != nil {
 		return nil, errors.New("error initialising bigquery client " + err.Error())
@@ -128,5 +278,6 @@ func NewGBQClient(ctx context.Context, projectID string) (GBQClient, error) {
 		ProjectID: projectID,
 		r:         reader,
 		w:         writer,
+		guard:     c.CostGuard,
 	}, nil
 }
@@ -6,6 +6,8 @@ require (
 	cloud.google.com/go/bigquery v1.43.0
 	golang.org/x/net v0.0.0-20221014081412-f15817d10f9b
 	google.golang.org/api v0.99.0
+	google.golang.org/genproto v0.0.0-20221014173430-6e2ab493f96b
+	google.golang.org/grpc v1.50.1
 	google.golang.org/protobuf v1.28.1
 )
 
@@ -26,6 +28,4 @@ require (
 	golang.org/x/text v0.3.7 // indirect
 	golang.org/x/xerrors v0.0.0-20220907171357-04be3eba64a2 // indirect
 	google.golang.org/appengine v1.6.7 // indirect
-	google.golang.org/genproto v0.0.0-20221014173430-6e2ab493f96b // indirect
-	google.golang.org/grpc v1.50.1 // indirect
 )
@@ -0,0 +1,54 @@
+// Package graph builds the dependency graph of the modules to the module_graph table.
+// The graph's edges link the module's version to the modules it imports the packages of.
+package graph
+
+import (
+	"context"
+	"errors"
+
+	"github.com/kislerdm/gomodanalysis/app/pipeline"
+)
+
+// queryImports defines the query to select the imported non-std packages of the latest extraction of every module's
+// version. The rows stored before the extraction status was introduced have no status and are considered extracted.
+func queryImports(wh pipeline.Warehouse) string {
+	return "SELECT path, version, imports.nonstd AS nonstd " +
+		"FROM " + wh.Table(pipeline.TablePkgGoDev).ID() + " " +
+		"WHERE IFNULL(status.imports, 'ok') = 'ok' " +
+		"QUALIFY ROW_NUMBER() OVER (PARTITION BY path, version ORDER BY timestamp DESC) = 1"
+}
+
+// query defines the query to append the edges of the graph. The imported package is attributed to the module
+// with the longest path which prefixes the package's path, the packages of unknown modules are skipped.
+// The imports of the module's own packages are not the edges.
+func query(wh pipeline.Warehouse) string {
+	// every path prefix of the imported package, e.g. github.com, github.com/foo, github.com/foo/bar
+	queryPrefixes := "SELECT p.path, p.version, i AS pkg, " +
+		"ARRAY_TO_STRING(" +
+		"ARRAY(SELECT el FROM UNNEST(SPLIT(i, '/')) AS el WITH OFFSET o WHERE o < n ORDER BY o), '/'" +
+		") AS prefix " +
+		"FROM (" + queryImports(wh) + ") AS p, UNNEST(p.nonstd) AS i, " +
+		"UNNEST(GENERATE_ARRAY(1, ARRAY_LENGTH(SPLIT(i, '/')))) AS n"
+
+	queryPkgModule := "SELECT pre.path, pre.version, pre.pkg, " +
+		"ARRAY_AGG(m.path ORDER BY LENGTH(m.path) DESC LIMIT 1)[OFFSET(0)] AS dependency " +
+		"FROM (" + queryPrefixes + ") AS pre " +
+		"INNER JOIN (SELECT DISTINCT path FROM " + wh.Table(pipeline.TableIndexStat).ID() + ") AS m " +
+		"ON m.path = pre.prefix " +
+		"GROUP BY pre.path, pre.version, pre.pkg"
+
+	return "INSERT INTO " + wh.Table(pipeline.TableModuleGraph).ID() + " " +
+		"(path, version, dependency, packages, timestamp) " +
+		"SELECT path, version, dependency, COUNT(DISTINCT pkg), CURRENT_TIMESTAMP() " +
+		"FROM (" + queryPkgModule + ") " +
+		"WHERE dependency != path " +
+		"GROUP BY path, version, dependency;"
+}
+
+// Build appends the edges of the dependency graph of the extracted modules to the module_graph table.
+func Build(ctx context.Context, client pipeline.GBQClient, wh pipeline.Warehouse) error {
+	if _, err := client.Read(ctx, query(wh)); err != nil {
+		return errors.New("error building dependency graph: " + err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/kislerdm/gomodanalysis/app/pipeline"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+type mockGBQClient struct {
+	err     error
+	queries []string
+}
+
+func (c *mockGBQClient) Read(_ context.Context, query string, _ ...pipeline.QueryParam) (
+	pipeline.DataReader, error,
+) {
+	c.queries = append(c.queries, query)
+	return nil, c.err
+}
+
+func (c *mockGBQClient) Iterate(_ context.Context, _ string, _ ...pipeline.QueryParam) (pipeline.Rows, error) {
+	panic("not implemented")
+}
+
+func (c *mockGBQClient) Write(_ context.Context, _ pipeline.DataWriter, _ string) error {
+	panic("not implemented")
+}
+
+func (c *mockGBQClient) OpenStream(_ context.Context, _ string, _ *descriptorpb.DescriptorProto) (
+	pipeline.Stream, error,
+) {
+	panic("not implemented")
+}
+
+func (c *mockGBQClient) Close() error {
+	return nil
+}
+
+func TestBuild(t *testing.T) {
+	wh := pipeline.Warehouse{
+		ProjectID: "p",
+		Dataset:   "d",
+		Tables: map[string]pipeline.TableRef{
+			pipeline.TableModuleGraph: {ProjectID: "p", Dataset: "stats", Table: "module_graph"},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		client       *mockGBQClient
+		wantContains []string
+		wantErr      bool
+	}{
+		{
+			name:   "happy path",
+			client: &mockGBQClient{},
+			wantContains: []string{
+				"INSERT INTO `p.stats.module_graph` (path, version, dependency, packages, timestamp)",
+				"FROM `p.d.pkggodev` WHERE IFNULL(status.imports, 'ok') = 'ok' " +
+					"QUALIFY ROW_NUMBER() OVER (PARTITION BY path, version ORDER BY timestamp DESC) = 1",
+				"UNNEST(p.nonstd) AS i",
+				"INNER JOIN (SELECT DISTINCT path FROM `p.d.index_stat`) AS m ON m.path = pre.prefix",
+				"ARRAY_AGG(m.path ORDER BY LENGTH(m.path) DESC LIMIT 1)[OFFSET(0)] AS dependency",
+				"WHERE dependency != path GROUP BY path, version, dependency;",
+			},
+		},
+		{
+			name:    "query error",
+			client:  &mockGBQClient{err: errors.New("foo")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if err := Build(context.TODO(), tt.client, wh); (err != nil) != tt.wantErr {
+					t.Fatalf("Build() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if len(tt.client.queries) != 1 {
+					t.Fatalf("Build() run %d queries, want 1", len(tt.client.queries))
+				}
+				for _, s := range tt.wantContains {
+					if !strings.Contains(tt.client.queries[0], s) {
+						t.Errorf("Build() query = %s, want it to contain %s", tt.client.queries[0], s)
+					}
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,323 @@
+package indexmodules
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery/storage/managedwriter"
+	app "github.com/kislerdm/gomodanalysis/app/pipeline"
+	"github.com/kislerdm/gomodanalysis/app/pipeline/retry"
+	storagepb "google.golang.org/genproto/googleapis/cloud/bigquery/storage/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// PendingStream the write stream which rows become visible only once it is committed.
+type PendingStream interface {
+	// AppendRows appends the rows at the offset. Appending the same offset again must succeed without duplicates.
+	AppendRows(ctx context.Context, rows [][]byte, offset int64) error
+
+	// Finalize closes the stream for appends.
+	Finalize(ctx context.Context) error
+
+	StreamName() string
+
+	Close() error
+}
+
+// StreamClient IO client to write the rows through the pending streams.
+type StreamClient interface {
+	// NewPendingStream opens the pending stream to append rows defined by the descriptor to the path.
+	NewPendingStream(ctx context.Context, path string, descriptor *descriptorpb.DescriptorProto) (PendingStream, error)
+
+	// Commit atomically commits the finalized streams.
+	Commit(ctx context.Context, streams ...string) error
+}
+
+// CommittedWriter writes every page through its own pending stream which is committed atomically.
+// The rows are appended at explicit offsets, so the retried append does not duplicate rows. The page is either
+// fully visible, or not visible at all, hence the ingestion cursor derived from the stored rows with ReadCursor
+// always points at the last stored page.
+type CommittedWriter struct {
+	Client StreamClient
+
+	// ChunkRows the max number of rows per append, defaults to 500.
+	ChunkRows int
+
+	// Retry the policy to retry the failed appends, defaults to 5 attempts spaced exponentially.
+	Retry *retry.Policy
+}
+
+// Store writes the data to the path exactly once.
+func (w CommittedWriter) Store(ctx context.Context, data app.DataWriter, path string) error {
+	rows := data.Data()
+	if len(rows) == 0 {
+		return nil
+	}
+
+	chunk := w.ChunkRows
+	if chunk <= 0 {
+		chunk = 500
+	}
+
+	policy := w.Retry
+	if policy == nil {
+		policy = &retry.Policy{
+			Strategy:    retry.Exponential{Base: time.Second, Factor: 2},
+			MaxAttempts: 5,
+			MaxDelay:    10 * time.Second,
+		}
+	}
+
+	s, err := w.Client.NewPendingStream(ctx, path, data.Descriptor())
+	if err != nil {
+		return errors.New("error opening pending stream to " + path + ": " + err.Error())
+	}
+	defer func() { _ = s.Close() }()
+
+	for offset := 0; offset < len(rows); offset += chunk {
+		end := offset + chunk
+		if end > len(rows) {
+			end = len(rows)
+		}
+		chunkRows := rows[offset:end]
+
+		if err := policy.Do(
+			ctx, func(ctx context.Context) error {
+				if err := s.AppendRows(ctx, chunkRows, int64(offset)); err != nil {
+					return retry.Retryable(app.NewError(app.ErrTransport, err))
+				}
+				return nil
+			},
+		); err != nil {
+			return errors.New(
+				"error appending rows at offset " + strconv.Itoa(offset) + " to " + s.StreamName() + ": " +
+					err.Error(),
+			)
+		}
+	}
+
+	if err := s.Finalize(ctx); err != nil {
+		return errors.New("error finalizing stream " + s.StreamName() + ": " + err.Error())
+	}
+
+	if err := w.Client.Commit(ctx, s.StreamName()); err != nil {
+		return errors.New("error committing stream " + s.StreamName() + ": " + err.Error())
+	}
+
+	return nil
+}
+
+// NewCommittedWriter initialise IO client to write output exactly once.
+func NewCommittedWriter(ctx context.Context, cfg CfgWriter) (Writer, error) {
+	bgClient, err := managedwriter.NewClient(ctx, cfg.projectID)
+	if err != nil {
+		return nil, errors.New("error initialising bigquery client " + err.Error())
+	}
+	return CommittedWriter{Client: bgStreamClient{c: bgClient, cfg: cfg}}, nil
+}
+
+type bgStreamClient struct {
+	c *managedwriter.Client
+
+	cfg CfgWriter
+}
+
+func (c bgStreamClient) NewPendingStream(
+	ctx context.Context, path string, descriptor *descriptorpb.DescriptorProto,
+) (PendingStream, error) {
+	ms, err := c.c.NewManagedStream(
+		ctx,
+		managedwriter.WithDestinationTable("projects/"+c.cfg.projectID+"/"+path),
+		managedwriter.WithType(managedwriter.PendingStream),
+		managedwriter.WithSchemaDescriptor(descriptor),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return bgPendingStream{s: ms}, nil
+}
+
+func (c bgStreamClient) Commit(ctx context.Context, streams ...string) error {
+	if len(streams) == 0 {
+		return nil
+	}
+
+	resp, err := c.c.BatchCommitWriteStreams(
+		ctx, &storagepb.BatchCommitWriteStreamsRequest{
+			Parent:       managedwriter.TableParentFromStreamName(streams[0]),
+			WriteStreams: streams,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	if len(resp.GetStreamErrors()) > 0 {
+		msg := make([]string, len(resp.GetStreamErrors()))
+		for i, e := range resp.GetStreamErrors() {
+			msg[i] = e.GetEntity() + ": " + e.GetErrorMessage()
+		}
+		sort.Strings(msg)
+		return errors.New(strings.Join(msg, "; "))
+	}
+
+	if resp.GetCommitTime() == nil {
+		return errors.New("streams were not committed")
+	}
+
+	return nil
+}
+
+type bgPendingStream struct {
+	s *managedwriter.ManagedStream
+}
+
+func (s bgPendingStream) AppendRows(ctx context.Context, rows [][]byte, offset int64) error {
+	result, err := s.s.AppendRows(ctx, rows, managedwriter.WithOffset(offset))
+	if err != nil {
+		return appendError(err)
+	}
+	_, err = result.GetResult(ctx)
+	return appendError(err)
+}
+
+// appendError maps the error of the append at the explicit offset.
+// The offset which already exists means that the previous attempt succeeded.
+func appendError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if s, ok := status.FromError(err); ok && s.Code() == codes.AlreadyExists {
+		return nil
+	}
+	return err
+}
+
+func (s bgPendingStream) Finalize(ctx context.Context) error {
+	_, err := s.s.Finalize(ctx)
+	return err
+}
+
+func (s bgPendingStream) StreamName() string {
+	return s.s.StreamName()
+}
+
+func (s bgPendingStream) Close() error {
+	return s.s.Close()
+}
+
+// Cursor the ingestion cursor derived from the stored rows.
+type Cursor struct {
+	// Since the timestamp of the latest stored rows.
+	Since string
+
+	// Seen the modules stored with the timestamp Since.
+	Seen map[string]struct{}
+}
+
+func cursorKey(r DataRow) string {
+	return r.Path + "@" + r.Version
+}
+
+// cursorRow the row of the cursor query.
+type cursorRow struct {
+	Since   string `bigquery:"ts"`
+	Path    string `bigquery:"path"`
+	Version string `bigquery:"version"`
+}
+
+// ReadCursor reads the cursor from the committed rows of the table.
+func ReadCursor(ctx context.Context, client app.GBQClient, table app.TableRef) (Cursor, error) {
+	rows, err := app.ReadAll[cursorRow](ctx, client, queryCursor(table.ID()))
+	if err != nil {
+		return Cursor{}, errors.New("ReadCursor(): " + err.Error())
+	}
+
+	o := Cursor{Seen: map[string]struct{}{}}
+	for _, r := range rows {
+		o.Since = r.Since
+		o.Seen[cursorKey(DataRow{Path: r.Path, Version: r.Version})] = struct{}{}
+	}
+
+	return o, nil
+}
+
+func queryCursor(table string) string {
+	return `SELECT FORMAT_TIMESTAMP('%FT%R:%E*SZ', timestamp, 'UTC') AS ts, path, version
+FROM ` + table + `
+WHERE timestamp = (SELECT MAX(timestamp) FROM ` + table + `);`
+}
+
+func (c Cursor) since() (time.Time, error) {
+	if c.Since == "" {
+		return time.Time{}, nil
+	}
+	ts, err := time.Parse(time.RFC3339Nano, c.Since)
+	if err != nil {
+		return time.Time{}, app.NewError(app.ErrParse, errors.New("corrupt cursor: "+err.Error()))
+	}
+	return ts, nil
+}
+
+// Filter returns the rows which were not stored yet: newer than the cursor, or not seen at its timestamp.
+func (c Cursor) Filter(rows []DataRow) ([]DataRow, error) {
+	since, err := c.since()
+	if err != nil {
+		return nil, err
+	}
+
+	var o []DataRow
+	for _, r := range rows {
+		ts, err := time.Parse(time.RFC3339Nano, r.Timestamp)
+		if err != nil {
+			return nil, app.NewError(app.ErrParse, errors.New("corrupt timestamp: "+err.Error()))
+		}
+
+		switch {
+		case ts.Before(since):
+			continue
+		case ts.Equal(since):
+			if _, ok := c.Seen[cursorKey(r)]; ok {
+				continue
+			}
+		}
+		o = append(o, r)
+	}
+
+	return o, nil
+}
+
+// Advance moves the cursor past the stored rows.
+func (c *Cursor) Advance(rows []DataRow) error {
+	since, err := c.since()
+	if err != nil {
+		return err
+	}
+
+	for _, r := range rows {
+		ts, err := time.Parse(time.RFC3339Nano, r.Timestamp)
+		if err != nil {
+			return app.NewError(app.ErrParse, errors.New("corrupt timestamp: "+err.Error()))
+		}
+
+		switch {
+		case ts.After(since):
+			since = ts
+			c.Since = r.Timestamp
+			c.Seen = map[string]struct{}{cursorKey(r): {}}
+		case ts.Equal(since):
+			if c.Seen == nil {
+				c.Seen = map[string]struct{}{}
+			}
+			c.Seen[cursorKey(r)] = struct{}{}
+		}
+	}
+
+	return nil
+}
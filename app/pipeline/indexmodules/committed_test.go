@@ -0,0 +1,421 @@
+package indexmodules
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+
+	app "github.com/kislerdm/gomodanalysis/app/pipeline"
+	"github.com/kislerdm/gomodanalysis/app/pipeline/retry"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// fakeManagedWriter emulates the pending streams of the BigQuery storage write API:
+// the rows of the stream become visible in the table once the finalized stream is committed.
+type fakeManagedWriter struct {
+	table   [][]byte
+	streams map[string]*fakePendingStream
+	appends int
+
+	// lostAcks the number of appends which are persisted, but fail to respond.
+	lostAcks int
+
+	// commitErr the error returned by the next commit.
+	commitErr error
+
+	openErr error
+}
+
+func (c *fakeManagedWriter) NewPendingStream(
+	_ context.Context, _ string, _ *descriptorpb.DescriptorProto,
+) (PendingStream, error) {
+	if c.openErr != nil {
+		return nil, c.openErr
+	}
+	if c.streams == nil {
+		c.streams = map[string]*fakePendingStream{}
+	}
+	s := &fakePendingStream{c: c, name: "stream" + strconv.Itoa(len(c.streams))}
+	c.streams[s.name] = s
+	return s, nil
+}
+
+func (c *fakeManagedWriter) Commit(_ context.Context, streams ...string) error {
+	if err := c.commitErr; err != nil {
+		c.commitErr = nil
+		return err
+	}
+	for _, name := range streams {
+		s, ok := c.streams[name]
+		if !ok || !s.finalized {
+			return errors.New("stream " + name + " is not finalized")
+		}
+	}
+	for _, name := range streams {
+		c.table = append(c.table, c.streams[name].rows...)
+	}
+	return nil
+}
+
+type fakePendingStream struct {
+	c         *fakeManagedWriter
+	name      string
+	rows      [][]byte
+	finalized bool
+}
+
+func (s *fakePendingStream) AppendRows(_ context.Context, rows [][]byte, offset int64) error {
+	s.c.appends++
+	switch {
+	case s.finalized:
+		return errors.New("stream is finalized")
+	case offset < int64(len(s.rows)):
+		return appendError(status.Error(codes.AlreadyExists, "offset already exists"))
+	case offset > int64(len(s.rows)):
+		return appendError(status.Error(codes.OutOfRange, "offset is beyond the end of the stream"))
+	}
+
+	s.rows = append(s.rows, rows...)
+	if s.c.lostAcks > 0 {
+		s.c.lostAcks--
+		return appendError(status.Error(codes.Unavailable, "connection reset"))
+	}
+	return nil
+}
+
+func (s *fakePendingStream) Finalize(_ context.Context) error {
+	s.finalized = true
+	return nil
+}
+
+func (s *fakePendingStream) StreamName() string {
+	return s.name
+}
+
+func (s *fakePendingStream) Close() error {
+	return nil
+}
+
+var testRetry = &retry.Policy{Strategy: retry.Linear{}, MaxAttempts: 3}
+
+type testRows [][]byte
+
+func (d testRows) Data() [][]byte {
+	return d
+}
+
+func (d testRows) Descriptor() *descriptorpb.DescriptorProto {
+	return &descriptorpb.DescriptorProto{}
+}
+
+func testPage(n int) testRows {
+	var o testRows
+	for i := 0; i < n; i++ {
+		o = append(o, []byte("row"+strconv.Itoa(i)))
+	}
+	return o
+}
+
+func TestCommittedWriter_Store(t *testing.T) {
+	tests := []struct {
+		name        string
+		client      *fakeManagedWriter
+		rows        int
+		wantRows    int
+		wantAppends int
+		wantErr     bool
+	}{
+		{
+			name:        "page appended in chunks",
+			client:      &fakeManagedWriter{},
+			rows:        5,
+			wantRows:    5,
+			wantAppends: 3,
+		},
+		{
+			name:        "lost acknowledgement retried at the same offset",
+			client:      &fakeManagedWriter{lostAcks: 1},
+			rows:        5,
+			wantRows:    5,
+			wantAppends: 4,
+		},
+		{
+			name:        "nothing is visible if commit failed",
+			client:      &fakeManagedWriter{commitErr: errors.New("foo")},
+			rows:        5,
+			wantRows:    0,
+			wantAppends: 3,
+			wantErr:     true,
+		},
+		{
+			name:    "open failed",
+			client:  &fakeManagedWriter{openErr: errors.New("foo")},
+			rows:    5,
+			wantErr: true,
+		},
+		{
+			name:   "empty page",
+			client: &fakeManagedWriter{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				w := CommittedWriter{Client: tt.client, ChunkRows: 2, Retry: testRetry}
+				err := w.Store(context.TODO(), testPage(tt.rows), "foo")
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("Store() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if len(tt.client.table) != tt.wantRows {
+					t.Errorf("Store() committed rows = %v, want %v", len(tt.client.table), tt.wantRows)
+				}
+				if !tt.wantErr && !reflect.DeepEqual(tt.client.table, testPage(tt.rows).Data()) {
+					t.Errorf("Store() committed rows = %s, want the page rows in order", tt.client.table)
+				}
+				if tt.client.appends != tt.wantAppends {
+					t.Errorf("Store() appends = %v, want %v", tt.client.appends, tt.wantAppends)
+				}
+			},
+		)
+	}
+}
+
+func TestCursor_Filter(t *testing.T) {
+	rows := []DataRow{
+		{Path: "a", Version: "v1.0.0", Timestamp: "2022-10-23T14:22:05.2Z"},
+		{Path: "b", Version: "v1.0.0", Timestamp: "2022-10-23T14:22:05.247192Z"},
+		{Path: "c", Version: "v1.0.0", Timestamp: "2022-10-23T14:22:05.247192Z"},
+		{Path: "d", Version: "v1.0.0", Timestamp: "2022-10-23T14:22:06Z"},
+	}
+
+	tests := []struct {
+		name    string
+		cursor  Cursor
+		want    []DataRow
+		wantErr bool
+	}{
+		{
+			name:   "empty cursor",
+			cursor: Cursor{},
+			want:   rows,
+		},
+		{
+			name: "older and seen rows are dropped",
+			cursor: Cursor{
+				Since: "2022-10-23T14:22:05.247192Z",
+				Seen:  map[string]struct{}{"b@v1.0.0": {}},
+			},
+			want: rows[2:],
+		},
+		{
+			name:   "same timestamp in different format",
+			cursor: Cursor{Since: "2022-10-23T14:22:05.200Z", Seen: map[string]struct{}{"a@v1.0.0": {}}},
+			want:   rows[1:],
+		},
+		{
+			name:   "all stored",
+			cursor: Cursor{Since: "2022-10-23T14:22:06Z", Seen: map[string]struct{}{"d@v1.0.0": {}}},
+			want:   nil,
+		},
+		{
+			name:    "corrupt cursor",
+			cursor:  Cursor{Since: "foo"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got, err := tt.cursor.Filter(rows)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("Filter() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if tt.wantErr && !errors.Is(err, app.ErrParse) {
+					t.Errorf("Filter() error = %v, want ErrParse", err)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Filter() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestCursor_Advance(t *testing.T) {
+	c := Cursor{}
+
+	if err := c.Advance(
+		[]DataRow{
+			{Path: "a", Version: "v1.0.0", Timestamp: "2022-10-23T14:22:05Z"},
+			{Path: "b", Version: "v1.0.0", Timestamp: "2022-10-23T14:22:06Z"},
+		},
+	); err != nil {
+		t.Fatalf("Advance() unexpected error = %v", err)
+	}
+	if err := c.Advance([]DataRow{{Path: "c", Version: "v1.0.0", Timestamp: "2022-10-23T14:22:06.000Z"}}); err != nil {
+		t.Fatalf("Advance() unexpected error = %v", err)
+	}
+
+	want := Cursor{
+		Since: "2022-10-23T14:22:06Z",
+		Seen:  map[string]struct{}{"b@v1.0.0": {}, "c@v1.0.0": {}},
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("Advance() got = %v, want %v", c, want)
+	}
+}
+
+type mockCursorClient struct {
+	app.GBQClient
+	v   app.DataReader
+	err error
+}
+
+func (c mockCursorClient) Iterate(_ context.Context, _ string, _ ...app.QueryParam) (app.Rows, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return app.NewRows([]string{"ts", "path", "version"}, c.v), nil
+}
+
+func TestReadCursor(t *testing.T) {
+	tests := []struct {
+		name    string
+		client  mockCursorClient
+		want    Cursor
+		wantErr bool
+	}{
+		{
+			name: "happy path",
+			client: mockCursorClient{
+				v: app.DataReader{
+					{"2022-10-23T14:22:06Z", "a", "v1.0.0"},
+					{"2022-10-23T14:22:06Z", "b", "v1.0.0"},
+				},
+			},
+			want: Cursor{
+				Since: "2022-10-23T14:22:06Z",
+				Seen:  map[string]struct{}{"a@v1.0.0": {}, "b@v1.0.0": {}},
+			},
+		},
+		{
+			name:   "empty table",
+			client: mockCursorClient{},
+			want:   Cursor{Seen: map[string]struct{}{}},
+		},
+		{
+			name:    "faulty row",
+			client:  mockCursorClient{v: app.DataReader{{"2022-10-23T14:22:06Z", "a", int64(1)}}},
+			wantErr: true,
+		},
+		{
+			name:    "read failed",
+			client:  mockCursorClient{err: errors.New("foo")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got, err := ReadCursor(context.TODO(), tt.client, app.TableRef{ProjectID: "p", Dataset: "d", Table: "t"})
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("ReadCursor() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("ReadCursor() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+// Test_exactlyOnce ingests the index pages which overlap by the rows at the cursor's timestamp as
+// index.golang.org does. The first run crashes on the commit of the second page, the second run resumes from the
+// stored rows.
+func Test_exactlyOnce(t *testing.T) {
+	index := []DataRow{
+		{Path: "a", Version: "v1.0.0", Timestamp: "2022-10-23T14:22:05Z"},
+		{Path: "b", Version: "v1.0.0", Timestamp: "2022-10-23T14:22:06Z"},
+		{Path: "c", Version: "v1.0.0", Timestamp: "2022-10-23T14:22:06Z"},
+		{Path: "d", Version: "v1.0.0", Timestamp: "2022-10-23T14:22:07Z"},
+		{Path: "e", Version: "v1.0.0", Timestamp: "2022-10-23T14:22:08Z"},
+	}
+
+	// fetch returns up to 3 rows not older than since
+	fetch := func(since string) []DataRow {
+		var o []DataRow
+		for _, r := range index {
+			if r.Timestamp >= since && len(o) < 3 {
+				o = append(o, r)
+			}
+		}
+		return o
+	}
+
+	client := &fakeManagedWriter{}
+	w := CommittedWriter{Client: client, Retry: testRetry}
+
+	// stored emulates the committed rows to derive the cursor from, as ReadCursor does
+	var stored []DataRow
+
+	run := func(crashAt int) error {
+		cursor := Cursor{}
+		if err := cursor.Advance(stored); err != nil {
+			return err
+		}
+
+		for page := 0; ; page++ {
+			d, err := cursor.Filter(fetch(cursor.Since))
+			if err != nil {
+				return err
+			}
+			if len(d) == 0 {
+				return nil
+			}
+
+			output, err := ConvertToStoreFormat(d)
+			if err != nil {
+				return err
+			}
+
+			if page == crashAt {
+				client.commitErr = errors.New("crash")
+			}
+			if err := w.Store(context.TODO(), output, "foo"); err != nil {
+				return err
+			}
+			stored = append(stored, d...)
+
+			if err := cursor.Advance(d); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := run(1); err == nil {
+		t.Fatal("the first run must crash")
+	}
+	if len(client.table) != 3 {
+		t.Fatalf("the first page must be stored only, got %v rows", len(client.table))
+	}
+
+	if err := run(-1); err != nil {
+		t.Fatalf("unexpected error = %v", err)
+	}
+
+	var got []string
+	for _, r := range stored {
+		got = append(got, cursorKey(r))
+	}
+	want := []string{"a@v1.0.0", "b@v1.0.0", "c@v1.0.0", "d@v1.0.0", "e@v1.0.0"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("stored rows = %v, want %v", got, want)
+	}
+	if len(client.table) != len(want) {
+		t.Errorf("committed rows = %v, want %v", len(client.table), len(want))
+	}
+}
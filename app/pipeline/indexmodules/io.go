@@ -2,18 +2,13 @@ package indexmodules
 
 import (
 	"bytes"
-	"cloud.google.com/go/bigquery"
-	"cloud.google.com/go/bigquery/storage/managedwriter"
-	"cloud.google.com/go/bigquery/storage/managedwriter/adapt"
 	"context"
 	"errors"
 	app "github.com/kislerdm/gomodanalysis/app/pipeline"
 	"github.com/kislerdm/gomodanalysis/app/pipeline/indexmodules/model"
-	"google.golang.org/protobuf/proto"
-	"google.golang.org/protobuf/types/descriptorpb"
+	"github.com/kislerdm/gomodanalysis/app/pipeline/retry"
 	"log"
 	"net/http"
-	"os"
 	"time"
 	"unsafe"
 )
@@ -25,37 +20,13 @@ type CfgWriter struct {
 
 // Writer IO client to persist data.
 type Writer interface {
-	Store(ctx context.Context, data PersistenceFormat, path string) error
-}
-
-type bg struct {
-	c *managedwriter.Client
-
-	cfg CfgWriter
-}
-
-func (c bg) Store(ctx context.Context, data PersistenceFormat, path string) error {
-	managedStream, err := c.c.NewManagedStream(ctx,
-		managedwriter.WithDestinationTable("projects/"+c.cfg.projectID+"/"+path),
-		managedwriter.WithSchemaDescriptor(data.Descriptor),
-	)
-	if err != nil {
-		return err
-	}
-
-	result, err := managedStream.AppendRows(ctx, data.Data)
-	if err != nil {
-		return err
-	}
-
-	_, err = result.GetResult(ctx)
-	return err
+	Store(ctx context.Context, data app.DataWriter, path string) error
 }
 
 // NewConfigWriter initialises configuration.
-func NewConfigWriter() (CfgWriter, error) {
+func NewConfigWriter(projectID string) (CfgWriter, error) {
 	c := CfgWriter{
-		projectID: os.Getenv("PROJECT_ID"),
+		projectID: projectID,
 	}
 
 	if c.projectID == "" {
@@ -65,27 +36,9 @@ func NewConfigWriter() (CfgWriter, error) {
 	return c, nil
 }
 
-// NewWriter initialise IO client to write output.
-func NewWriter(ctx context.Context, cfg CfgWriter) (Writer, error) {
-	bgClient, err := managedwriter.NewClient(ctx, cfg.projectID)
-	if err != nil {
-		return nil, errors.New("error initialising bigquery client " + err.Error())
-	}
-	return &bg{
-		c:   bgClient,
-		cfg: cfg,
-	}, nil
-}
-
 // RawData fetched results.
 type RawData []byte
 
-// PersistenceFormat data format to persist.
-type PersistenceFormat struct {
-	Data       [][]byte
-	Descriptor *descriptorpb.DescriptorProto
-}
-
 type DataRow struct {
 	Path      string `json:"path"`
 	Version   string `json:"version"`
@@ -95,11 +48,11 @@ type DataRow struct {
 func (v RawData) Decode() ([]DataRow, error) {
 	// timestamp data length
 	if len(v) < 30 {
-		return nil, errors.New("faulty input: byte array is too short")
+		return nil, app.NewError(app.ErrParse, errors.New("faulty input: byte array is too short"))
 	}
 
 	if v[0] != '{' {
-		return nil, errors.New("faulty input: not a valid JSON")
+		return nil, app.NewError(app.ErrParse, errors.New("faulty input: not a valid JSON"))
 	}
 
 	var o []DataRow
@@ -128,7 +81,7 @@ func decodeRow(vals []byte) (DataRow, error) {
 	o := DataRow{}
 
 	if vals[0] != '{' || vals[len(vals)-1] != '}' {
-		return DataRow{}, errors.New("faulty input: not a valid JSON")
+		return DataRow{}, app.NewError(app.ErrParse, errors.New("faulty input: not a valid JSON"))
 	}
 
 	for i, b := range vals {
@@ -175,7 +128,7 @@ func convertToGBQTableFormat(v []DataRow) ([]*model.Index, error) {
 	for i, b := range v {
 		ts, err := time.Parse(time.RFC3339Nano, b.Timestamp)
 		if err != nil {
-			return nil, errors.New("corrupt timestamp: " + err.Error())
+			return nil, app.NewError(app.ErrParse, errors.New("corrupt timestamp: "+err.Error()))
 		}
 		o[i] = &model.Index{
 			Path:      b.Path,
@@ -186,31 +139,13 @@ func convertToGBQTableFormat(v []DataRow) ([]*model.Index, error) {
 	return o, nil
 }
 
-func ConvertToStoreFormat(v []DataRow) (PersistenceFormat, error) {
-	m := &model.Index{}
-	descriptorProto, err := adapt.NormalizeDescriptor(m.ProtoReflect().Descriptor())
-	if err != nil {
-		return PersistenceFormat{}, err
-	}
-
+// ConvertToStoreFormat converts the rows to the data to persist to the table defined by the Index proto message.
+func ConvertToStoreFormat(v []DataRow) (app.ProtoData, error) {
 	rows, err := convertToGBQTableFormat(v)
 	if err != nil {
-		return PersistenceFormat{}, err
-	}
-
-	data := make([][]byte, len(rows))
-	for k, v := range rows {
-		b, err := proto.Marshal(v)
-		if err != nil {
-			return PersistenceFormat{}, err
-		}
-		data[k] = b
+		return app.ProtoData{}, err
 	}
-
-	return PersistenceFormat{
-		Data:       data,
-		Descriptor: descriptorProto,
-	}, err
+	return app.NewProtoData(rows...)
 }
 
 type Reader interface {
@@ -220,7 +155,7 @@ type Reader interface {
 // CfgReader configurations for reader client.
 type CfgReader struct {
 	HttpClient *http.Client
-	Backoff    *app.Backoff
+	Retry      *retry.Policy
 	Verbose    bool
 }
 
@@ -231,43 +166,56 @@ type clientReader struct {
 func (c clientReader) Fetch(query map[string]string) (RawData, error) {
 	const baseURI = "https://index.golang.org/index?limit=2000"
 
-	d, err := c.Cfg.Backoff.LinearDelay()
-	if err != nil {
-		return nil, err
-	}
-
-	if c.Cfg.Verbose && d != 0 {
-		log.Printf("delay %v sec. and call", d.Seconds())
-	}
-
-	time.Sleep(d)
-
 	url := baseURI
 	for k, v := range query {
 		url += "&" + k + "=" + v
 	}
 
-	resp, err := c.Cfg.HttpClient.Get(url)
-	if err != nil {
-		return nil, err
-	}
+	var o RawData
 
-	if resp.StatusCode > 209 {
-		c.Cfg.Backoff.UpCounter()
-		return c.Fetch(query)
-	}
+	attempt := 0
+	err := c.Cfg.Retry.Do(
+		context.Background(), func(ctx context.Context) error {
+			attempt++
+			if c.Cfg.Verbose && attempt > 1 {
+				log.Printf("attempt %d to call %s", attempt, url)
+			}
 
-	c.Cfg.Backoff.Reset()
-	if resp.ContentLength == 0 {
-		return nil, nil
-	}
+			resp, err := c.Cfg.HttpClient.Get(url)
+			if err != nil {
+				return retry.Retryable(app.NewError(app.ErrTransport, err))
+			}
+			defer func() { _ = resp.Body.Close() }()
+
+			if resp.StatusCode > 209 {
+				err := app.HTTPStatusError(resp.StatusCode, "index.golang.org responded with "+resp.Status)
+				if !retry.IsRetryableStatus(resp.StatusCode) {
+					return err
+				}
+				if d, ok := app.ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+					return retry.After(err, d)
+				}
+				return retry.Retryable(err)
+			}
+
+			if resp.ContentLength == 0 {
+				return nil
+			}
+
+			var buf bytes.Buffer
+			if _, err := buf.ReadFrom(resp.Body); err != nil {
+				return retry.Retryable(app.NewError(app.ErrTransport, err))
+			}
 
-	var buf bytes.Buffer
-	if _, err := buf.ReadFrom(resp.Body); err != nil {
+			o = buf.Bytes()
+			return nil
+		},
+	)
+	if err != nil {
 		return nil, err
 	}
 
-	return buf.Bytes(), nil
+	return o, nil
 }
 
 func NewReader(cfg ...CfgReader) Reader {
@@ -282,41 +230,13 @@ func NewReader(cfg ...CfgReader) Reader {
 		c.HttpClient = &http.Client{Timeout: 10 * time.Second}
 	}
 
-	if c.Backoff == nil {
-		c.Backoff = &app.Backoff{MaxSteps: 5, MaxDelay: 10 * time.Second}
+	if c.Retry == nil {
+		c.Retry = &retry.Policy{
+			Strategy:    retry.Linear{Step: 2 * time.Second},
+			MaxAttempts: 6,
+			MaxDelay:    10 * time.Second,
+		}
 	}
 
 	return &clientReader{c}
 }
-
-// GetLastPaginationIndex returns the last fetched page.
-func GetLastPaginationIndex() string {
-	const q = `SELECT FORMAT_TIMESTAMP('%FT%R:%E*SZ', MAX(timestamp), 'UTC') AS last_ts FROM ` +
-		"`go-mod-analysis.raw.index`;"
-
-	ctx := context.Background()
-	c, err := bigquery.NewClient(ctx, os.Getenv("PROJECT_ID"))
-	defer func() {
-		_ = c.Close()
-	}()
-
-	if err != nil {
-		return ""
-	}
-
-	it, err := c.Query(q).Read(ctx)
-	if err != nil {
-		return ""
-	}
-
-	var v []bigquery.Value
-	err = it.Next(&v)
-	if err != nil {
-		return ""
-	}
-	if o, ok := v[0].(string); ok {
-		return o
-	}
-
-	return ""
-}
@@ -1,8 +1,14 @@
 package indexmodules
 
 import (
+	"errors"
+	app "github.com/kislerdm/gomodanalysis/app/pipeline"
 	"github.com/kislerdm/gomodanalysis/app/pipeline/indexmodules/model"
+	"github.com/kislerdm/gomodanalysis/app/pipeline/retry"
+	"io"
+	"net/http"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -153,3 +159,107 @@ func Test_convertToGBQTableFormat(t *testing.T) {
 		})
 	}
 }
+
+type mockTransport struct {
+	// statusCodes the status codes of the consecutive responses
+	statusCodes []int
+	body        string
+	calls       int
+}
+
+func (m *mockTransport) RoundTrip(_ *http.Request) (*http.Response, error) {
+	code := m.statusCodes[m.calls]
+	m.calls++
+	return &http.Response{
+		Status:        http.StatusText(code),
+		StatusCode:    code,
+		Body:          io.NopCloser(strings.NewReader(m.body)),
+		ContentLength: int64(len(m.body)),
+	}, nil
+}
+
+func TestClientReader_Fetch(t *testing.T) {
+	policy := &retry.Policy{Strategy: retry.Linear{Step: time.Millisecond}, MaxAttempts: 3}
+
+	tests := []struct {
+		name      string
+		transport *mockTransport
+		want      RawData
+		wantCalls int
+		wantErr   bool
+		wantErrIs []error
+	}{
+		{
+			name:      "happy path",
+			transport: &mockTransport{statusCodes: []int{http.StatusOK}, body: "foo"},
+			want:      RawData("foo"),
+			wantCalls: 1,
+			wantErr:   false,
+		},
+		{
+			name: "happy path: retried",
+			transport: &mockTransport{
+				statusCodes: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK},
+				body:        "foo",
+			},
+			want:      RawData("foo"),
+			wantCalls: 3,
+			wantErr:   false,
+		},
+		{
+			name:      "happy path: empty page",
+			transport: &mockTransport{statusCodes: []int{http.StatusOK}},
+			want:      nil,
+			wantCalls: 1,
+			wantErr:   false,
+		},
+		{
+			name:      "unhappy path: fatal status",
+			transport: &mockTransport{statusCodes: []int{http.StatusBadRequest}},
+			want:      nil,
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "unhappy path: not found",
+			transport: &mockTransport{statusCodes: []int{http.StatusNotFound}},
+			want:      nil,
+			wantCalls: 1,
+			wantErr:   true,
+			wantErrIs: []error{app.ErrNotFound},
+		},
+		{
+			name: "unhappy path: retries exhausted",
+			transport: &mockTransport{
+				statusCodes: []int{
+					http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable,
+				},
+			},
+			want:      nil,
+			wantCalls: 3,
+			wantErr:   true,
+			wantErrIs: []error{app.ErrBackoffExhausted, app.ErrRateLimited},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewReader(CfgReader{HttpClient: &http.Client{Transport: tt.transport}, Retry: policy})
+			got, err := c.Fetch(map[string]string{"since": "2022-10-23T14:22:05.247192Z"})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Fetch() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			for _, target := range tt.wantErrIs {
+				if !errors.Is(err, target) {
+					t.Errorf("Fetch() error = %v, must match %v", err, target)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Fetch() got = %v, want %v", got, tt.want)
+			}
+			if tt.transport.calls != tt.wantCalls {
+				t.Errorf("Fetch() calls = %v, want %v", tt.transport.calls, tt.wantCalls)
+			}
+		})
+	}
+}
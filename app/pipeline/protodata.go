@@ -0,0 +1,77 @@
+package pipeline
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+
+	"cloud.google.com/go/bigquery/storage/managedwriter/adapt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// ProtoData the rows of the proto messages to persist, it implements DataWriter.
+type ProtoData struct {
+	rows       [][]byte
+	descriptor *descriptorpb.DescriptorProto
+}
+
+func (d ProtoData) Data() [][]byte {
+	return d.rows
+}
+
+func (d ProtoData) Descriptor() *descriptorpb.DescriptorProto {
+	return d.descriptor
+}
+
+// NewProtoData marshals the messages of the type T to the rows to persist.
+// The descriptor is defined by the type T, so the data without messages is valid, unless T is an interface,
+// e.g. proto.Message, then all messages must be of the same type.
+func NewProtoData[T proto.Message](msgs ...T) (ProtoData, error) {
+	var m proto.Message = *new(T)
+	if m == nil {
+		if len(msgs) == 0 {
+			return ProtoData{}, errors.New("cannot define the type of no messages")
+		}
+		m = msgs[0]
+	}
+
+	descriptor, err := ProtoDescriptor(m)
+	if err != nil {
+		return ProtoData{}, err
+	}
+	name := m.ProtoReflect().Descriptor().FullName()
+
+	rows := make([][]byte, len(msgs))
+	for i, msg := range msgs {
+		if got := msg.ProtoReflect().Descriptor().FullName(); got != name {
+			return ProtoData{}, errors.New(
+				"message " + strconv.Itoa(i) + " of type " + string(got) + ", " + string(name) + " expected",
+			)
+		}
+		if rows[i], err = proto.Marshal(msg); err != nil {
+			return ProtoData{}, errors.New("cannot marshal message " + strconv.Itoa(i) + ": " + err.Error())
+		}
+	}
+
+	return ProtoData{rows: rows, descriptor: descriptor}, nil
+}
+
+var descriptors sync.Map
+
+// ProtoDescriptor returns the descriptor of the message normalized to be used by the warehouse write streams.
+// The descriptor is normalized once per message type, the returned value must not be modified.
+func ProtoDescriptor(m proto.Message) (*descriptorpb.DescriptorProto, error) {
+	md := m.ProtoReflect().Descriptor()
+	if v, ok := descriptors.Load(md.FullName()); ok {
+		return v.(*descriptorpb.DescriptorProto), nil
+	}
+
+	o, err := adapt.NormalizeDescriptor(md)
+	if err != nil {
+		return nil, errors.New("cannot normalize descriptor of " + string(md.FullName()) + ": " + err.Error())
+	}
+
+	v, _ := descriptors.LoadOrStore(md.FullName(), o)
+	return v.(*descriptorpb.DescriptorProto), nil
+}
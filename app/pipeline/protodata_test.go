@@ -0,0 +1,89 @@
+package pipeline
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestNewProtoData(t *testing.T) {
+	t.Run(
+		"typed messages", func(t *testing.T) {
+			got, err := NewProtoData(wrapperspb.String("foo"), wrapperspb.String("bar"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Data()) != 2 {
+				t.Fatalf("Data() got %d rows, want 2", len(got.Data()))
+			}
+
+			var v wrapperspb.StringValue
+			if err := proto.Unmarshal(got.Data()[1], &v); err != nil {
+				t.Fatal(err)
+			}
+			if v.GetValue() != "bar" {
+				t.Errorf("Data() got = %v, want bar", v.GetValue())
+			}
+
+			if got.Descriptor().GetName() != "google_protobuf_StringValue" {
+				t.Errorf("Descriptor() got = %v", got.Descriptor().GetName())
+			}
+		},
+	)
+
+	t.Run(
+		"no typed messages", func(t *testing.T) {
+			got, err := NewProtoData[*wrapperspb.StringValue]()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Data()) != 0 || got.Descriptor() == nil {
+				t.Errorf("NewProtoData() got = %v", got)
+			}
+		},
+	)
+
+	t.Run(
+		"messages of the same type", func(t *testing.T) {
+			got, err := NewProtoData([]proto.Message{wrapperspb.String("foo"), wrapperspb.String("bar")}...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Data()) != 2 {
+				t.Errorf("Data() got %d rows, want 2", len(got.Data()))
+			}
+		},
+	)
+
+	t.Run(
+		"messages of different types", func(t *testing.T) {
+			if _, err := NewProtoData([]proto.Message{wrapperspb.String("foo"), timestamppb.Now()}...); err == nil {
+				t.Error("NewProtoData() error expected")
+			}
+		},
+	)
+
+	t.Run(
+		"no messages of unknown type", func(t *testing.T) {
+			if _, err := NewProtoData[proto.Message](); err == nil {
+				t.Error("NewProtoData() error expected")
+			}
+		},
+	)
+}
+
+func TestProtoDescriptor(t *testing.T) {
+	a, err := ProtoDescriptor(wrapperspb.String("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ProtoDescriptor(&wrapperspb.StringValue{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b {
+		t.Error("ProtoDescriptor() descriptor is expected to be cached")
+	}
+}
@@ -0,0 +1,197 @@
+package pipeline
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateWindow the time window to measure the throughput.
+const rateWindow = 10 * time.Second
+
+// RateLimiter token bucket limiter to share among all clients calling the same host.
+type RateLimiter struct {
+	rate     float64
+	burst    float64
+	maxPause time.Duration
+
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+	acquired    []time.Time
+
+	mu sync.Mutex
+}
+
+// NewRateLimiter init the limiter allowing rate requests per second with the given burst.
+// The rate of zero means no limit, the requests are only delayed by the pauses.
+// The pauses requested by the host are capped by maxPause, zero value means no cap.
+func NewRateLimiter(rate float64, burst int, maxPause time.Duration) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:     rate,
+		burst:    float64(burst),
+		maxPause: maxPause,
+		tokens:   float64(burst),
+		last:     time.Now(),
+	}
+}
+
+// Wait blocks until the request is allowed, or the context is done.
+// The reserved request is given back to the limiter if the context is done before it is allowed.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	now := time.Now()
+	at := l.reserve(now)
+	d := at.Sub(now)
+	if d <= 0 {
+		if err := ctx.Err(); err != nil {
+			l.cancel(at)
+			return err
+		}
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		l.cancel(at)
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// reserve reserves the request and returns the time it is allowed at.
+// The tokens are accounted from the end of the pause, so the requests after the pause are spaced by the rate.
+func (l *RateLimiter) reserve(now time.Time) time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	at := now
+	if l.pausedUntil.After(at) {
+		at = l.pausedUntil
+	}
+
+	if l.rate > 0 {
+		if at.After(l.last) {
+			l.tokens += at.Sub(l.last).Seconds() * l.rate
+			if l.tokens > l.burst {
+				l.tokens = l.burst
+			}
+			l.last = at
+		}
+
+		l.tokens--
+		if l.tokens < 0 {
+			if t := l.last.Add(time.Duration(-l.tokens / l.rate * float64(time.Second))); t.After(at) {
+				at = t
+			}
+		}
+	}
+
+	l.acquired = append(l.acquired, at)
+	l.prune(now)
+
+	return at
+}
+
+// cancel gives back the request reserved at the time at.
+func (l *RateLimiter) cancel(at time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rate > 0 {
+		l.tokens++
+	}
+
+	for i := len(l.acquired) - 1; i >= 0; i-- {
+		if l.acquired[i].Equal(at) {
+			l.acquired = append(l.acquired[:i], l.acquired[i+1:]...)
+			break
+		}
+	}
+}
+
+// prune drops the acquisitions outside the throughput measurement window.
+func (l *RateLimiter) prune(now time.Time) {
+	i := 0
+	for i < len(l.acquired) && !l.acquired[i].After(now.Add(-rateWindow)) {
+		i++
+	}
+	l.acquired = l.acquired[i:]
+}
+
+// Pause delays all requests for the duration d.
+// The tokens are not accumulated over the pause: one request is allowed once it ends,
+// the following requests are spaced by the rate.
+func (l *RateLimiter) Pause(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	if l.maxPause > 0 && d > l.maxPause {
+		d = l.maxPause
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	t := time.Now().Add(d)
+	if t.After(l.pausedUntil) {
+		l.pausedUntil = t
+	}
+	if l.rate > 0 && t.After(l.last) {
+		l.tokens = 1
+		l.last = t
+	}
+}
+
+// Rate returns the throughput in requests per second over the last 10 seconds.
+func (l *RateLimiter) Rate() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.prune(now)
+
+	var cnt int
+	for _, t := range l.acquired {
+		if !t.After(now) {
+			cnt++
+		}
+	}
+
+	return float64(cnt) / rateWindow.Seconds()
+}
+
+// ParseRetryAfter parses the Retry-After header value given either in seconds, or as the HTTP-date.
+// It returns false if the value is missing or faulty.
+func ParseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+
+	if s, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if s < 0 {
+			return 0, false
+		}
+		return time.Duration(s) * time.Second, true
+	}
+
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+
+	if d := t.Sub(now); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
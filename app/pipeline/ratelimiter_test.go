@@ -0,0 +1,179 @@
+package pipeline
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Wait(t *testing.T) {
+	tests := []struct {
+		name    string
+		l       *RateLimiter
+		pause   time.Duration
+		calls   int
+		wantMin time.Duration
+	}{
+		{
+			name:    "no limit",
+			l:       NewRateLimiter(0, 1, 0),
+			calls:   10,
+			wantMin: 0,
+		},
+		{
+			name:    "burst is spent, 100 rps",
+			l:       NewRateLimiter(100, 2, 0),
+			calls:   6,
+			wantMin: 40 * time.Millisecond,
+		},
+		{
+			name:    "pause",
+			l:       NewRateLimiter(0, 1, 0),
+			pause:   50 * time.Millisecond,
+			calls:   1,
+			wantMin: 50 * time.Millisecond,
+		},
+		{
+			name:    "pause is capped",
+			l:       NewRateLimiter(0, 1, 10*time.Millisecond),
+			pause:   time.Hour,
+			calls:   1,
+			wantMin: 10 * time.Millisecond,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t0 := time.Now()
+			tt.l.Pause(tt.pause)
+			for i := 0; i < tt.calls; i++ {
+				if err := tt.l.Wait(context.TODO()); err != nil {
+					t.Errorf("Wait() unexpected error = %v", err)
+					return
+				}
+			}
+			if got := time.Since(t0); got < tt.wantMin || got > tt.wantMin+time.Second {
+				t.Errorf("Wait() elapsed = %v, want at least %v", got, tt.wantMin)
+			}
+		})
+	}
+}
+
+func TestRateLimiter_WaitCancelled(t *testing.T) {
+	l := NewRateLimiter(0, 1, 0)
+	l.Pause(time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := l.Wait(ctx); err == nil {
+		t.Errorf("Wait() error expected")
+	}
+}
+
+func TestRateLimiter_WaitAfterPause(t *testing.T) {
+	const rate = 20
+	l := NewRateLimiter(rate, 5, 0)
+	l.Pause(50 * time.Millisecond)
+
+	var got []time.Time
+	for i := 0; i < 4; i++ {
+		if err := l.Wait(context.TODO()); err != nil {
+			t.Fatalf("Wait() unexpected error = %v", err)
+		}
+		got = append(got, time.Now())
+	}
+
+	for i := 1; i < len(got); i++ {
+		if d := got[i].Sub(got[i-1]); d < time.Second/rate-5*time.Millisecond {
+			t.Errorf("Wait() %d returned %v after the previous, want at least %v", i, d, time.Second/rate)
+		}
+	}
+}
+
+func TestRateLimiter_WaitCancelledRefund(t *testing.T) {
+	l := NewRateLimiter(10, 1, 0)
+	t0 := time.Now()
+	if err := l.Wait(context.TODO()); err != nil {
+		t.Fatalf("Wait() unexpected error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); err == nil {
+		t.Fatalf("Wait() error expected")
+	}
+
+	if err := l.Wait(context.TODO()); err != nil {
+		t.Fatalf("Wait() unexpected error = %v", err)
+	}
+	if got := time.Since(t0); got > 150*time.Millisecond {
+		t.Errorf("Wait() elapsed = %v, want the cancelled request to be given back", got)
+	}
+	if got := l.Rate(); got != 0.2 {
+		t.Errorf("Rate() = %v, want 0.2", got)
+	}
+}
+
+func TestRateLimiter_Rate(t *testing.T) {
+	l := NewRateLimiter(0, 1, 0)
+	for i := 0; i < 20; i++ {
+		_ = l.Wait(context.TODO())
+	}
+	if got := l.Rate(); got != 2 {
+		t.Errorf("Rate() = %v, want 2", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		v      string
+		want   time.Duration
+		wantOK bool
+	}{
+		{
+			name:   "seconds",
+			v:      "120",
+			want:   2 * time.Minute,
+			wantOK: true,
+		},
+		{
+			name:   "http date",
+			v:      "Tue, 01 Nov 2022 00:00:30 GMT",
+			want:   30 * time.Second,
+			wantOK: true,
+		},
+		{
+			name:   "http date in the past",
+			v:      "Mon, 31 Oct 2022 00:00:30 GMT",
+			want:   0,
+			wantOK: true,
+		},
+		{
+			name:   "missing",
+			v:      "",
+			want:   0,
+			wantOK: false,
+		},
+		{
+			name:   "faulty",
+			v:      "foo",
+			want:   0,
+			wantOK: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseRetryAfter(tt.v, now)
+			if ok != tt.wantOK {
+				t.Errorf("ParseRetryAfter() ok = %v, want %v", ok, tt.wantOK)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseRetryAfter() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
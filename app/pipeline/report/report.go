@@ -0,0 +1,143 @@
+// Package report runs the analytical queries over the warehouse tables and writes their results as CSV.
+package report
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kislerdm/gomodanalysis/app/pipeline"
+)
+
+// Report the analytical query.
+type Report struct {
+	Name        string
+	Description string
+	Query       func(wh pipeline.Warehouse) string
+}
+
+// Reports the reports by name.
+var Reports = map[string]Report{
+	"importedby": {
+		Name:        "importedby",
+		Description: "distribution of the modules by the number of the modules importing them",
+		Query: func(wh pipeline.Warehouse) string {
+			return histogram(
+				wh, "importedby", "ARRAY_LENGTH(importedby)", "status.importedby",
+				[]int64{
+					1, 10, 50, 100, 200, 300, 400, 500, 600, 700, 800, 900,
+					1000, 2000, 3000, 4000, 5000, 6000, 7000, 8000, 9000, 10000, 20000, 30000, 40000, 50000,
+				},
+			)
+		},
+	},
+	"imports": {
+		Name:        "imports",
+		Description: "distribution of the modules by the number of the non-std packages they import",
+		Query: func(wh pipeline.Warehouse) string {
+			return histogram(
+				wh, "imports", "ARRAY_LENGTH(imports.nonstd)", "status.imports",
+				[]int64{1, 2, 5, 10, 20, 50, 100, 200, 500},
+			)
+		},
+	},
+}
+
+// Names returns the ordered names of the reports.
+func Names() []string {
+	o := make([]string, 0, len(Reports))
+	for k := range Reports {
+		o = append(o, k)
+	}
+	sort.Strings(o)
+	return o
+}
+
+// histogram defines the query to count the modules per group of the value expr computed for the latest extraction
+// of every module with the section status ok. The group is the highest bound not exceeding the value, e.g. 10+,
+// the modules with the value below the lowest bound are in the group 0. The bounds must be ascending.
+// The rows stored before the extraction status was introduced have no status and are considered extracted.
+func histogram(wh pipeline.Warehouse, name, expr, status string, bounds []int64) string {
+	cases := make([]string, len(bounds))
+	for i := range bounds {
+		b := strconv.FormatInt(bounds[len(bounds)-1-i], 10)
+		cases[i] = "WHEN " + expr + " >= " + b + " THEN " + b
+	}
+
+	queryLatest := "SELECT * FROM " + wh.Table(pipeline.TablePkgGoDev).ID() + " " +
+		"WHERE IFNULL(" + status + ", 'ok') = 'ok' " +
+		"QUALIFY ROW_NUMBER() OVER (PARTITION BY path ORDER BY timestamp DESC) = 1"
+
+	return "SELECT IF(bound = 0, '0', CONCAT(CAST(bound AS STRING), '+')) AS group_" + name + ", cnt_module " +
+		"FROM (" +
+		"SELECT CASE " + strings.Join(cases, " ") + " ELSE 0 END AS bound, COUNT(*) AS cnt_module " +
+		"FROM (" + queryLatest + ") GROUP BY bound" +
+		") ORDER BY bound;"
+}
+
+// Write runs the report and writes its result as CSV with the header to w. It returns the number of rows written.
+func Write(ctx context.Context, client pipeline.GBQClient, wh pipeline.Warehouse, r Report, w io.Writer) (
+	int, error,
+) {
+	rows, err := client.Iterate(ctx, r.Query(wh))
+	if err != nil {
+		return 0, errors.New("error running report " + r.Name + ": " + err.Error())
+	}
+
+	out := csv.NewWriter(w)
+	if err := out.Write(rows.Columns()); err != nil {
+		return 0, errors.New("error writing report " + r.Name + ": " + err.Error())
+	}
+
+	var cnt int
+	for {
+		row, err := rows.Next()
+		if err == pipeline.Done {
+			break
+		}
+		if err != nil {
+			return cnt, errors.New("error reading report " + r.Name + ": " + err.Error())
+		}
+
+		rec := make([]string, len(row))
+		for i, v := range row {
+			rec[i] = format(v)
+		}
+		if err := out.Write(rec); err != nil {
+			return cnt, errors.New("error writing report " + r.Name + ": " + err.Error())
+		}
+		cnt++
+	}
+
+	out.Flush()
+	if err := out.Error(); err != nil {
+		return cnt, errors.New("error writing report " + r.Name + ": " + err.Error())
+	}
+	return cnt, nil
+}
+
+// format returns the CSV value of the column's value, NULL is the empty string.
+func format(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
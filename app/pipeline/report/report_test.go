@@ -0,0 +1,137 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kislerdm/gomodanalysis/app/pipeline"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+type mockGBQClient struct {
+	columns []string
+	v       pipeline.DataReader
+	err     error
+	queries []string
+}
+
+func (c *mockGBQClient) Read(_ context.Context, _ string, _ ...pipeline.QueryParam) (pipeline.DataReader, error) {
+	panic("not implemented")
+}
+
+func (c *mockGBQClient) Iterate(_ context.Context, query string, _ ...pipeline.QueryParam) (pipeline.Rows, error) {
+	c.queries = append(c.queries, query)
+	if c.err != nil {
+		return nil, c.err
+	}
+	return pipeline.NewRows(c.columns, c.v), nil
+}
+
+func (c *mockGBQClient) Write(_ context.Context, _ pipeline.DataWriter, _ string) error {
+	panic("not implemented")
+}
+
+func (c *mockGBQClient) OpenStream(_ context.Context, _ string, _ *descriptorpb.DescriptorProto) (
+	pipeline.Stream, error,
+) {
+	panic("not implemented")
+}
+
+func (c *mockGBQClient) Close() error {
+	return nil
+}
+
+func Test_histogram(t *testing.T) {
+	wh := pipeline.Warehouse{ProjectID: "p", Dataset: "d"}
+
+	got := histogram(wh, "foo", "ARRAY_LENGTH(foo)", "status.foo", []int64{1, 10})
+	want := "SELECT IF(bound = 0, '0', CONCAT(CAST(bound AS STRING), '+')) AS group_foo, cnt_module " +
+		"FROM (" +
+		"SELECT CASE WHEN ARRAY_LENGTH(foo) >= 10 THEN 10 WHEN ARRAY_LENGTH(foo) >= 1 THEN 1 ELSE 0 END AS bound, " +
+		"COUNT(*) AS cnt_module " +
+		"FROM (" +
+		"SELECT * FROM `p.d.pkggodev` WHERE IFNULL(status.foo, 'ok') = 'ok' " +
+		"QUALIFY ROW_NUMBER() OVER (PARTITION BY path ORDER BY timestamp DESC) = 1" +
+		") GROUP BY bound" +
+		") ORDER BY bound;"
+	if got != want {
+		t.Errorf("histogram() = %v, want %v", got, want)
+	}
+}
+
+func TestReports(t *testing.T) {
+	wh := pipeline.Warehouse{ProjectID: "p", Dataset: "d"}
+	for _, name := range Names() {
+		r := Reports[name]
+		if r.Name != name {
+			t.Errorf("report %s is registered as %s", r.Name, name)
+		}
+		if q := r.Query(wh); !strings.Contains(q, "`p.d.pkggodev`") {
+			t.Errorf("report %s does not query the pkggodev table: %s", name, q)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	wh := pipeline.Warehouse{ProjectID: "p", Dataset: "d"}
+	r := Report{
+		Name:  "foo",
+		Query: func(wh pipeline.Warehouse) string { return "SELECT * FROM " + wh.Table("foo").ID() },
+	}
+
+	tests := []struct {
+		name    string
+		client  *mockGBQClient
+		want    string
+		wantCnt int
+		wantErr bool
+	}{
+		{
+			name: "happy path",
+			client: &mockGBQClient{
+				columns: []string{"group", "cnt", "share", "ok", "ts"},
+				v: pipeline.DataReader{
+					{"1+", int64(10), 0.25, true, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)},
+					{"a,b", int64(0), nil, false, nil},
+				},
+			},
+			want:    "group,cnt,share,ok,ts\n1+,10,0.25,true,2023-01-01T00:00:00Z\n\"a,b\",0,,false,\n",
+			wantCnt: 2,
+		},
+		{
+			name:    "empty",
+			client:  &mockGBQClient{columns: []string{"group"}},
+			want:    "group\n",
+			wantCnt: 0,
+		},
+		{
+			name:    "query error",
+			client:  &mockGBQClient{err: errors.New("foo")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				var w bytes.Buffer
+				cnt, err := Write(context.TODO(), tt.client, wh, r, &w)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("Write() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if cnt != tt.wantCnt {
+					t.Errorf("Write() rows = %v, want %v", cnt, tt.wantCnt)
+				}
+				if w.String() != tt.want {
+					t.Errorf("Write() got = %q, want %q", w.String(), tt.want)
+				}
+				if tt.client.queries[0] != "SELECT * FROM `p.d.foo`" {
+					t.Errorf("Write() unexpected query = %v", tt.client.queries[0])
+				}
+			},
+		)
+	}
+}
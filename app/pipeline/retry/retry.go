@@ -0,0 +1,195 @@
+// Package retry defines the policy to retry failed calls.
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Strategy defines the delay before the next attempt.
+type Strategy interface {
+	// Delay returns the delay after the given attempt, counted from 1, prev is the previous delay.
+	Delay(attempt int, prev time.Duration) time.Duration
+}
+
+// Linear the delay grows linearly: step, 2*step, 3*step, ...
+type Linear struct {
+	Step time.Duration
+}
+
+func (s Linear) Delay(attempt int, _ time.Duration) time.Duration {
+	return time.Duration(attempt) * s.Step
+}
+
+// Exponential the delay grows exponentially: base, base*factor, base*factor^2, ...
+// The factor defaults to 2.
+type Exponential struct {
+	Base   time.Duration
+	Factor float64
+}
+
+func (s Exponential) Delay(attempt int, _ time.Duration) time.Duration {
+	f := s.Factor
+	if f <= 1 {
+		f = 2
+	}
+	d := float64(s.Base)
+	for i := 1; i < attempt; i++ {
+		d *= f
+	}
+	return time.Duration(d)
+}
+
+// DecorrelatedJitter the delay is drawn randomly from [base, 3*prev].
+// See https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/
+type DecorrelatedJitter struct {
+	Base time.Duration
+}
+
+func (s DecorrelatedJitter) Delay(_ int, prev time.Duration) time.Duration {
+	if prev < s.Base {
+		prev = s.Base
+	}
+	upper := 3 * prev
+	if upper <= s.Base {
+		return s.Base
+	}
+	return s.Base + time.Duration(rand.Int63n(int64(upper-s.Base)))
+}
+
+// Policy defines how the failed calls are retried. The Policy is immutable and safe for concurrent use.
+type Policy struct {
+	Strategy Strategy
+
+	// MaxAttempts the max number of attempts including the first one. Zero value means no limit.
+	MaxAttempts int
+
+	// MaxDelay caps the delay between attempts. Zero value means no cap.
+	MaxDelay time.Duration
+
+	// MaxElapsed the max time to spend on all attempts including delays. Zero value means no limit.
+	MaxElapsed time.Duration
+}
+
+// ErrExhausted the error returned when the policy limits are reached.
+var ErrExhausted = errors.New("retry attempts exhausted")
+
+// ExhaustedError wraps the last error when the policy limits are reached.
+// It matches ErrExhausted with errors.Is and unwraps to the last error.
+type ExhaustedError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *ExhaustedError) Error() string {
+	return ErrExhausted.Error() + " after " + strconv.Itoa(e.Attempts) + " attempts: " + e.Err.Error()
+}
+
+func (e *ExhaustedError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ExhaustedError) Is(target error) bool {
+	return target == ErrExhausted
+}
+
+type retryableError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+// Retryable marks the error as retryable. The errors which are not marked are fatal.
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &retryableError{err: err}
+}
+
+// After marks the error as retryable not earlier than after the duration d, e.g. following Retry-After header.
+func After(err error, d time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &retryableError{err: err, after: d}
+}
+
+// IsRetryable returns true if the error was marked as retryable.
+func IsRetryable(err error) bool {
+	var e *retryableError
+	return errors.As(err, &e)
+}
+
+// IsRetryableStatus returns true for the HTTP status codes which signal a transient failure.
+func IsRetryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// Do calls fn until it succeeds, fails with a fatal error, the policy limits are reached, or the context is done.
+// The fatal error is returned as is, the last retryable error is wrapped into ExhaustedError.
+func (p Policy) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	t0 := time.Now()
+
+	var delay time.Duration
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+
+		var re *retryableError
+		if !errors.As(err, &re) {
+			return err
+		}
+
+		if p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+			return &ExhaustedError{Attempts: attempt, Err: re.err}
+		}
+
+		if p.Strategy != nil {
+			delay = p.Strategy.Delay(attempt, delay)
+		}
+		if p.MaxDelay > 0 && delay > p.MaxDelay {
+			delay = p.MaxDelay
+		}
+		if delay < re.after {
+			delay = re.after
+		}
+
+		if p.MaxElapsed > 0 && time.Since(t0)+delay > p.MaxElapsed {
+			return &ExhaustedError{Attempts: attempt, Err: re.err}
+		}
+
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,197 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStrategy_Delay(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       Strategy
+		attempt int
+		want    time.Duration
+	}{
+		{
+			name:    "linear: 1st attempt",
+			s:       Linear{Step: time.Second},
+			attempt: 1,
+			want:    time.Second,
+		},
+		{
+			name:    "linear: 3rd attempt",
+			s:       Linear{Step: time.Second},
+			attempt: 3,
+			want:    3 * time.Second,
+		},
+		{
+			name:    "exponential: 1st attempt",
+			s:       Exponential{Base: time.Second},
+			attempt: 1,
+			want:    time.Second,
+		},
+		{
+			name:    "exponential: 4th attempt",
+			s:       Exponential{Base: time.Second},
+			attempt: 4,
+			want:    8 * time.Second,
+		},
+		{
+			name:    "exponential: 3rd attempt with factor 3",
+			s:       Exponential{Base: time.Second, Factor: 3},
+			attempt: 3,
+			want:    9 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.s.Delay(tt.attempt, 0); got != tt.want {
+				t.Errorf("Delay() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecorrelatedJitter_Delay(t *testing.T) {
+	s := DecorrelatedJitter{Base: 10 * time.Millisecond}
+
+	var prev time.Duration
+	for i := 1; i < 100; i++ {
+		got := s.Delay(i, prev)
+		upper := 3 * s.Base
+		if 3*prev > upper {
+			upper = 3 * prev
+		}
+		if got < s.Base || got > upper {
+			t.Errorf("Delay() = %v, want within [%v, %v]", got, s.Base, upper)
+			return
+		}
+		prev = got
+	}
+}
+
+func TestPolicy_Do(t *testing.T) {
+	errTransient := errors.New("transient")
+	errFatal := errors.New("fatal")
+
+	type args struct {
+		// errs the errors returned by the consecutive calls, the call succeeds when the errors are over
+		errs []error
+	}
+	tests := []struct {
+		name          string
+		p             Policy
+		args          args
+		wantCalls     int
+		wantErr       error
+		wantExhausted bool
+	}{
+		{
+			name:      "success on the 1st attempt",
+			p:         Policy{Strategy: Linear{Step: time.Millisecond}, MaxAttempts: 3},
+			args:      args{},
+			wantCalls: 1,
+			wantErr:   nil,
+		},
+		{
+			name: "success on the 3rd attempt",
+			p:    Policy{Strategy: Exponential{Base: time.Millisecond}, MaxAttempts: 3},
+			args: args{
+				errs: []error{Retryable(errTransient), Retryable(errTransient)},
+			},
+			wantCalls: 3,
+			wantErr:   nil,
+		},
+		{
+			name: "fatal error",
+			p:    Policy{Strategy: Linear{Step: time.Millisecond}, MaxAttempts: 3},
+			args: args{
+				errs: []error{Retryable(errTransient), errFatal},
+			},
+			wantCalls: 2,
+			wantErr:   errFatal,
+		},
+		{
+			name: "max attempts",
+			p:    Policy{Strategy: Linear{Step: time.Millisecond}, MaxAttempts: 2},
+			args: args{
+				errs: []error{Retryable(errTransient), Retryable(errTransient), Retryable(errTransient)},
+			},
+			wantCalls:     2,
+			wantErr:       errTransient,
+			wantExhausted: true,
+		},
+		{
+			name: "max elapsed time",
+			p:    Policy{Strategy: Linear{Step: time.Hour}, MaxElapsed: time.Second},
+			args: args{
+				errs: []error{Retryable(errTransient), Retryable(errTransient)},
+			},
+			wantCalls:     1,
+			wantErr:       errTransient,
+			wantExhausted: true,
+		},
+		{
+			name: "max delay",
+			p:    Policy{Strategy: Linear{Step: time.Hour}, MaxDelay: time.Millisecond, MaxElapsed: time.Second},
+			args: args{
+				errs: []error{Retryable(errTransient), Retryable(errTransient)},
+			},
+			wantCalls: 3,
+			wantErr:   nil,
+		},
+		{
+			name: "retry after exceeds max elapsed time",
+			p:    Policy{MaxElapsed: time.Second},
+			args: args{
+				errs: []error{After(errTransient, time.Hour)},
+			},
+			wantCalls:     1,
+			wantErr:       errTransient,
+			wantExhausted: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			err := tt.p.Do(
+				context.TODO(), func(ctx context.Context) error {
+					calls++
+					if calls > len(tt.args.errs) {
+						return nil
+					}
+					return tt.args.errs[calls-1]
+				},
+			)
+
+			if calls != tt.wantCalls {
+				t.Errorf("Do() calls = %v, want %v", calls, tt.wantCalls)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Do() error = %v, want %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrExhausted) != tt.wantExhausted {
+				t.Errorf("Do() exhausted = %v, want %v", errors.Is(err, ErrExhausted), tt.wantExhausted)
+			}
+			if IsRetryable(err) {
+				t.Errorf("Do() shall not return retryable error")
+			}
+		})
+	}
+}
+
+func TestPolicy_DoCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+
+	err := Policy{Strategy: Linear{Step: time.Hour}}.Do(
+		ctx, func(ctx context.Context) error {
+			return Retryable(errors.New("transient"))
+		},
+	)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Do() error = %v, want %v", err, context.Canceled)
+	}
+}
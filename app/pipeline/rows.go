@@ -0,0 +1,230 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/iterator"
+)
+
+// Done is returned by Rows.Next and Iterator.Next after the last row.
+var Done = iterator.Done
+
+// Rows the query result streamed row by row.
+type Rows interface {
+	// Columns returns the names of the result columns.
+	Columns() []string
+
+	// Next returns the next row, or Done after the last row.
+	Next() ([]interface{}, error)
+}
+
+type memRows struct {
+	columns []string
+	rows    DataReader
+}
+
+func (r *memRows) Columns() []string {
+	return r.columns
+}
+
+func (r *memRows) Next() ([]interface{}, error) {
+	if len(r.rows) == 0 {
+		return nil, Done
+	}
+	row := r.rows[0]
+	r.rows = r.rows[1:]
+	return row, nil
+}
+
+// NewRows returns the rows iterating over the materialized data.
+func NewRows(columns []string, data DataReader) Rows {
+	return &memRows{columns: columns, rows: data}
+}
+
+// Iterator the iterator which scans the rows into the struct T.
+//
+// The columns are matched to the exported fields by the tag `bigquery:"column"`, or by the case-insensitive field name.
+// The fields of the embedded structs are matched as the fields of T. The columns without matching fields are ignored,
+// the fields tagged `bigquery:"-"` are skipped. NULL is scanned as the zero value, or the nil pointer.
+type Iterator[T any] struct {
+	rows Rows
+
+	// fields the index of the field matching the column, nil if the column is ignored
+	fields [][]int
+}
+
+// NewIterator returns the iterator to scan the rows into the struct T.
+func NewIterator[T any](rows Rows) (*Iterator[T], error) {
+	var v T
+	typ := reflect.TypeOf(v)
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return nil, errors.New("NewIterator(): struct type expected, got " + reflect.TypeOf(&v).Elem().String())
+	}
+
+	byName := map[string][]int{}
+	collectFields(typ, nil, byName)
+
+	o := &Iterator[T]{rows: rows, fields: make([][]int, len(rows.Columns()))}
+	for i, col := range rows.Columns() {
+		o.fields[i] = byName[strings.ToLower(col)]
+	}
+
+	return o, nil
+}
+
+// collectFields maps the lower-cased column names to the indexes of the fields of the struct typ.
+func collectFields(typ reflect.Type, parent []int, o map[string][]int) {
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+
+		index := make([]int, len(parent)+1)
+		copy(index, parent)
+		index[len(parent)] = i
+
+		tag := f.Tag.Get("bigquery")
+		switch {
+		case tag == "-":
+			continue
+		case f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct:
+			collectFields(f.Type, index, o)
+			continue
+		case !f.IsExported():
+			continue
+		}
+
+		name := tag
+		if name == "" {
+			name = f.Name
+		}
+		name = strings.ToLower(name)
+
+		// the shallower field takes precedence over the embedded one
+		if _, ok := o[name]; !ok || len(o[name]) > len(index) {
+			o[name] = index
+		}
+	}
+}
+
+// Next returns the next row, or Done after the last row.
+func (it *Iterator[T]) Next() (T, error) {
+	var o T
+
+	row, err := it.rows.Next()
+	if err != nil {
+		return o, err
+	}
+
+	v := reflect.ValueOf(&o).Elem()
+	for i, index := range it.fields {
+		if index == nil || i >= len(row) {
+			continue
+		}
+		if err := assign(v.FieldByIndex(index), row[i]); err != nil {
+			return o, errors.New("cannot scan column " + it.rows.Columns()[i] + ": " + err.Error())
+		}
+	}
+
+	return o, nil
+}
+
+// assign sets dst to the value v converting it to the dst type.
+func assign(dst reflect.Value, v interface{}) error {
+	if v == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+
+	src := reflect.ValueOf(v)
+	dt := dst.Type()
+
+	switch {
+	case src.Type().AssignableTo(dt):
+		dst.Set(src)
+		return nil
+
+	case dt.Kind() == reflect.Pointer:
+		p := reflect.New(dt.Elem())
+		if err := assign(p.Elem(), v); err != nil {
+			return err
+		}
+		dst.Set(p)
+		return nil
+
+	case dt.Kind() == reflect.Slice && src.Kind() == reflect.Slice && dt.Elem().Kind() != reflect.Uint8:
+		s := reflect.MakeSlice(dt, src.Len(), src.Len())
+		for i := 0; i < src.Len(); i++ {
+			if err := assign(s.Index(i), src.Index(i).Interface()); err != nil {
+				return errors.New("element " + strconv.Itoa(i) + ": " + err.Error())
+			}
+		}
+		dst.Set(s)
+		return nil
+
+	case isInt(src.Kind()) && isInt(dt.Kind()):
+		if dst.OverflowInt(src.Int()) {
+			return errors.New("value " + strconv.FormatInt(src.Int(), 10) + " overflows " + dt.String())
+		}
+		dst.SetInt(src.Int())
+		return nil
+
+	case isInt(src.Kind()) && isFloat(dt.Kind()):
+		dst.SetFloat(float64(src.Int()))
+		return nil
+
+	case isFloat(src.Kind()) && isFloat(dt.Kind()):
+		dst.SetFloat(src.Float())
+		return nil
+
+	case src.Kind() == dt.Kind() && (src.Kind() == reflect.String || src.Kind() == reflect.Bool):
+		dst.Set(src.Convert(dt))
+		return nil
+	}
+
+	return errors.New("cannot assign " + src.Type().String() + " to " + dt.String())
+}
+
+func isInt(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+func isFloat(k reflect.Kind) bool {
+	return k == reflect.Float32 || k == reflect.Float64
+}
+
+// Iterate runs the query with the parameters and returns the iterator to stream its rows scanned into the struct T.
+// Unlike ReadAll, the rows are not kept in memory.
+func Iterate[T any](ctx context.Context, client GBQClient, query string, params ...QueryParam) (*Iterator[T], error) {
+	rows, err := client.Iterate(ctx, query, params...)
+	if err != nil {
+		return nil, err
+	}
+	return NewIterator[T](rows)
+}
+
+// ReadAll runs the query with the parameters and scans all rows into the struct T.
+func ReadAll[T any](ctx context.Context, client GBQClient, query string, params ...QueryParam) ([]T, error) {
+	it, err := Iterate[T](ctx, client, query, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	var o []T
+	for i := 0; ; i++ {
+		v, err := it.Next()
+		if err == Done {
+			return o, nil
+		}
+		if err != nil {
+			return nil, errors.New("row " + strconv.Itoa(i) + ": " + err.Error())
+		}
+		o = append(o, v)
+	}
+}
@@ -0,0 +1,189 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type scanEmbedded struct {
+	Version string `bigquery:"version"`
+}
+
+type scanRow struct {
+	scanEmbedded
+
+	Name     string `bigquery:"path"`
+	Count    int
+	Share    float64
+	Released *time.Time
+	Tags     []string
+	Skipped  string `bigquery:"-"`
+	hidden   string
+}
+
+func TestIterator_Next(t *testing.T) {
+	ts := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		columns []string
+		data    DataReader
+		want    []scanRow
+		wantErr bool
+	}{
+		{
+			name:    "happy path",
+			columns: []string{"path", "version", "COUNT", "share", "released", "tags", "skipped", "hidden", "unknown"},
+			data: DataReader{
+				{"foo", "v1.0.0", int64(2), int64(1), ts, []interface{}{"a", "b"}, "x", "y", "z"},
+				{"bar", nil, nil, 0.5, nil, nil, "x", "y", "z"},
+			},
+			want: []scanRow{
+				{
+					scanEmbedded: scanEmbedded{Version: "v1.0.0"},
+					Name:         "foo",
+					Count:        2,
+					Share:        1,
+					Released:     &ts,
+					Tags:         []string{"a", "b"},
+				},
+				{Name: "bar", Share: 0.5},
+			},
+		},
+		{
+			name:    "happy path: missing columns",
+			columns: []string{"path"},
+			data:    DataReader{{"foo"}},
+			want:    []scanRow{{Name: "foo"}},
+		},
+		{
+			name:    "unhappy path: faulty type",
+			columns: []string{"path"},
+			data:    DataReader{{int64(1)}},
+			wantErr: true,
+		},
+		{
+			name:    "unhappy path: float into int",
+			columns: []string{"count"},
+			data:    DataReader{{1.5}},
+			wantErr: true,
+		},
+		{
+			name:    "unhappy path: faulty element",
+			columns: []string{"tags"},
+			data:    DataReader{{[]interface{}{"a", int64(1)}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				it, err := NewIterator[scanRow](NewRows(tt.columns, tt.data))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var got []scanRow
+				for {
+					v, err := it.Next()
+					if err == Done {
+						break
+					}
+					if (err != nil) != tt.wantErr {
+						t.Fatalf("Next() error = %v, wantErr %v", err, tt.wantErr)
+					}
+					if err != nil {
+						return
+					}
+					got = append(got, v)
+				}
+
+				if tt.wantErr {
+					t.Fatal("Next() error expected")
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Next() got = %+v, want %+v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestNewIterator_notStruct(t *testing.T) {
+	if _, err := NewIterator[string](NewRows(nil, nil)); err == nil {
+		t.Error("NewIterator() error expected")
+	}
+	if _, err := NewIterator[*scanRow](NewRows(nil, nil)); err == nil {
+		t.Error("NewIterator() error expected")
+	}
+}
+
+func Test_assign_overflow(t *testing.T) {
+	it, err := NewIterator[struct{ V int8 }](NewRows([]string{"v"}, DataReader{{int64(300)}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := it.Next(); err == nil {
+		t.Errorf("Next() error expected, got %v", v)
+	}
+}
+
+type mockRowsClient struct {
+	GBQClient
+
+	columns []string
+	v       DataReader
+	err     error
+}
+
+func (c mockRowsClient) Iterate(_ context.Context, _ string, _ ...QueryParam) (Rows, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return NewRows(c.columns, c.v), nil
+}
+
+func TestReadAll(t *testing.T) {
+	tests := []struct {
+		name    string
+		client  mockRowsClient
+		want    []scanRow
+		wantErr bool
+	}{
+		{
+			name:   "happy path",
+			client: mockRowsClient{columns: []string{"path"}, v: DataReader{{"foo"}, {"bar"}}},
+			want:   []scanRow{{Name: "foo"}, {Name: "bar"}},
+		},
+		{
+			name:   "no rows",
+			client: mockRowsClient{columns: []string{"path"}},
+		},
+		{
+			name:    "faulty row",
+			client:  mockRowsClient{columns: []string{"path"}, v: DataReader{{"foo"}, {1}}},
+			wantErr: true,
+		},
+		{
+			name:    "query error",
+			client:  mockRowsClient{err: errors.New("foo")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got, err := ReadAll[scanRow](context.TODO(), tt.client, "SELECT path FROM foo")
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("ReadAll() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("ReadAll() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,296 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Column modes.
+const (
+	ModeNullable = "NULLABLE"
+	ModeRequired = "REQUIRED"
+	ModeRepeated = "REPEATED"
+)
+
+// Column types.
+const (
+	TypeString    = "STRING"
+	TypeBytes     = "BYTES"
+	TypeInteger   = "INTEGER"
+	TypeFloat     = "FLOAT"
+	TypeBoolean   = "BOOLEAN"
+	TypeTimestamp = "TIMESTAMP"
+	TypeDate      = "DATE"
+	TypeRecord    = "RECORD"
+)
+
+// typeAliases the standard SQL type names mapped to the names used in the table schemas.
+var typeAliases = map[string]string{
+	"INT64":   TypeInteger,
+	"FLOAT64": TypeFloat,
+	"BOOL":    TypeBoolean,
+	"STRUCT":  TypeRecord,
+}
+
+// Field the table column.
+type Field struct {
+	Name        string  `json:"name"`
+	Type        string  `json:"type"`
+	Mode        string  `json:"mode"`
+	Description string  `json:"description,omitempty"`
+	Fields      []Field `json:"fields,omitempty"`
+}
+
+// Schema the table schema.
+type Schema []Field
+
+// Annotation the column semantics which the proto definition cannot express.
+type Annotation struct {
+	// Type overrides the column type derived from the proto field, e.g. TIMESTAMP for int64 unix microseconds.
+	Type string
+
+	// Mode overrides the NULLABLE mode of the singular proto field.
+	Mode string
+
+	Description string
+}
+
+// typeOverrides the column types allowed to override the type derived from the proto field kind.
+var typeOverrides = map[protoreflect.Kind][]string{
+	protoreflect.Int64Kind:    {TypeTimestamp},
+	protoreflect.Sint64Kind:   {TypeTimestamp},
+	protoreflect.Sfixed64Kind: {TypeTimestamp},
+	protoreflect.Int32Kind:    {TypeDate},
+	protoreflect.Sint32Kind:   {TypeDate},
+	protoreflect.Sfixed32Kind: {TypeDate},
+}
+
+func fieldType(kind protoreflect.Kind) (string, error) {
+	switch kind {
+	case protoreflect.StringKind:
+		return TypeString, nil
+	case protoreflect.BytesKind:
+		return TypeBytes, nil
+	case protoreflect.BoolKind:
+		return TypeBoolean, nil
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.EnumKind:
+		return TypeInteger, nil
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return TypeFloat, nil
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return TypeRecord, nil
+	default:
+		return "", errors.New("unsupported field kind " + kind.String())
+	}
+}
+
+// Generate derives the table schema from the proto message descriptor.
+// The annotations are set by the dot-separated column path, e.g. "meta.license".
+// The repeated fields are REPEATED, other fields are NULLABLE unless annotated otherwise.
+func Generate(md protoreflect.MessageDescriptor, annotations map[string]Annotation) (Schema, error) {
+	used := map[string]struct{}{}
+
+	o, err := generate(md, "", annotations, used)
+	if err != nil {
+		return nil, err
+	}
+
+	var unknown []string
+	for k := range annotations {
+		if _, ok := used[k]; !ok {
+			unknown = append(unknown, k)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, errors.New(
+			"annotated fields are not defined in " + string(md.FullName()) + ": " + strings.Join(unknown, ", "),
+		)
+	}
+
+	return o, nil
+}
+
+func generate(
+	md protoreflect.MessageDescriptor, prefix string, annotations map[string]Annotation, used map[string]struct{},
+) (Schema, error) {
+	fields := md.Fields()
+	o := make(Schema, fields.Len())
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		path := prefix + string(fd.Name())
+
+		if fd.IsMap() {
+			return nil, errors.New("map field " + path + " is not supported")
+		}
+
+		t, err := fieldType(fd.Kind())
+		if err != nil {
+			return nil, errors.New(path + ": " + err.Error())
+		}
+
+		f := Field{Name: string(fd.Name()), Type: t, Mode: ModeNullable}
+		if fd.Cardinality() == protoreflect.Repeated {
+			f.Mode = ModeRepeated
+		}
+
+		if a, ok := annotations[path]; ok {
+			used[path] = struct{}{}
+			f.Description = a.Description
+
+			if a.Type != "" && a.Type != f.Type {
+				if !contains(typeOverrides[fd.Kind()], a.Type) {
+					return nil, errors.New(path + ": type " + a.Type + " is incompatible with " + fd.Kind().String())
+				}
+				f.Type = a.Type
+			}
+
+			switch {
+			case a.Mode == "" || a.Mode == f.Mode:
+			case f.Mode == ModeRepeated:
+				return nil, errors.New(path + ": repeated field cannot be " + a.Mode)
+			case a.Mode == ModeRequired || a.Mode == ModeNullable:
+				f.Mode = a.Mode
+			default:
+				return nil, errors.New(path + ": faulty mode " + a.Mode)
+			}
+		}
+
+		if f.Type == TypeRecord {
+			if f.Fields, err = generate(fd.Message(), path+".", annotations, used); err != nil {
+				return nil, err
+			}
+		}
+
+		o[i] = f
+	}
+	return o, nil
+}
+
+func contains(s []string, v string) bool {
+	for _, el := range s {
+		if el == v {
+			return true
+		}
+	}
+	return false
+}
+
+// JSON returns the schema in the format of the bq CLI and the terraform google_bigquery_table resource.
+func (s Schema) JSON() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(s); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Terraform returns the schema attribute of the terraform google_bigquery_table resource.
+func (s Schema) Terraform() ([]byte, error) {
+	b, err := s.JSON()
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte("schema = <<EOF\n"), b...), "EOF\n"...), nil
+}
+
+// Parse parses the schema exported in JSON, e.g. with `bq show --schema --format=prettyjson`.
+func Parse(b []byte) (Schema, error) {
+	var o Schema
+	if err := json.Unmarshal(b, &o); err != nil {
+		return nil, errors.New("faulty schema: " + err.Error())
+	}
+	return o.normalize(), nil
+}
+
+func (s Schema) normalize() Schema {
+	o := make(Schema, len(s))
+	for i, f := range s {
+		f.Type = strings.ToUpper(f.Type)
+		if v, ok := typeAliases[f.Type]; ok {
+			f.Type = v
+		}
+		f.Mode = strings.ToUpper(f.Mode)
+		if f.Mode == "" {
+			f.Mode = ModeNullable
+		}
+		if f.Fields != nil {
+			f.Fields = Schema(f.Fields).normalize()
+		}
+		o[i] = f
+	}
+	return o
+}
+
+// FromBigQuery converts the schema of the live table.
+func FromBigQuery(s bigquery.Schema) Schema {
+	o := make(Schema, len(s))
+	for i, f := range s {
+		v := Field{Name: f.Name, Type: string(f.Type), Mode: ModeNullable, Description: f.Description}
+		switch {
+		case f.Repeated:
+			v.Mode = ModeRepeated
+		case f.Required:
+			v.Mode = ModeRequired
+		}
+		if len(f.Schema) > 0 {
+			v.Fields = FromBigQuery(f.Schema)
+		}
+		o[i] = v
+	}
+	return o.normalize()
+}
+
+// Diff returns the differences of the schema got from the schema want, sorted by the column path.
+func Diff(want, got Schema) []string {
+	var o []string
+	diff(want, got, "", &o)
+	sort.Strings(o)
+	return o
+}
+
+func diff(want, got Schema, prefix string, o *[]string) {
+	gotByName := make(map[string]Field, len(got))
+	for _, f := range got {
+		gotByName[f.Name] = f
+	}
+
+	for _, w := range want {
+		path := prefix + w.Name
+		g, ok := gotByName[w.Name]
+		if !ok {
+			*o = append(*o, path+": missing")
+			continue
+		}
+		delete(gotByName, w.Name)
+
+		if w.Type != g.Type {
+			*o = append(*o, path+": type "+g.Type+", want "+w.Type)
+		}
+		if w.Mode != g.Mode {
+			*o = append(*o, path+": mode "+g.Mode+", want "+w.Mode)
+		}
+		if w.Description != g.Description {
+			*o = append(*o, path+": description \""+g.Description+"\", want \""+w.Description+"\"")
+		}
+		if w.Type == TypeRecord && g.Type == TypeRecord {
+			diff(w.Fields, g.Fields, path+".", o)
+		}
+	}
+
+	for name := range gotByName {
+		*o = append(*o, prefix+name+": unexpected")
+	}
+}
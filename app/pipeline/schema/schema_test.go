@@ -0,0 +1,251 @@
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	dataextraction "github.com/kislerdm/gomodanalysis/app/pipeline/dataextraction/model"
+	indexmodules "github.com/kislerdm/gomodanalysis/app/pipeline/indexmodules/model"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		name        string
+		md          protoreflect.MessageDescriptor
+		annotations map[string]Annotation
+		want        Schema
+		wantErr     bool
+	}{
+		{
+			name: "no annotations",
+			md:   (&indexmodules.Index{}).ProtoReflect().Descriptor(),
+			want: Schema{
+				{Name: "path", Type: TypeString, Mode: ModeNullable},
+				{Name: "version", Type: TypeString, Mode: ModeNullable},
+				{Name: "timestamp", Type: TypeInteger, Mode: ModeNullable},
+			},
+		},
+		{
+			name: "annotated",
+			md:   (&indexmodules.Index{}).ProtoReflect().Descriptor(),
+			annotations: map[string]Annotation{
+				"path":      {Mode: ModeRequired, Description: "foo"},
+				"timestamp": {Type: TypeTimestamp},
+			},
+			want: Schema{
+				{Name: "path", Type: TypeString, Mode: ModeRequired, Description: "foo"},
+				{Name: "version", Type: TypeString, Mode: ModeNullable},
+				{Name: "timestamp", Type: TypeTimestamp, Mode: ModeNullable},
+			},
+		},
+		{
+			name:        "nested and repeated",
+			md:          (&dataextraction.PkgGoDev_Imports{}).ProtoReflect().Descriptor(),
+			annotations: map[string]Annotation{"std": {Mode: ModeRepeated, Description: "foo"}},
+			want: Schema{
+				{Name: "std", Type: TypeString, Mode: ModeRepeated, Description: "foo"},
+				{Name: "nonstd", Type: TypeString, Mode: ModeRepeated},
+			},
+		},
+		{
+			name:        "unknown field",
+			md:          (&indexmodules.Index{}).ProtoReflect().Descriptor(),
+			annotations: map[string]Annotation{"foo": {Mode: ModeRequired}},
+			wantErr:     true,
+		},
+		{
+			name:        "incompatible type",
+			md:          (&indexmodules.Index{}).ProtoReflect().Descriptor(),
+			annotations: map[string]Annotation{"path": {Type: TypeTimestamp}},
+			wantErr:     true,
+		},
+		{
+			name:        "required repeated field",
+			md:          (&dataextraction.PkgGoDev_Imports{}).ProtoReflect().Descriptor(),
+			annotations: map[string]Annotation{"std": {Mode: ModeRequired}},
+			wantErr:     true,
+		},
+		{
+			name:        "faulty mode",
+			md:          (&indexmodules.Index{}).ProtoReflect().Descriptor(),
+			annotations: map[string]Annotation{"path": {Mode: "foo"}},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got, err := Generate(tt.md, tt.annotations)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("Generate() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Generate() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestGenerate_nested(t *testing.T) {
+	got, err := Tables["pkggodev"].Schema()
+	if err != nil {
+		t.Fatalf("Schema() unexpected error = %v", err)
+	}
+
+	for _, f := range got {
+		if f.Name != "meta" {
+			continue
+		}
+		if f.Type != TypeRecord || f.Mode != ModeRequired || len(f.Fields) != 8 {
+			t.Errorf("Schema() meta = %v, want REQUIRED RECORD with 8 fields", f)
+		}
+		return
+	}
+	t.Errorf("Schema() meta is missing")
+}
+
+func TestDiff(t *testing.T) {
+	want := Schema{
+		{Name: "path", Type: TypeString, Mode: ModeRequired},
+		{Name: "timestamp", Type: TypeTimestamp, Mode: ModeRequired},
+		{
+			Name: "meta", Type: TypeRecord, Mode: ModeNullable,
+			Fields: []Field{{Name: "license", Type: TypeString, Mode: ModeNullable, Description: "foo"}},
+		},
+		{Name: "version", Type: TypeString, Mode: ModeRequired},
+	}
+
+	tests := []struct {
+		name string
+		got  Schema
+		want []string
+	}{
+		{
+			name: "identical",
+			got:  want,
+		},
+		{
+			name: "differ",
+			got: Schema{
+				{Name: "path", Type: TypeString, Mode: ModeNullable},
+				{Name: "timestamp", Type: TypeInteger, Mode: ModeRequired},
+				{
+					Name: "meta", Type: TypeRecord, Mode: ModeNullable,
+					Fields: []Field{{Name: "license", Type: TypeString, Mode: ModeNullable}},
+				},
+				{Name: "foo", Type: TypeString, Mode: ModeNullable},
+			},
+			want: []string{
+				"foo: unexpected",
+				`meta.license: description "", want "foo"`,
+				"path: mode NULLABLE, want REQUIRED",
+				"timestamp: type INTEGER, want TIMESTAMP",
+				"version: missing",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if got := Diff(want, tt.got); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Diff() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       string
+		want    Schema
+		wantErr bool
+	}{
+		{
+			name: "standard SQL types and default mode",
+			v:    `[{"name":"foo","type":"INT64"},{"name":"bar","type":"STRUCT","mode":"repeated","fields":[{"name":"baz","type":"BOOL","mode":"REQUIRED"}]}]`,
+			want: Schema{
+				{Name: "foo", Type: TypeInteger, Mode: ModeNullable},
+				{
+					Name: "bar", Type: TypeRecord, Mode: ModeRepeated,
+					Fields: []Field{{Name: "baz", Type: TypeBoolean, Mode: ModeRequired}},
+				},
+			},
+		},
+		{
+			name:    "faulty",
+			v:       `{`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got, err := Parse([]byte(tt.v))
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Parse() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestFromBigQuery(t *testing.T) {
+	got := FromBigQuery(
+		bigquery.Schema{
+			{Name: "foo", Type: bigquery.TimestampFieldType, Required: true, Description: "bar"},
+			{
+				Name: "baz", Type: bigquery.RecordFieldType, Repeated: true,
+				Schema: bigquery.Schema{{Name: "qux", Type: bigquery.StringFieldType}},
+			},
+		},
+	)
+
+	want := Schema{
+		{Name: "foo", Type: TypeTimestamp, Mode: ModeRequired, Description: "bar"},
+		{
+			Name: "baz", Type: TypeRecord, Mode: ModeRepeated,
+			Fields: []Field{{Name: "qux", Type: TypeString, Mode: ModeNullable}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FromBigQuery() got = %v, want %v", got, want)
+	}
+}
+
+// TestTables checks the schemas in infrastructure are in sync with the proto definitions.
+func TestTables(t *testing.T) {
+	for _, name := range TableNames() {
+		t.Run(
+			name, func(t *testing.T) {
+				want, err := Tables[name].Schema()
+				if err != nil {
+					t.Fatalf("Schema() unexpected error = %v", err)
+				}
+
+				b, err := os.ReadFile(filepath.Join("..", "..", "..", "infrastructure", "schema", name+".json"))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				got, err := Parse(b)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if d := Diff(want, got); len(d) > 0 {
+					t.Errorf("the schema differs, regenerate it: %v", d)
+				}
+			},
+		)
+	}
+}
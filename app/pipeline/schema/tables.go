@@ -0,0 +1,194 @@
+package schema
+
+import (
+	"errors"
+	"sort"
+
+	cadence "github.com/kislerdm/gomodanalysis/app/pipeline/cadence/model"
+	dataextraction "github.com/kislerdm/gomodanalysis/app/pipeline/dataextraction/model"
+	enrich "github.com/kislerdm/gomodanalysis/app/pipeline/enrich/model"
+	graph "github.com/kislerdm/gomodanalysis/app/pipeline/graph/model"
+	indexmodules "github.com/kislerdm/gomodanalysis/app/pipeline/indexmodules/model"
+	"google.golang.org/protobuf/proto"
+)
+
+// Table the warehouse table defined by the proto message.
+type Table struct {
+	Name        string
+	Message     proto.Message
+	Annotations map[string]Annotation
+}
+
+// Schema generates the table schema.
+func (t Table) Schema() (Schema, error) {
+	o, err := Generate(t.Message.ProtoReflect().Descriptor(), t.Annotations)
+	if err != nil {
+		return nil, errors.New(t.Name + ": " + err.Error())
+	}
+	return o, nil
+}
+
+// Tables the warehouse tables by name.
+var Tables = map[string]Table{
+	"index": {
+		Name:    "index",
+		Message: &indexmodules.Index{},
+		Annotations: map[string]Annotation{
+			"path":    {Mode: ModeRequired, Description: "The module path"},
+			"version": {Mode: ModeRequired, Description: "The module version"},
+			"timestamp": {
+				Type: TypeTimestamp, Mode: ModeRequired,
+				Description: "Time the version was first cached by proxy.golang.org",
+			},
+		},
+	},
+	"pkggodev": {
+		Name:    "pkggodev",
+		Message: &dataextraction.PkgGoDev{},
+		Annotations: map[string]Annotation{
+			"path":    {Mode: ModeRequired, Description: "The module path"},
+			"version": {Mode: ModeRequired, Description: "The module version"},
+			"meta":    {Mode: ModeRequired, Description: "Meta data of the given module"},
+			"meta.license": {
+				Mode: ModeRequired, Description: "The license under which the module is distributed",
+			},
+			"meta.repository": {Mode: ModeRequired, Description: "Repo with the module's codebase"},
+			"meta.is_module":  {Mode: ModeRequired, Description: "Flags if the package is a module"},
+			"meta.is_latest_version": {
+				Mode: ModeRequired, Description: "Flags if it is the latest version of the module",
+			},
+			"meta.is_valid_go_mod": {Mode: ModeRequired, Description: "Flags if the module has a valid go.mod"},
+			"meta.with_redistributable_license": {
+				Mode:        ModeRequired,
+				Description: "Flags if the module is distributed under the redistributable license",
+			},
+			"meta.is_tagged_version": {Mode: ModeRequired, Description: "Flags if the module is tagged"},
+			"meta.is_stable_version": {
+				Mode: ModeRequired, Description: "Flags if the version is stable, i.e. at least 1.0.0",
+			},
+			"imports": {Mode: ModeRequired, Description: "The dependencies of the given module"},
+			"imports.std": {
+				Description: "The std libraries imported as dependencies by the given module",
+			},
+			"imports.nonstd": {
+				Description: "The non-std libraries imported as dependencies by the given module",
+			},
+			"importedby": {Description: "The modules which use the give on as dependency"},
+			"timestamp": {
+				Type: TypeTimestamp, Mode: ModeRequired,
+				Description: "Time the version was first cached by proxy.golang.org",
+			},
+			"status": {
+				Description: "The extraction status per page section: ok, not_found, rate_limited, parse_error, " +
+					"timeout, error",
+			},
+			"status.main":       {Description: "Status of the main page with the module's meta data"},
+			"status.imports":    {Description: "Status of the imports tab"},
+			"status.importedby": {Description: "Status of the importedby tab"},
+		},
+	},
+	"pkggodev_pages": {
+		Name:    "pkggodev_pages",
+		Message: &dataextraction.PkgGoDevPage{},
+		Annotations: map[string]Annotation{
+			"url":         {Mode: ModeRequired, Description: "The page URL"},
+			"timestamp":   {Type: TypeTimestamp, Mode: ModeRequired, Description: "Time the page was fetched"},
+			"sha256":      {Mode: ModeRequired, Description: "SHA256 hash of the page body"},
+			"status_code": {Mode: ModeRequired, Description: "HTTP status code of the response"},
+			"body":        {Mode: ModeRequired, Description: "The page body"},
+		},
+	},
+	"pkggodev_deadletters": {
+		Name:    "pkggodev_deadletters",
+		Message: &dataextraction.PkgGoDevDeadLetter{},
+		Annotations: map[string]Annotation{
+			"path":    {Mode: ModeRequired, Description: "The module path"},
+			"version": {Mode: ModeRequired, Description: "The module version"},
+			"section": {Mode: ModeRequired, Description: "The page section: main, imports, importedby"},
+			"class": {
+				Mode:        ModeRequired,
+				Description: "The error class: rate_limited, parse_error, timeout, error; or the status once resolved",
+			},
+			"error":   {Mode: ModeRequired, Description: "The error message"},
+			"attempt": {Mode: ModeRequired, Description: "The number of failed attempts"},
+			"next_attempt_at": {
+				Type: TypeTimestamp, Mode: ModeRequired,
+				Description: "Time after which the section is eligible for the retry, the epoch start if resolved, " +
+					"or given up",
+			},
+			"state": {Mode: ModeRequired, Description: "The dead letter state: pending, resolved, given_up"},
+			"timestamp": {
+				Type: TypeTimestamp, Mode: ModeRequired, Description: "Time the dead letter was written",
+			},
+		},
+	},
+	"release_cadence": {
+		Name:    "release_cadence",
+		Message: &cadence.ReleaseCadence{},
+		Annotations: map[string]Annotation{
+			"path":     {Mode: ModeRequired, Description: "The module path"},
+			"releases": {Mode: ModeRequired, Description: "The number of releases, i.e. the versions without prerelease"},
+			"median_days_between": {
+				Description: "The median of the days between the consecutive releases",
+			},
+			"p90_days_between": {
+				Description: "The 90th percentile of the days between the consecutive releases",
+			},
+			"days_since_last": {Description: "The number of full days since the last release"},
+			"major_bumps": {
+				Mode: ModeRequired, Description: "The number of releases which bumped the major version",
+			},
+			"minor_bumps": {
+				Mode: ModeRequired, Description: "The number of releases which bumped the minor version",
+			},
+			"patch_bumps": {
+				Mode: ModeRequired, Description: "The number of releases which bumped the patch version",
+			},
+			"releases_last_12_months": {
+				Mode: ModeRequired, Description: "The number of releases within 12 months before the aggregation",
+			},
+			"timestamp": {
+				Type: TypeTimestamp, Mode: ModeRequired, Description: "Time the release cadence was aggregated",
+			},
+		},
+	},
+	"module_repository": {
+		Name:    "module_repository",
+		Message: &enrich.ModuleRepository{},
+		Annotations: map[string]Annotation{
+			"path":       {Mode: ModeRequired, Description: "The module path"},
+			"repository": {Mode: ModeRequired, Description: "The lower-cased link to the module's repository"},
+			"host":       {Mode: ModeRequired, Description: "The repository host, e.g. github.com"},
+			"owner":      {Mode: ModeRequired, Description: "The repository owner, or empty"},
+			"name":       {Mode: ModeRequired, Description: "The repository name, or empty"},
+			"timestamp": {
+				Type: TypeTimestamp, Mode: ModeRequired, Description: "Time the module was enriched",
+			},
+		},
+	},
+	"module_graph": {
+		Name:    "module_graph",
+		Message: &graph.ModuleDependency{},
+		Annotations: map[string]Annotation{
+			"path":       {Mode: ModeRequired, Description: "The module path"},
+			"version":    {Mode: ModeRequired, Description: "The module version"},
+			"dependency": {Mode: ModeRequired, Description: "The path of the module imported by the module"},
+			"packages": {
+				Mode: ModeRequired, Description: "The number of the dependency's packages imported by the module",
+			},
+			"timestamp": {
+				Type: TypeTimestamp, Mode: ModeRequired, Description: "Time the graph was built",
+			},
+		},
+	},
+}
+
+// TableNames returns the sorted names of the warehouse tables.
+func TableNames() []string {
+	o := make([]string, 0, len(Tables))
+	for k := range Tables {
+		o = append(o, k)
+	}
+	sort.Strings(o)
+	return o
+}
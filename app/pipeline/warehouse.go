@@ -0,0 +1,97 @@
+package pipeline
+
+import (
+	"errors"
+	"strings"
+)
+
+// Warehouse tables by their default names.
+const (
+	TableIndex               = "index"
+	TableIndexStat           = "index_stat"
+	TablePkgGoDev            = "pkggodev"
+	TablePkgGoDevPages       = "pkggodev_pages"
+	TablePkgGoDevDeadLetters = "pkggodev_deadletters"
+	TableReleaseCadence      = "release_cadence"
+	TableModuleRepository    = "module_repository"
+	TableModuleGraph         = "module_graph"
+)
+
+var warehouseTables = []string{
+	TableIndex, TableIndexStat, TablePkgGoDev, TablePkgGoDevPages, TablePkgGoDevDeadLetters, TableReleaseCadence,
+	TableModuleRepository, TableModuleGraph,
+}
+
+// TableRef the warehouse table.
+type TableRef struct {
+	ProjectID string
+	Dataset   string
+	Table     string
+}
+
+// ID returns the table identifier to use in the queries.
+func (t TableRef) ID() string {
+	return "`" + t.ProjectID + "." + t.Dataset + "." + t.Table + "`"
+}
+
+// Path returns the table path to write to.
+func (t TableRef) Path() string {
+	return "datasets/" + t.Dataset + "/tables/" + t.Table
+}
+
+// Warehouse the location of the tables read and written by the pipeline.
+type Warehouse struct {
+	ProjectID string
+
+	// Dataset the default dataset of the tables.
+	Dataset string
+
+	// Tables the tables which are renamed, or moved to other datasets by their default names.
+	Tables map[string]TableRef
+}
+
+// NewWarehouse reads the warehouse location using the function getenv, e.g. os.Getenv:
+// PROJECT_ID must be set; DATASET defaults to raw; TABLE_<NAME> renames the table, or moves it to another dataset
+// when set as dataset.table, e.g. TABLE_PKGGODEV=dev.pkggodev.
+func NewWarehouse(getenv func(string) string) (Warehouse, error) {
+	o := Warehouse{
+		ProjectID: getenv("PROJECT_ID"),
+		Dataset:   getenv("DATASET"),
+		Tables:    map[string]TableRef{},
+	}
+
+	if o.ProjectID == "" {
+		return Warehouse{}, errors.New("env variable PROJECT_ID must be set")
+	}
+
+	if o.Dataset == "" {
+		o.Dataset = "raw"
+	}
+
+	for _, name := range warehouseTables {
+		key := "TABLE_" + strings.ToUpper(name)
+		v := getenv(key)
+		if v == "" {
+			continue
+		}
+
+		t := TableRef{ProjectID: o.ProjectID, Dataset: o.Dataset, Table: v}
+		if els := strings.Split(v, "."); len(els) > 1 {
+			if len(els) != 2 || els[0] == "" || els[1] == "" {
+				return Warehouse{}, errors.New("faulty " + key + " value " + v + ", table, or dataset.table expected")
+			}
+			t.Dataset, t.Table = els[0], els[1]
+		}
+		o.Tables[name] = t
+	}
+
+	return o, nil
+}
+
+// Table returns the table by its default name.
+func (w Warehouse) Table(name string) TableRef {
+	if t, ok := w.Tables[name]; ok {
+		return t
+	}
+	return TableRef{ProjectID: w.ProjectID, Dataset: w.Dataset, Table: name}
+}
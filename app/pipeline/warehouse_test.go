@@ -0,0 +1,102 @@
+package pipeline
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewWarehouse(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    Warehouse
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			env:  map[string]string{"PROJECT_ID": "p"},
+			want: Warehouse{ProjectID: "p", Dataset: "raw", Tables: map[string]TableRef{}},
+		},
+		{
+			name: "renamed and moved tables",
+			env: map[string]string{
+				"PROJECT_ID":     "p",
+				"DATASET":        "staging",
+				"TABLE_INDEX":    "index_dev",
+				"TABLE_PKGGODEV": "dev.pkggodev",
+			},
+			want: Warehouse{
+				ProjectID: "p",
+				Dataset:   "staging",
+				Tables: map[string]TableRef{
+					TableIndex:    {ProjectID: "p", Dataset: "staging", Table: "index_dev"},
+					TablePkgGoDev: {ProjectID: "p", Dataset: "dev", Table: "pkggodev"},
+				},
+			},
+		},
+		{
+			name:    "project is missing",
+			env:     map[string]string{},
+			wantErr: true,
+		},
+		{
+			name:    "faulty table",
+			env:     map[string]string{"PROJECT_ID": "p", "TABLE_INDEX": "a.b.c"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got, err := NewWarehouse(func(k string) string { return tt.env[k] })
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("NewWarehouse() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("NewWarehouse() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestWarehouse_Table(t *testing.T) {
+	w := Warehouse{
+		ProjectID: "p",
+		Dataset:   "raw",
+		Tables:    map[string]TableRef{TableIndex: {ProjectID: "p", Dataset: "dev", Table: "idx"}},
+	}
+
+	tests := []struct {
+		name     string
+		table    string
+		wantID   string
+		wantPath string
+	}{
+		{
+			name:     "default",
+			table:    TablePkgGoDev,
+			wantID:   "`p.raw.pkggodev`",
+			wantPath: "datasets/raw/tables/pkggodev",
+		},
+		{
+			name:     "overridden",
+			table:    TableIndex,
+			wantID:   "`p.dev.idx`",
+			wantPath: "datasets/dev/tables/idx",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got := w.Table(tt.table)
+				if got.ID() != tt.wantID {
+					t.Errorf("ID() = %v, want %v", got.ID(), tt.wantID)
+				}
+				if got.Path() != tt.wantPath {
+					t.Errorf("Path() = %v, want %v", got.Path(), tt.wantPath)
+				}
+			},
+		)
+	}
+}
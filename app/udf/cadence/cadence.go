@@ -0,0 +1,190 @@
+package cadence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/kislerdm/gomodanalysis/app/udf/remotefn"
+	udfsemver "github.com/kislerdm/gomodanalysis/app/udf/semver"
+	"golang.org/x/mod/semver"
+)
+
+// Release the module version released at the given time.
+type Release struct {
+	Version string
+	Time    time.Time
+}
+
+// Stats defines the release cadence of the module.
+type Stats struct {
+	// Releases the number of releases.
+	Releases int `json:"releases"`
+
+	// MedianDaysBetween and P90DaysBetween the median and the 90th percentile of the days between
+	// the consecutive releases rounded to two decimals, nil if the module has fewer than two releases.
+	MedianDaysBetween *float64 `json:"median_days_between"`
+	P90DaysBetween    *float64 `json:"p90_days_between"`
+
+	// DaysSinceLast the number of full days since the last release, nil if the module has no releases.
+	DaysSinceLast *int64 `json:"days_since_last"`
+
+	// MajorBumps, MinorBumps and PatchBumps the number of releases which bumped the major, minor, or patch number
+	// of the highest version released before. The releases lower than that version, e.g. backports are not bumps.
+	MajorBumps int `json:"major_bumps"`
+	MinorBumps int `json:"minor_bumps"`
+	PatchBumps int `json:"patch_bumps"`
+
+	// ReleasesLast12Months the number of releases within 12 months before now.
+	ReleasesLast12Months int `json:"releases_last_12_months"`
+}
+
+// releases returns the releases ordered by time. The release is the valid version without the prerelease suffix,
+// so the prereleases and the pseudo-versions are excluded. The duplicated version is kept with its earliest time.
+func releases(v []Release) []Release {
+	first := map[string]int{}
+	var o []Release
+	for _, r := range v {
+		if !semver.IsValid(r.Version) || semver.Prerelease(r.Version) != "" {
+			continue
+		}
+		if i, ok := first[r.Version]; ok {
+			if r.Time.Before(o[i].Time) {
+				o[i].Time = r.Time
+			}
+			continue
+		}
+		first[r.Version] = len(o)
+		o = append(o, r)
+	}
+
+	sort.SliceStable(
+		o, func(i, j int) bool {
+			if o[i].Time.Equal(o[j].Time) {
+				return semver.Compare(o[i].Version, o[j].Version) < 0
+			}
+			return o[i].Time.Before(o[j].Time)
+		},
+	)
+	return o
+}
+
+// percentile returns the percentile p of the sorted values interpolated linearly between the closest ranks.
+func percentile(sorted []float64, p float64) float64 {
+	rank := p * float64(len(sorted)-1)
+	lo, hi := int(math.Floor(rank)), int(math.Ceil(rank))
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(rank-float64(lo))
+}
+
+// Compute defines the release cadence of the module given its versions and the time they were released.
+func Compute(v []Release, now time.Time) Stats {
+	rels := releases(v)
+
+	o := Stats{Releases: len(rels)}
+	if len(rels) == 0 {
+		return o
+	}
+
+	daysSinceLast := int64(now.Sub(rels[len(rels)-1].Time) / (24 * time.Hour))
+	o.DaysSinceLast = &daysSinceLast
+
+	yearAgo := now.AddDate(-1, 0, 0)
+
+	var (
+		intervals = make([]float64, 0, len(rels)-1)
+		highest   string
+	)
+	for i, r := range rels {
+		if r.Time.After(yearAgo) && !r.Time.After(now) {
+			o.ReleasesLast12Months++
+		}
+
+		if i > 0 {
+			intervals = append(intervals, r.Time.Sub(rels[i-1].Time).Hours()/24)
+		}
+
+		if highest != "" && semver.Compare(r.Version, highest) <= 0 {
+			continue
+		}
+
+		if highest != "" {
+			major, minor, _, okCur := udfsemver.Parts(r.Version)
+			majorPrev, minorPrev, _, okPrev := udfsemver.Parts(highest)
+			switch {
+			case !okCur || !okPrev:
+			case major > majorPrev:
+				o.MajorBumps++
+			case minor > minorPrev:
+				o.MinorBumps++
+			default:
+				o.PatchBumps++
+			}
+		}
+		highest = r.Version
+	}
+
+	if len(intervals) > 0 {
+		sort.Float64s(intervals)
+		median := math.Round(percentile(intervals, 0.5)*100) / 100
+		p90 := math.Round(percentile(intervals, 0.9)*100) / 100
+		o.MedianDaysBetween, o.P90DaysBetween = &median, &p90
+	}
+
+	return o
+}
+
+// args the arguments of the call: the array of versions and the array of the times they were released
+// as unix microseconds.
+type args []Release
+
+func (a *args) UnmarshalJSON(b []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if len(raw) != 2 {
+		return errors.New("2 arguments expected, got " + strconv.Itoa(len(raw)))
+	}
+
+	var (
+		versions   []string
+		timestamps []int64
+	)
+	if err := json.Unmarshal(raw[0], &versions); err != nil {
+		return errors.New("faulty versions: " + err.Error())
+	}
+	if err := json.Unmarshal(raw[1], &timestamps); err != nil {
+		return errors.New("faulty timestamps: " + err.Error())
+	}
+
+	if len(versions) != len(timestamps) {
+		return errors.New(
+			strconv.Itoa(len(versions)) + " versions and " + strconv.Itoa(len(timestamps)) +
+				" timestamps given, the arrays must be of equal length",
+		)
+	}
+
+	*a = make(args, len(versions))
+	for i, v := range versions {
+		(*a)[i] = Release{Version: v, Time: time.UnixMicro(timestamps[i]).UTC()}
+	}
+	return nil
+}
+
+// now returns the current time, it is overridden in tests.
+var now = time.Now
+
+var handler = remotefn.Handler[args]{
+	Call: func(_ context.Context, _ remotefn.Request, args args) (interface{}, error) {
+		return Compute(args, now().UTC()), nil
+	},
+}
+
+func init() {
+	functions.HTTP("cadence", handler.ServeHTTP)
+}
@@ -0,0 +1,167 @@
+package cadence
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func day(n int) time.Time {
+	return time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, n)
+}
+
+func float(v float64) *float64 {
+	return &v
+}
+
+func integer(v int64) *int64 {
+	return &v
+}
+
+func TestCompute(t *testing.T) {
+	tests := []struct {
+		name string
+		v    []Release
+		now  time.Time
+		want Stats
+	}{
+		{
+			name: "no releases",
+			v: []Release{
+				{Version: "v0.0.0-20220101120000-abcdef123456", Time: day(0)},
+				{Version: "v1.0.0-rc.1", Time: day(1)},
+				{Version: "foo", Time: day(2)},
+			},
+			now:  day(10),
+			want: Stats{},
+		},
+		{
+			name: "single release",
+			v:    []Release{{Version: "v1.0.0", Time: day(0)}},
+			now:  day(10).Add(time.Hour),
+			want: Stats{Releases: 1, DaysSinceLast: integer(10), ReleasesLast12Months: 1},
+		},
+		{
+			name: "releases with bumps",
+			v: []Release{
+				{Version: "v1.1.0", Time: day(10)},
+				{Version: "v1.0.0", Time: day(0)},
+				{Version: "v1.1.1", Time: day(12)},
+				{Version: "v2.0.0-rc.1", Time: day(13)},
+				{Version: "v2.0.0", Time: day(20)},
+				{Version: "v1.1.2", Time: day(21)},
+				{Version: "v2.0.1", Time: day(400)},
+				{Version: "v2.0.1", Time: day(401)},
+			},
+			now: day(410),
+			want: Stats{
+				Releases: 6,
+				// the days between releases: 1, 2, 8, 10, 379
+				MedianDaysBetween:    float(8),
+				P90DaysBetween:       float(231.4),
+				DaysSinceLast:        integer(10),
+				MajorBumps:           1,
+				MinorBumps:           1,
+				PatchBumps:           2,
+				ReleasesLast12Months: 1,
+			},
+		},
+		{
+			name: "incompatible major bump",
+			v: []Release{
+				{Version: "v1.0.0", Time: day(0)},
+				{Version: "v2.0.0+incompatible", Time: day(1)},
+			},
+			now: day(1),
+			want: Stats{
+				Releases:             2,
+				MedianDaysBetween:    float(1),
+				P90DaysBetween:       float(1),
+				DaysSinceLast:        integer(0),
+				MajorBumps:           1,
+				ReleasesLast12Months: 2,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got, _ := json.Marshal(Compute(tt.v, tt.now))
+				want, _ := json.Marshal(tt.want)
+				if string(got) != string(want) {
+					t.Errorf("Compute() = %s, want %s", got, want)
+				}
+			},
+		)
+	}
+}
+
+func Test_handler(t *testing.T) {
+	now = func() time.Time { return day(20) }
+	defer func() { now = time.Now }()
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name: "happy path",
+			body: `{"calls":[` +
+				`[["v1.0.0","v1.1.0"],[` + micros(day(0)) + `,` + micros(day(10)) + `]],` +
+				`[[],[]]]}`,
+			wantStatus: http.StatusOK,
+			wantBody: `{"replies":[` +
+				`{"releases":2,"median_days_between":10,"p90_days_between":10,"days_since_last":10,` +
+				`"major_bumps":0,"minor_bumps":1,"patch_bumps":0,"releases_last_12_months":2},` +
+				`{"releases":0,"median_days_between":null,"p90_days_between":null,"days_since_last":null,` +
+				`"major_bumps":0,"minor_bumps":0,"patch_bumps":0,"releases_last_12_months":0}]}`,
+		},
+		{
+			name:       "arrays of different length",
+			body:       `{"calls":[[["v1.0.0","v1.1.0"],[0]]]}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody: `{"errorMessage":"call 0: faulty arguments: ` +
+				`2 versions and 1 timestamps given, the arrays must be of equal length"}`,
+		},
+		{
+			name:       "wrong number of arguments",
+			body:       `{"calls":[[["v1.0.0"]]]}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"errorMessage":"call 0: faulty arguments: 2 arguments expected, got 1"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body)))
+
+				if w.Code != tt.wantStatus {
+					t.Errorf("handler() status = %v, want %v", w.Code, tt.wantStatus)
+				}
+
+				var got, want interface{}
+				if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+					t.Fatal(err)
+				}
+				if err := json.Unmarshal([]byte(tt.wantBody), &want); err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("handler() body = %s, want %s", w.Body.String(), tt.wantBody)
+				}
+			},
+		)
+	}
+}
+
+func micros(t time.Time) string {
+	b, _ := json.Marshal(t.UnixMicro())
+	return string(b)
+}
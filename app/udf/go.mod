@@ -1,4 +1,4 @@
-module github.com/kislerdm/gomodanalysis/app/pipeline/moduleversions
+module github.com/kislerdm/gomodanalysis/app/udf
 
 go 1.19
 
@@ -1,76 +1,215 @@
 package moduleversions
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
 	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/kislerdm/gomodanalysis/app/udf/remotefn"
+	udfsemver "github.com/kislerdm/gomodanalysis/app/udf/semver"
+	"golang.org/x/mod/module"
 	"golang.org/x/mod/semver"
-	"net/http"
+	"sort"
+	"time"
 )
 
-// Versions defines the struct for min and max versions.
+// Versions defines the summary of the package versions.
 type Versions struct {
+	// Min and Max the first and the last valid versions.
 	Min string `json:"version_min"`
 	Max string `json:"version_max"`
+
+	// LatestStable the highest valid version without prerelease suffix.
+	LatestStable string `json:"version_latest_stable"`
+
+	// LatestPrerelease the highest tagged prerelease version, the pseudo-versions are not considered.
+	LatestPrerelease string `json:"version_latest_prerelease"`
+
+	CntValid   int `json:"cnt_valid"`
+	CntInvalid int `json:"cnt_invalid"`
+
+	// CntIncompatible the number of +incompatible versions.
+	CntIncompatible int `json:"cnt_incompatible"`
+
+	// Majors the ordered set of major versions.
+	Majors []int64 `json:"majors"`
+
+	// Invalid the invalid versions excluded from the summary in the input's order.
+	Invalid []string `json:"invalid"`
 }
 
-// MinMaxVersions defines min and max semver of the package given array of its versions.
-func MinMaxVersions(v []string) Versions {
-	if len(v) == 0 {
+// splitValid splits the versions to the valid and the invalid ones, the input is not modified.
+func splitValid(v []string) (valid, invalid []string) {
+	for _, el := range v {
+		if !semver.IsValid(el) {
+			invalid = append(invalid, el)
+			continue
+		}
+		valid = append(valid, el)
+	}
+	return valid, invalid
+}
+
+// summarize defines the summary given the ordered valid versions and the invalid versions.
+func summarize(ordered, invalid []string) Versions {
+	if len(ordered) == 0 && len(invalid) == 0 {
 		return Versions{}
 	}
 
-	semver.Sort(v)
+	o := Versions{
+		CntValid:   len(ordered),
+		CntInvalid: len(invalid),
+		Invalid:    invalid,
+	}
 
-	return Versions{
-		Min: v[0],
-		Max: v[len(v)-1],
+	if len(ordered) > 0 {
+		o.Min = ordered[0]
+		o.Max = ordered[len(ordered)-1]
 	}
-}
 
-func newError(msg string) []byte {
-	o, _ := json.Marshal(map[string]string{"errorMessage": msg})
+	majors := map[int64]struct{}{}
+	for _, el := range ordered {
+		if semver.Build(el) == "+incompatible" {
+			o.CntIncompatible++
+		}
+
+		switch {
+		case semver.Prerelease(el) == "":
+			if o.LatestStable == "" || semver.Compare(el, o.LatestStable) > 0 {
+				o.LatestStable = el
+			}
+		case !module.IsPseudoVersion(el):
+			if o.LatestPrerelease == "" || semver.Compare(el, o.LatestPrerelease) > 0 {
+				o.LatestPrerelease = el
+			}
+		}
+
+		if major, _, _, ok := udfsemver.Parts(el); ok {
+			if _, ok := majors[major]; !ok {
+				majors[major] = struct{}{}
+				o.Majors = append(o.Majors, major)
+			}
+		}
+	}
+	sort.Slice(o.Majors, func(i, j int) bool { return o.Majors[i] < o.Majors[j] })
+
 	return o
 }
 
-type input struct {
-	Calls [][]string `json:"calls"`
+// MinMaxVersions defines the summary of the package versions given array of its versions ordered by semver.
+// The invalid versions are excluded and reported.
+func MinMaxVersions(v []string) Versions {
+	valid, invalid := splitValid(v)
+	semver.Sort(valid)
+	return summarize(valid, invalid)
 }
 
-type output struct {
-	Replies []Versions `json:"replies"`
-}
+// MinMaxVersionsByTime defines the summary of the package versions given array of its versions ordering
+// the pseudo-versions by commit time. The tagged versions are ordered by semver, the pseudo-versions by commit time.
+// The two sequences are merged so the pseudo-version follows the tag it is based on. The tags have no time,
+// so the pseudo-version without the base tag, e.g. v0.0.0-20230101120000-abcdef123456, is compared by time
+// to the latest pseudo-version based on a version lower than the tag: it follows the tag if committed later.
+// It precedes the tag if no such pseudo-version is given. The invalid versions are excluded and reported.
+func MinMaxVersionsByTime(v []string) Versions {
+	valid, invalid := splitValid(v)
 
-func handler(w http.ResponseWriter, req *http.Request) {
-	if req.Method == "POST" {
-		var buf bytes.Buffer
-		if _, err := buf.ReadFrom(req.Body); err != nil {
-			panic(err)
-		}
+	type pseudoVersion struct {
+		v    string
+		base string
+		t    time.Time
+	}
 
-		var in input
-		if err := json.Unmarshal(buf.Bytes(), &in); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			_, _ = w.Write(newError("unsupported in: corrupt JSON"))
-			return
+	var (
+		tagged []string
+		pseudo []pseudoVersion
+	)
+	for _, el := range valid {
+		if !module.IsPseudoVersion(el) {
+			tagged = append(tagged, el)
+			continue
 		}
+		base, _ := module.PseudoVersionBase(el)
+		t, _ := module.PseudoVersionTime(el)
+		pseudo = append(pseudo, pseudoVersion{v: el, base: base, t: t})
+	}
 
-		o := output{Replies: make([]Versions, len(in.Calls))}
+	semver.Sort(tagged)
+	sort.SliceStable(
+		pseudo, func(i, j int) bool {
+			if pseudo[i].t.Equal(pseudo[j].t) {
+				return semver.Compare(pseudo[i].v, pseudo[j].v) < 0
+			}
+			return pseudo[i].t.Before(pseudo[j].t)
+		},
+	)
 
-		for i, el := range in.Calls {
-			o.Replies[i] = MinMaxVersions(el)
+	// timeBelow returns the commit time of the latest pseudo-version based on a version lower than the tag.
+	all := pseudo
+	timeBelow := func(tag string) (time.Time, bool) {
+		var (
+			o  time.Time
+			ok bool
+		)
+		for _, p := range all {
+			if p.base != "" && semver.Compare(p.base, tag) < 0 && (!ok || p.t.After(o)) {
+				o, ok = p.t, true
+			}
 		}
+		return o, ok
+	}
 
-		r, err := json.Marshal(o)
-		if err != nil {
-			panic(err)
+	precedes := func(p pseudoVersion, tag string) bool {
+		if p.base != "" {
+			return semver.Compare(p.base, tag) < 0
 		}
+		t, ok := timeBelow(tag)
+		return !ok || !p.t.After(t)
+	}
 
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write(r)
+	o := make([]string, 0, len(valid))
+	for len(tagged) > 0 && len(pseudo) > 0 {
+		if precedes(pseudo[0], tagged[0]) {
+			o = append(o, pseudo[0].v)
+			pseudo = pseudo[1:]
+			continue
+		}
+		o = append(o, tagged[0])
+		tagged = tagged[1:]
 	}
+	o = append(o, tagged...)
+	for _, p := range pseudo {
+		o = append(o, p.v)
+	}
+
+	return summarize(o, invalid)
+}
+
+// minMaxByOrder returns the function defining min and max versions given the order set in the user defined context
+// with the key "order": "semver" (default), or "time", see MinMaxVersionsByTime.
+func minMaxByOrder(userDefinedContext map[string]string) (func([]string) Versions, error) {
+	switch order := userDefinedContext["order"]; order {
+	case "", "semver":
+		return MinMaxVersions, nil
+	case "time":
+		return MinMaxVersionsByTime, nil
+	default:
+		return nil, errors.New("unsupported order " + order + ", semver or time expected")
+	}
+}
+
+var handler = remotefn.Handler[[]string]{
+	Validate: func(req remotefn.Request) error {
+		_, err := minMaxByOrder(req.UserDefinedContext)
+		return err
+	},
+	Call: func(_ context.Context, req remotefn.Request, args []string) (interface{}, error) {
+		minMax, err := minMaxByOrder(req.UserDefinedContext)
+		if err != nil {
+			return nil, err
+		}
+		return minMax(args), nil
+	},
 }
 
 func init() {
-	functions.HTTP("moduleversions", handler)
+	functions.HTTP("moduleversions", handler.ServeHTTP)
 }
@@ -1,10 +1,9 @@
 package moduleversions
 
 import (
-	"bytes"
 	"encoding/json"
-	"io"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"strings"
 	"testing"
@@ -25,8 +24,11 @@ func TestMinMaxVersions(t *testing.T) {
 				[]string{"v1.0.0"},
 			},
 			want: Versions{
-				Min: "v1.0.0",
-				Max: "v1.0.0",
+				Min:          "v1.0.0",
+				Max:          "v1.0.0",
+				LatestStable: "v1.0.0",
+				CntValid:     1,
+				Majors:       []int64{1},
 			},
 		},
 		{
@@ -41,10 +43,38 @@ func TestMinMaxVersions(t *testing.T) {
 				},
 			},
 			want: Versions{
-				Min: "v1.0.4",
-				Max: "v1.1.23-0.20211004211129-b31d40d9a0be",
+				Min:          "v1.0.4",
+				Max:          "v1.1.23-0.20211004211129-b31d40d9a0be",
+				LatestStable: "v1.1.22",
+				CntValid:     11,
+				Majors:       []int64{1},
 			},
 		},
+		{
+			name: "prereleases, incompatible and invalid versions",
+			args: args{
+				[]string{
+					"master", "v2.0.0+incompatible", "v1.2.0", "v3.0.0-rc.1", "v3.0.0-beta.2",
+					"v0.0.0-20230101120000-abcdef123456", "1.0.0", "v2.1.0-0.20220101120000-abcdef123456+incompatible",
+				},
+			},
+			want: Versions{
+				Min:              "v0.0.0-20230101120000-abcdef123456",
+				Max:              "v3.0.0-rc.1",
+				LatestStable:     "v2.0.0+incompatible",
+				LatestPrerelease: "v3.0.0-rc.1",
+				CntValid:         6,
+				CntInvalid:       2,
+				CntIncompatible:  2,
+				Majors:           []int64{0, 1, 2, 3},
+				Invalid:          []string{"master", "1.0.0"},
+			},
+		},
+		{
+			name: "invalid versions only",
+			args: args{[]string{"foo", ""}},
+			want: Versions{CntInvalid: 2, Invalid: []string{"foo", ""}},
+		},
 		{
 			name: "empty input",
 			args: args{nil},
@@ -60,91 +90,213 @@ func TestMinMaxVersions(t *testing.T) {
 	}
 }
 
-type writer struct {
-	statusCode int
-	body       []byte
-}
-
-func (w writer) Header() http.Header {
-	return nil
-}
-
-func (w writer) Write(bytes []byte) (int, error) {
-	w.body = bytes
-	return 0, nil
-}
-
-func (w writer) WriteHeader(statusCode int) {
-	w.statusCode = statusCode
-}
-
-func Test_handler(t *testing.T) {
-	reqInput := func(i input) io.Reader {
-		o, err := json.Marshal(i)
-		if err != nil {
-			panic(err)
-		}
-		return bytes.NewReader(o)
-	}
-
-	respBody := func(o output) []byte {
-		return nil
-	}
-
-	mustReq := func(r *http.Request, err error) *http.Request {
-		if err != nil {
-			panic(err)
-		}
-		return r
+func TestMinMaxVersions_inputNotModified(t *testing.T) {
+	v := []string{"v1.1.0", "foo", "v1.0.0"}
+	_ = MinMaxVersions(v)
+	if want := []string{"v1.1.0", "foo", "v1.0.0"}; !reflect.DeepEqual(v, want) {
+		t.Errorf("MinMaxVersions() modified the input = %v, want %v", v, want)
 	}
+}
 
+func TestMinMaxVersionsByTime(t *testing.T) {
 	type args struct {
-		w   http.ResponseWriter
-		req *http.Request
+		v []string
 	}
-
 	tests := []struct {
 		name string
 		args args
+		want Versions
 	}{
 		{
-			name: "happy path",
+			name: "pseudo-versions ordered by commit time",
 			args: args{
-				w: writer{
-					statusCode: http.StatusOK,
-					body: respBody(output{Replies: []Versions{
-						{Min: "v1.0.0", Max: "v1.0.0"},
-						{Min: "v1.1.0", Max: "v1.1.23-0.20211004211129-b31d40d9a0be"},
-					}}),
+				[]string{
+					"v0.0.0-20230101120000-abcdef123456",
+					"v0.1.1-0.20190101120000-abcdef123456",
+					"v0.0.0-20200101120000-abcdef123456",
 				},
-				req: mustReq(
-					http.NewRequest("POST", "/",
-						reqInput(
-							input{
-								Calls: [][]string{
-									{"v1.0.0"},
-									{"v1.1.0", "v1.1.23-0.20211004211129-b31d40d9a0be", "v1.1.15"},
-								},
-							},
-						),
-					),
-				),
-			},
-		},
-		{
-			name: "faulty input json",
+			},
+			want: Versions{
+				Min:      "v0.1.1-0.20190101120000-abcdef123456",
+				Max:      "v0.0.0-20230101120000-abcdef123456",
+				CntValid: 3,
+				Majors:   []int64{0},
+			},
+		},
+		{
+			name: "pseudo-version follows its base tag",
+			args: args{
+				[]string{
+					"v1.1.22", "v1.1.19", "v1.0.4",
+					"v1.1.23-0.20211004211129-b31d40d9a0be",
+					"v0.0.0-20190101120000-abcdef123456",
+				},
+			},
+			want: Versions{
+				Min:          "v0.0.0-20190101120000-abcdef123456",
+				Max:          "v1.1.23-0.20211004211129-b31d40d9a0be",
+				LatestStable: "v1.1.22",
+				CntValid:     5,
+				Majors:       []int64{0, 1},
+			},
+		},
+		{
+			name: "pseudo-version without base tag committed after v1.0.0",
+			args: args{
+				[]string{
+					"v1.0.0", "v0.9.0",
+					"v0.0.0-20230101120000-abcdef123456",
+					"v0.9.1-0.20220101120000-abcdef123456",
+				},
+			},
+			want: Versions{
+				Min:          "v0.9.0",
+				Max:          "v0.0.0-20230101120000-abcdef123456",
+				LatestStable: "v1.0.0",
+				CntValid:     4,
+				Majors:       []int64{0, 1},
+			},
+		},
+		{
+			name: "pseudo-version without base tag committed before v1.0.0",
 			args: args{
-				w: writer{
-					statusCode: http.StatusBadRequest,
-					body:       newError("unsupported in: corrupt JSON"),
+				[]string{
+					"v1.0.0", "v0.9.0",
+					"v0.0.0-20210101120000-abcdef123456",
+					"v0.9.1-0.20220101120000-abcdef123456",
+					"v1.0.1-0.20220601120000-abcdef123456",
 				},
-				req: mustReq(http.NewRequest("POST", "/", strings.NewReader("{"))),
+			},
+			want: Versions{
+				Min:          "v0.0.0-20210101120000-abcdef123456",
+				Max:          "v1.0.1-0.20220601120000-abcdef123456",
+				LatestStable: "v1.0.0",
+				CntValid:     5,
+				Majors:       []int64{0, 1},
+			},
+		},
+		{
+			name: "tagged versions only",
+			args: args{[]string{"v1.1.0", "v1.0.0", "v2.0.0+incompatible"}},
+			want: Versions{
+				Min:             "v1.0.0",
+				Max:             "v2.0.0+incompatible",
+				LatestStable:    "v2.0.0+incompatible",
+				CntValid:        3,
+				CntIncompatible: 1,
+				Majors:          []int64{1, 2},
 			},
 		},
+		{
+			name: "invalid versions excluded",
+			args: args{[]string{"v0.0.0-20230101120000-abcdef123456", "latest"}},
+			want: Versions{
+				Min:        "v0.0.0-20230101120000-abcdef123456",
+				Max:        "v0.0.0-20230101120000-abcdef123456",
+				CntValid:   1,
+				CntInvalid: 1,
+				Majors:     []int64{0},
+				Invalid:    []string{"latest"},
+			},
+		},
+		{
+			name: "empty input",
+			args: args{nil},
+			want: Versions{},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			handler(tt.args.w, tt.args.req)
+			if got := MinMaxVersionsByTime(tt.args.v); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MinMaxVersionsByTime() = %v, want %v", got, tt.want)
+			}
 		})
 	}
 }
+
+func Test_handler(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name: "happy path",
+			body: `{"calls":[["v1.0.0"],` +
+				`["v1.1.0","v1.1.23-0.20211004211129-b31d40d9a0be","v1.1.15"]]}`,
+			wantStatus: http.StatusOK,
+			wantBody: `{"replies":[` +
+				`{"version_min":"v1.0.0","version_max":"v1.0.0","version_latest_stable":"v1.0.0",` +
+				`"version_latest_prerelease":"","cnt_valid":1,"cnt_invalid":0,"cnt_incompatible":0,` +
+				`"majors":[1],"invalid":null},` +
+				`{"version_min":"v1.1.0","version_max":"v1.1.23-0.20211004211129-b31d40d9a0be",` +
+				`"version_latest_stable":"v1.1.15","version_latest_prerelease":"","cnt_valid":3,"cnt_invalid":0,` +
+				`"cnt_incompatible":0,"majors":[1],"invalid":null}]}`,
+		},
+		{
+			name: "order by time",
+			body: `{"userDefinedContext":{"order":"time"},` +
+				`"calls":[["v0.0.0-20230101120000-abcdef123456","v0.1.1-0.20190101120000-abcdef123456"]]}`,
+			wantStatus: http.StatusOK,
+			wantBody: `{"replies":[{"version_min":"v0.1.1-0.20190101120000-abcdef123456",` +
+				`"version_max":"v0.0.0-20230101120000-abcdef123456","version_latest_stable":"",` +
+				`"version_latest_prerelease":"","cnt_valid":2,"cnt_invalid":0,"cnt_incompatible":0,` +
+				`"majors":[0],"invalid":null}]}`,
+		},
+		{
+			name:       "unsupported order",
+			body:       `{"userDefinedContext":{"order":"foo"},"calls":[["v1.0.0"]]}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"errorMessage":"unsupported order foo, semver or time expected"}`,
+		},
+		{
+			name:       "faulty call arguments",
+			body:       `{"calls":[["v1.0.0"],"v1.0.0"]}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody: `{"errorMessage":"call 1: faulty arguments: ` +
+				`json: cannot unmarshal string into Go value of type []string"}`,
+		},
+		{
+			name:       "faulty input json",
+			body:       `{`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"errorMessage":"unsupported input: corrupt JSON"}`,
+		},
+		{
+			name:       "unsupported method",
+			method:     http.MethodGet,
+			wantStatus: http.StatusMethodNotAllowed,
+			wantBody:   `{"errorMessage":"unsupported method GET"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				method := tt.method
+				if method == "" {
+					method = http.MethodPost
+				}
+
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, httptest.NewRequest(method, "/", strings.NewReader(tt.body)))
+
+				if w.Code != tt.wantStatus {
+					t.Errorf("handler() status = %v, want %v", w.Code, tt.wantStatus)
+				}
+
+				var got, want interface{}
+				if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+					t.Fatal(err)
+				}
+				if err := json.Unmarshal([]byte(tt.wantBody), &want); err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("handler() body = %s, want %s", w.Body.String(), tt.wantBody)
+				}
+			},
+		)
+	}
+}
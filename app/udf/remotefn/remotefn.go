@@ -0,0 +1,250 @@
+// Package remotefn implements the contract of the BigQuery remote functions,
+// see https://cloud.google.com/bigquery/docs/reference/standard-sql/remote-functions#input_format.
+package remotefn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// Request the request sent by BigQuery with the batch of calls.
+type Request struct {
+	RequestID          string            `json:"requestId"`
+	Caller             string            `json:"caller"`
+	SessionUser        string            `json:"sessionUser"`
+	UserDefinedContext map[string]string `json:"userDefinedContext"`
+
+	// Calls the arguments of every call.
+	Calls []json.RawMessage `json:"calls"`
+}
+
+type response struct {
+	Replies []interface{} `json:"replies"`
+}
+
+// Error the error returned with the HTTP status code.
+// BigQuery retries the requests failed with the codes 408, 429, 500, 503 and 504.
+type Error struct {
+	Code int
+	Err  error
+}
+
+func (e Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e Error) Unwrap() error {
+	return e.Err
+}
+
+// Internal marks the error of the call as the server error to be retried.
+// The other errors of the calls are the client errors, i.e. the faulty input.
+func Internal(err error) error {
+	return Error{Code: http.StatusInternalServerError, Err: err}
+}
+
+// Handler the remote function applying Call to every call's arguments decoded to T.
+type Handler[T any] struct {
+	// Validate validates the request before the calls, e.g. the user defined context, optional.
+	Validate func(req Request) error
+
+	// Call computes the reply to the call, the error fails the whole request.
+	Call func(ctx context.Context, req Request, args T) (interface{}, error)
+
+	// MaxBodyBytes the max size of the request, defaults to 10MB.
+	MaxBodyBytes int64
+
+	// Concurrency the max number of calls processed concurrently, defaults to the number of CPUs.
+	Concurrency int
+
+	// BatchSize the number of calls processed sequentially by the worker, defaults to 100.
+	// The requests with fewer calls are processed sequentially.
+	BatchSize int
+}
+
+// ServeHTTP processes the request and writes the replies in the order of the calls,
+// or the JSON error {"errorMessage": "..."} with the 4xx, or 5xx status code.
+func (h Handler[T]) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	defer func() {
+		if r := recover(); r != nil {
+			writeError(w, "", Error{Code: http.StatusInternalServerError, Err: errors.New("panic: " + fmt.Sprint(r))})
+		}
+	}()
+
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(
+			w, "", Error{Code: http.StatusMethodNotAllowed, Err: errors.New("unsupported method " + req.Method)},
+		)
+		return
+	}
+
+	maxBytes := h.MaxBodyBytes
+	if maxBytes <= 0 {
+		maxBytes = 10 << 20
+	}
+
+	var in Request
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxBytes)).Decode(&in); err != nil {
+		var errSize *http.MaxBytesError
+		if errors.As(err, &errSize) {
+			writeError(
+				w, "", Error{
+					Code: http.StatusRequestEntityTooLarge,
+					Err:  errors.New("request exceeds " + strconv.FormatInt(maxBytes, 10) + " bytes"),
+				},
+			)
+			return
+		}
+		writeError(w, "", Error{Code: http.StatusBadRequest, Err: errors.New("unsupported input: corrupt JSON")})
+		return
+	}
+
+	if in.Calls == nil {
+		writeError(w, in.RequestID, Error{Code: http.StatusBadRequest, Err: errors.New("calls must be set")})
+		return
+	}
+
+	if h.Validate != nil {
+		if err := h.Validate(in); err != nil {
+			writeError(w, in.RequestID, err)
+			return
+		}
+	}
+
+	replies, err := h.process(req.Context(), in)
+	if err != nil {
+		writeError(w, in.RequestID, err)
+		return
+	}
+
+	b, err := json.Marshal(response{Replies: replies})
+	if err != nil {
+		writeError(w, in.RequestID, Internal(errors.New("cannot encode replies: "+err.Error())))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(b)
+}
+
+// process applies Call to the calls concurrently in batches. It returns the error of the first failed call.
+func (h Handler[T]) process(ctx context.Context, in Request) ([]interface{}, error) {
+	batchSize := h.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	workers := h.Concurrency
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if n := (len(in.Calls) + batchSize - 1) / batchSize; n < workers {
+		workers = n
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		replies = make([]interface{}, len(in.Calls))
+		errs    = make([]error, len(in.Calls))
+		batches = make(chan int)
+		wg      sync.WaitGroup
+	)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for start := range batches {
+				for j := start; j < start+batchSize && j < len(in.Calls); j++ {
+					if ctx.Err() != nil {
+						return
+					}
+					if replies[j], errs[j] = h.call(ctx, in, j); errs[j] != nil {
+						cancel()
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(batches)
+		for start := 0; start < len(in.Calls); start += batchSize {
+			select {
+			case <-ctx.Done():
+				return
+			case batches <- start:
+			}
+		}
+	}()
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the request is cancelled before all calls are done, e.g. the client disconnected
+	if err := parent.Err(); err != nil {
+		return nil, Internal(errors.New("request cancelled: " + err.Error()))
+	}
+
+	return replies, nil
+}
+
+// call applies Call to the call i, the panic is recovered as the internal error.
+func (h Handler[T]) call(ctx context.Context, in Request, i int) (reply interface{}, err error) {
+	prefix := "call " + strconv.Itoa(i) + ": "
+
+	defer func() {
+		if r := recover(); r != nil {
+			reply, err = nil, Internal(errors.New(prefix+"panic: "+fmt.Sprint(r)))
+		}
+	}()
+
+	var args T
+	if err := json.Unmarshal(in.Calls[i], &args); err != nil {
+		return nil, Error{Code: http.StatusBadRequest, Err: errors.New(prefix + "faulty arguments: " + err.Error())}
+	}
+
+	o, err := h.Call(ctx, in, args)
+	if err != nil {
+		var e Error
+		if errors.As(err, &e) {
+			return nil, Error{Code: e.Code, Err: errors.New(prefix + err.Error())}
+		}
+		return nil, Error{Code: http.StatusBadRequest, Err: errors.New(prefix + err.Error())}
+	}
+	return o, nil
+}
+
+// writeError writes the error, the errors other than Error are the client errors.
+func writeError(w http.ResponseWriter, requestID string, err error) {
+	code := http.StatusBadRequest
+	var e Error
+	if errors.As(err, &e) {
+		code = e.Code
+	}
+
+	log.Printf("request %s failed with status %d: %v", requestID, code, err)
+
+	b, _ := json.Marshal(map[string]string{"errorMessage": err.Error()})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_, _ = w.Write(b)
+}
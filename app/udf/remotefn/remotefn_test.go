@@ -0,0 +1,203 @@
+package remotefn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestHandler_ServeHTTP(t *testing.T) {
+	square := Handler[[]int]{
+		Validate: func(req Request) error {
+			if req.UserDefinedContext["mode"] == "foo" {
+				return errors.New("unsupported mode foo")
+			}
+			return nil
+		},
+		Call: func(_ context.Context, _ Request, args []int) (interface{}, error) {
+			switch {
+			case len(args) != 1:
+				return nil, errors.New("1 argument expected")
+			case args[0] < 0:
+				panic("negative")
+			case args[0] == 0:
+				return nil, Internal(errors.New("zero"))
+			}
+			return args[0] * args[0], nil
+		},
+		MaxBodyBytes: 100,
+	}
+
+	tests := []struct {
+		name       string
+		handler    Handler[[]int]
+		method     string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "happy path",
+			handler:    square,
+			body:       `{"requestId":"foo","calls":[[1],[2],[3]]}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"replies":[1,4,9]}`,
+		},
+		{
+			name:       "no calls",
+			handler:    square,
+			body:       `{"calls":[]}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"replies":[]}`,
+		},
+		{
+			name:       "unsupported method",
+			handler:    square,
+			method:     http.MethodGet,
+			wantStatus: http.StatusMethodNotAllowed,
+			wantBody:   `{"errorMessage":"unsupported method GET"}`,
+		},
+		{
+			name:       "request too large",
+			handler:    square,
+			body:       `{"calls":[` + strings.Repeat(`[1],`, 30) + `[1]]}`,
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantBody:   `{"errorMessage":"request exceeds 100 bytes"}`,
+		},
+		{
+			name:       "corrupt json",
+			handler:    square,
+			body:       `{`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"errorMessage":"unsupported input: corrupt JSON"}`,
+		},
+		{
+			name:       "calls not set",
+			handler:    square,
+			body:       `{"requestId":"foo"}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"errorMessage":"calls must be set"}`,
+		},
+		{
+			name:       "faulty user defined context",
+			handler:    square,
+			body:       `{"userDefinedContext":{"mode":"foo"},"calls":[[1]]}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"errorMessage":"unsupported mode foo"}`,
+		},
+		{
+			name:       "faulty call arguments",
+			handler:    square,
+			body:       `{"calls":[[1],{"a":1}]}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody: `{"errorMessage":"call 1: faulty arguments: ` +
+				`json: cannot unmarshal object into Go value of type []int"}`,
+		},
+		{
+			name:       "call error",
+			handler:    square,
+			body:       `{"calls":[[1],[1,2]]}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"errorMessage":"call 1: 1 argument expected"}`,
+		},
+		{
+			name:       "call internal error",
+			handler:    square,
+			body:       `{"calls":[[0]]}`,
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   `{"errorMessage":"call 0: zero"}`,
+		},
+		{
+			name:       "call panic",
+			handler:    square,
+			body:       `{"calls":[[1],[-1]]}`,
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   `{"errorMessage":"call 1: panic: negative"}`,
+		},
+		{
+			name: "validate panic",
+			handler: Handler[[]int]{
+				Validate: func(Request) error { panic("foo") },
+				Call:     square.Call,
+			},
+			body:       `{"calls":[[1]]}`,
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   `{"errorMessage":"panic: foo"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				method := tt.method
+				if method == "" {
+					method = http.MethodPost
+				}
+
+				w := httptest.NewRecorder()
+				tt.handler.ServeHTTP(w, httptest.NewRequest(method, "/", strings.NewReader(tt.body)))
+
+				if w.Code != tt.wantStatus {
+					t.Errorf("ServeHTTP() status = %v, want %v", w.Code, tt.wantStatus)
+				}
+				if got := w.Header().Get("Content-Type"); got != "application/json" {
+					t.Errorf("ServeHTTP() Content-Type = %v, want application/json", got)
+				}
+
+				var got, want interface{}
+				if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+					t.Fatal(err)
+				}
+				if err := json.Unmarshal([]byte(tt.wantBody), &want); err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("ServeHTTP() body = %s, want %s", w.Body.String(), tt.wantBody)
+				}
+			},
+		)
+	}
+}
+
+func TestHandler_ServeHTTP_concurrent(t *testing.T) {
+	h := Handler[[]int]{
+		Call: func(_ context.Context, _ Request, args []int) (interface{}, error) {
+			return args[0] + 1, nil
+		},
+		Concurrency: 4,
+		BatchSize:   3,
+	}
+
+	const n = 1000
+
+	calls := make([]string, n)
+	want := make([]interface{}, n)
+	for i := range calls {
+		calls[i] = "[" + strconv.Itoa(i) + "]"
+		want[i] = float64(i + 1)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(
+		w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"calls":[`+strings.Join(calls, ",")+`]}`)),
+	)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("ServeHTTP() status = %v, want %v: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	var got struct {
+		Replies []interface{} `json:"replies"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Replies, want) {
+		t.Errorf("ServeHTTP() replies are not in the order of the calls")
+	}
+}
@@ -0,0 +1,80 @@
+package semver
+
+import (
+	"errors"
+	"time"
+
+	"golang.org/x/mod/module"
+	modsemver "golang.org/x/mod/semver"
+)
+
+// Kind the kind of the module version.
+type Kind string
+
+const (
+	// KindTagged the version tagged in the module's repository, e.g. v1.2.3.
+	KindTagged Kind = "tagged"
+
+	// KindPseudo the pseudo-version of the untagged commit, e.g. v0.0.0-20220101120000-abcdef123456.
+	KindPseudo Kind = "pseudo"
+
+	// KindIncompatible the tagged version of the major version 2, or higher of the module without go.mod,
+	// e.g. v2.0.0+incompatible.
+	KindIncompatible Kind = "incompatible"
+
+	KindInvalid Kind = "invalid"
+)
+
+// Classify returns the kind of the version. The pseudo-version is classified as KindPseudo
+// even if it is +incompatible.
+func Classify(v string) Kind {
+	switch {
+	case !modsemver.IsValid(v):
+		return KindInvalid
+	case module.IsPseudoVersion(v):
+		return KindPseudo
+	case modsemver.Build(v) == "+incompatible":
+		return KindIncompatible
+	default:
+		return KindTagged
+	}
+}
+
+// Pseudo the decoded pseudo-version.
+type Pseudo struct {
+	// Base the version the pseudo-version is based on, e.g. v1.2.3 for v1.2.4-0.20220101120000-abcdef123456,
+	// or empty string if the commit has no tagged ancestor, e.g. for v0.0.0-20220101120000-abcdef123456.
+	Base string `json:"base"`
+
+	// Time the commit time.
+	Time time.Time `json:"time"`
+
+	// Revision the commit hash prefix.
+	Revision string `json:"revision"`
+}
+
+// ErrNotPseudo the error returned when the version is not the pseudo-version.
+var ErrNotPseudo = errors.New("not a pseudo-version")
+
+// DecodePseudo decodes the pseudo-version.
+func DecodePseudo(v string) (Pseudo, error) {
+	if !module.IsPseudoVersion(v) {
+		return Pseudo{}, ErrNotPseudo
+	}
+
+	var (
+		o   Pseudo
+		err error
+	)
+	if o.Base, err = module.PseudoVersionBase(v); err != nil {
+		return Pseudo{}, err
+	}
+	if o.Time, err = module.PseudoVersionTime(v); err != nil {
+		return Pseudo{}, err
+	}
+	if o.Revision, err = module.PseudoVersionRev(v); err != nil {
+		return Pseudo{}, err
+	}
+
+	return o, nil
+}
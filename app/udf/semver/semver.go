@@ -0,0 +1,286 @@
+package semver
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/kislerdm/gomodanalysis/app/udf/remotefn"
+	modsemver "golang.org/x/mod/semver"
+)
+
+// Parts returns the major, minor and patch numbers of the valid version, e.g. 1, 2, 0 for v1.2.
+func Parts(v string) (major, minor, patch int64, ok bool) {
+	c := modsemver.Canonical(v)
+	if c == "" {
+		return 0, 0, 0, false
+	}
+
+	els := strings.Split(strings.TrimSuffix(c[1:], modsemver.Prerelease(c)), ".")
+	if len(els) != 3 {
+		return 0, 0, 0, false
+	}
+
+	var o [3]int64
+	for i, el := range els {
+		n, err := strconv.ParseInt(el, 10, 64)
+		if err != nil {
+			return 0, 0, 0, false
+		}
+		o[i] = n
+	}
+
+	return o[0], o[1], o[2], true
+}
+
+// comparator the version compared with the operator, e.g. >=v1.2.0.
+type comparator struct {
+	op string
+	v  string
+}
+
+func (c comparator) match(v string) bool {
+	cmp := modsemver.Compare(v, c.v)
+	switch c.op {
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case "!=":
+		return cmp != 0
+	default:
+		return cmp == 0
+	}
+}
+
+// parseConstraint parses the constraint: the ranges joined by "||", every range is the list of comparators
+// separated by commas, or spaces, e.g. ">=v1.2.0, <v2 || v3.0.0". The comparator's operator is one of
+// =, !=, >, >=, <, <=, the version without operator must be equal.
+func parseConstraint(s string) ([][]comparator, error) {
+	var o [][]comparator
+	for _, r := range strings.Split(s, "||") {
+		var cmps []comparator
+		for _, el := range strings.FieldsFunc(r, func(c rune) bool { return c == ',' || c == ' ' }) {
+			i := strings.IndexByte(el, 'v')
+			if i < 0 {
+				return nil, errors.New("faulty version " + el + " in constraint " + s)
+			}
+			c := comparator{op: el[:i], v: el[i:]}
+
+			switch c.op {
+			case "", "=", "!=", ">", ">=", "<", "<=":
+			default:
+				return nil, errors.New("faulty operator " + c.op + " in constraint " + s)
+			}
+			if !modsemver.IsValid(c.v) {
+				return nil, errors.New("faulty version " + c.v + " in constraint " + s)
+			}
+
+			cmps = append(cmps, c)
+		}
+
+		if len(cmps) == 0 {
+			return nil, errors.New("empty range in constraint " + s)
+		}
+		o = append(o, cmps)
+	}
+	return o, nil
+}
+
+// Satisfies reports whether the version satisfies the constraint, see parseConstraint.
+// The invalid version does not satisfy any constraint.
+func Satisfies(v, constraint string) (bool, error) {
+	ranges, err := parseConstraint(constraint)
+	if err != nil {
+		return false, err
+	}
+
+	if !modsemver.IsValid(v) {
+		return false, nil
+	}
+
+	for _, r := range ranges {
+		ok := true
+		for _, c := range r {
+			if !c.match(v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// operation the function called with the arguments of the call.
+// The reply is null if any argument is null, or if any version argument is invalid.
+type operation struct {
+	// versions the number of the leading arguments which must be valid versions
+	versions int
+	nargs    int
+	fn       func(args []string) (interface{}, error)
+}
+
+var operations = map[string]operation{
+	"is_valid": {
+		nargs: 1,
+		fn: func(args []string) (interface{}, error) {
+			return modsemver.IsValid(args[0]), nil
+		},
+	},
+	"compare": {
+		versions: 2,
+		nargs:    2,
+		fn: func(args []string) (interface{}, error) {
+			return modsemver.Compare(args[0], args[1]), nil
+		},
+	},
+	"canonical": {
+		versions: 1,
+		nargs:    1,
+		fn: func(args []string) (interface{}, error) {
+			return modsemver.Canonical(args[0]), nil
+		},
+	},
+	"major": {
+		versions: 1,
+		nargs:    1,
+		fn: func(args []string) (interface{}, error) {
+			return part(args[0], 0), nil
+		},
+	},
+	"minor": {
+		versions: 1,
+		nargs:    1,
+		fn: func(args []string) (interface{}, error) {
+			return part(args[0], 1), nil
+		},
+	},
+	"patch": {
+		versions: 1,
+		nargs:    1,
+		fn: func(args []string) (interface{}, error) {
+			return part(args[0], 2), nil
+		},
+	},
+	"prerelease": {
+		versions: 1,
+		nargs:    1,
+		fn: func(args []string) (interface{}, error) {
+			return modsemver.Prerelease(args[0]), nil
+		},
+	},
+	"build": {
+		versions: 1,
+		nargs:    1,
+		fn: func(args []string) (interface{}, error) {
+			return modsemver.Build(args[0]), nil
+		},
+	},
+	"kind": {
+		nargs: 1,
+		fn: func(args []string) (interface{}, error) {
+			return Classify(args[0]), nil
+		},
+	},
+	"pseudo_base": {
+		versions: 1,
+		nargs:    1,
+		fn: func(args []string) (interface{}, error) {
+			p, err := DecodePseudo(args[0])
+			if err != nil {
+				return nil, nil
+			}
+			return p.Base, nil
+		},
+	},
+	"pseudo_time": {
+		versions: 1,
+		nargs:    1,
+		fn: func(args []string) (interface{}, error) {
+			p, err := DecodePseudo(args[0])
+			if err != nil {
+				return nil, nil
+			}
+			return p.Time.Format(time.RFC3339), nil
+		},
+	},
+	"pseudo_revision": {
+		versions: 1,
+		nargs:    1,
+		fn: func(args []string) (interface{}, error) {
+			p, err := DecodePseudo(args[0])
+			if err != nil {
+				return nil, nil
+			}
+			return p.Revision, nil
+		},
+	},
+	"satisfies": {
+		versions: 1,
+		nargs:    2,
+		fn: func(args []string) (interface{}, error) {
+			return Satisfies(args[0], args[1])
+		},
+	},
+}
+
+// part returns the major, minor, or patch number given its index, or nil if the number overflows int64.
+func part(v string, i int) interface{} {
+	major, minor, patch, ok := Parts(v)
+	if !ok {
+		return nil
+	}
+	return [3]int64{major, minor, patch}[i]
+}
+
+func (op operation) call(args []*string) (interface{}, error) {
+	if len(args) != op.nargs {
+		return nil, errors.New(strconv.Itoa(op.nargs) + " arguments expected, got " + strconv.Itoa(len(args)))
+	}
+
+	vals := make([]string, len(args))
+	for i, a := range args {
+		if a == nil {
+			return nil, nil
+		}
+		if i < op.versions && !modsemver.IsValid(*a) {
+			return nil, nil
+		}
+		vals[i] = *a
+	}
+
+	return op.fn(vals)
+}
+
+var handler = remotefn.Handler[[]*string]{
+	Validate: func(req remotefn.Request) error {
+		name := req.UserDefinedContext["operation"]
+		if _, ok := operations[name]; !ok {
+			return errors.New("unknown operation '" + name + "' set in userDefinedContext")
+		}
+		return nil
+	},
+	Call: func(_ context.Context, req remotefn.Request, args []*string) (interface{}, error) {
+		name := req.UserDefinedContext["operation"]
+		o, err := operations[name].call(args)
+		if err != nil {
+			return nil, errors.New(name + ": " + err.Error())
+		}
+		return o, nil
+	},
+}
+
+func init() {
+	functions.HTTP("semver", handler.ServeHTTP)
+}
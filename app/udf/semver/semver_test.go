@@ -0,0 +1,267 @@
+package semver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParts(t *testing.T) {
+	tests := []struct {
+		v      string
+		want   [3]int64
+		wantOk bool
+	}{
+		{v: "v1.2.3", want: [3]int64{1, 2, 3}, wantOk: true},
+		{v: "v1.2", want: [3]int64{1, 2, 0}, wantOk: true},
+		{v: "v2.0.0-rc.1+build", want: [3]int64{2, 0, 0}, wantOk: true},
+		{v: "v0.0.0-20220101120000-abcdef123456", want: [3]int64{0, 0, 0}, wantOk: true},
+		{v: "v1.0.0+incompatible", want: [3]int64{1, 0, 0}, wantOk: true},
+		{v: "v99999999999999999999.0.0"},
+		{v: "1.2.3"},
+		{v: "foo"},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.v, func(t *testing.T) {
+				major, minor, patch, ok := Parts(tt.v)
+				if ok != tt.wantOk {
+					t.Fatalf("Parts() ok = %v, want %v", ok, tt.wantOk)
+				}
+				if got := [3]int64{major, minor, patch}; got != tt.want {
+					t.Errorf("Parts() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestSatisfies(t *testing.T) {
+	tests := []struct {
+		name       string
+		v          string
+		constraint string
+		want       bool
+		wantErr    bool
+	}{
+		{name: "equal", v: "v1.2.0", constraint: "v1.2", want: true},
+		{name: "range", v: "v1.5.0", constraint: ">=v1.2.0, <v2", want: true},
+		{name: "range with spaces", v: "v2.0.0", constraint: ">=v1.2.0 <v2", want: false},
+		{name: "prerelease is before release", v: "v2.0.0-rc.1", constraint: ">=v1.2.0, <v2", want: true},
+		{name: "alternatives", v: "v3.0.0", constraint: ">=v1.2.0, <v2 || =v3.0.0", want: true},
+		{name: "not equal", v: "v1.0.0", constraint: "!=v1.0.0", want: false},
+		{name: "invalid version", v: "foo", constraint: ">v1.0.0", want: false},
+		{name: "faulty operator", v: "v1.0.0", constraint: "=>v1.0.0", wantErr: true},
+		{name: "faulty version", v: "v1.0.0", constraint: ">=1.0.0", wantErr: true},
+		{name: "empty range", v: "v1.0.0", constraint: ">=v1.0.0 ||", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got, err := Satisfies(tt.v, tt.constraint)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("Satisfies() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if got != tt.want {
+					t.Errorf("Satisfies() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func Test_handler(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name: "compare",
+			body: `{"requestId":"1","userDefinedContext":{"operation":"compare"},` +
+				`"calls":[["v1.0.0","v1.1.0"],["v2.0.0","v1.1.0"],["foo","v1.0.0"],[null,"v1.0.0"]]}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"replies":[-1,1,null,null]}`,
+		},
+		{
+			name:       "major",
+			body:       `{"userDefinedContext":{"operation":"major"},"calls":[["v2.1.0"],["foo"]]}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"replies":[2,null]}`,
+		},
+		{
+			name:       "prerelease and build",
+			body:       `{"userDefinedContext":{"operation":"prerelease"},"calls":[["v2.1.0-rc.1+meta"],["v2.1.0"]]}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"replies":["-rc.1",""]}`,
+		},
+		{
+			name:       "canonical",
+			body:       `{"userDefinedContext":{"operation":"canonical"},"calls":[["v1.2"],["v1.2.3+meta"]]}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"replies":["v1.2.0","v1.2.3"]}`,
+		},
+		{
+			name:       "is_valid",
+			body:       `{"userDefinedContext":{"operation":"is_valid"},"calls":[["v1.2"],["1.2"]]}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"replies":[true,false]}`,
+		},
+		{
+			name:       "satisfies",
+			body:       `{"userDefinedContext":{"operation":"satisfies"},"calls":[["v1.2.0",">=v1, <v2"],["v2.0.0",">=v1, <v2"]]}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"replies":[true,false]}`,
+		},
+		{
+			name: "kind",
+			body: `{"userDefinedContext":{"operation":"kind"},` +
+				`"calls":[["v1.0.0"],["v2.0.0+incompatible"],["v0.0.0-20220101120000-abcdef123456"],["foo"]]}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"replies":["tagged","incompatible","pseudo","invalid"]}`,
+		},
+		{
+			name: "pseudo-version time",
+			body: `{"userDefinedContext":{"operation":"pseudo_time"},` +
+				`"calls":[["v1.2.4-0.20220101120000-abcdef123456"],["v1.2.4"]]}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"replies":["2022-01-01T12:00:00Z",null]}`,
+		},
+		{
+			name: "pseudo-version base",
+			body: `{"userDefinedContext":{"operation":"pseudo_base"},` +
+				`"calls":[["v1.2.4-0.20220101120000-abcdef123456"],["v0.0.0-20220101120000-abcdef123456"]]}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"replies":["v1.2.3",""]}`,
+		},
+		{
+			name:       "faulty constraint",
+			body:       `{"userDefinedContext":{"operation":"satisfies"},"calls":[["v1.2.0","~v1"]]}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"errorMessage":"call 0: satisfies: faulty operator ~ in constraint ~v1"}`,
+		},
+		{
+			name:       "wrong number of arguments",
+			body:       `{"userDefinedContext":{"operation":"compare"},"calls":[["v1.2.0"]]}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"errorMessage":"call 0: compare: 2 arguments expected, got 1"}`,
+		},
+		{
+			name:       "unknown operation",
+			body:       `{"calls":[["v1.2.0"]]}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"errorMessage":"unknown operation '' set in userDefinedContext"}`,
+		},
+		{
+			name:       "faulty input json",
+			body:       `{`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"errorMessage":"unsupported input: corrupt JSON"}`,
+		},
+		{
+			name:       "unsupported method",
+			method:     http.MethodGet,
+			wantStatus: http.StatusMethodNotAllowed,
+			wantBody:   `{"errorMessage":"unsupported method GET"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				method := tt.method
+				if method == "" {
+					method = http.MethodPost
+				}
+
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, httptest.NewRequest(method, "/", strings.NewReader(tt.body)))
+
+				if w.Code != tt.wantStatus {
+					t.Errorf("handler() status = %v, want %v", w.Code, tt.wantStatus)
+				}
+
+				var got, want interface{}
+				if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+					t.Fatal(err)
+				}
+				if err := json.Unmarshal([]byte(tt.wantBody), &want); err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("handler() body = %s, want %s", w.Body.String(), tt.wantBody)
+				}
+			},
+		)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		v    string
+		want Kind
+	}{
+		{v: "v1.2.3", want: KindTagged},
+		{v: "v1.2.3-rc.1", want: KindTagged},
+		{v: "v2.0.0+incompatible", want: KindIncompatible},
+		{v: "v0.0.0-20220101120000-abcdef123456", want: KindPseudo},
+		{v: "v1.2.4-0.20220101120000-abcdef123456", want: KindPseudo},
+		{v: "v1.2.3-pre.0.20220101120000-abcdef123456", want: KindPseudo},
+		{v: "v2.0.1-0.20220101120000-abcdef123456+incompatible", want: KindPseudo},
+		{v: "1.2.3", want: KindInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.v, func(t *testing.T) {
+				if got := Classify(tt.v); got != tt.want {
+					t.Errorf("Classify() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestDecodePseudo(t *testing.T) {
+	ts := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		v       string
+		want    Pseudo
+		wantErr bool
+	}{
+		{
+			v:    "v0.0.0-20220101120000-abcdef123456",
+			want: Pseudo{Time: ts, Revision: "abcdef123456"},
+		},
+		{
+			v:    "v1.2.4-0.20220101120000-abcdef123456",
+			want: Pseudo{Base: "v1.2.3", Time: ts, Revision: "abcdef123456"},
+		},
+		{
+			v:    "v1.2.3-pre.0.20220101120000-abcdef123456",
+			want: Pseudo{Base: "v1.2.3-pre", Time: ts, Revision: "abcdef123456"},
+		},
+		{
+			v:       "v1.2.3",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.v, func(t *testing.T) {
+				got, err := DecodePseudo(tt.v)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("DecodePseudo() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("DecodePseudo() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,9 @@
+// Package udf is the root package of the BigQuery remote functions to deploy them from a single module.
+// The function is selected by the env variable FUNCTION_TARGET, e.g. FUNCTION_TARGET=semver.
+package udf
+
+import (
+	_ "github.com/kislerdm/gomodanalysis/app/udf/cadence"
+	_ "github.com/kislerdm/gomodanalysis/app/udf/moduleversions"
+	_ "github.com/kislerdm/gomodanalysis/app/udf/semver"
+)
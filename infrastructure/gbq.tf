@@ -24,28 +24,8 @@ resource "google_bigquery_table" "index" {
 
   deletion_protection = false
 
-  schema = <<EOF
-[
-  {
-    "name": "path",
-    "type": "STRING",
-    "mode": "REQUIRED",
-    "description": "The module path"
-  },
-  {
-    "name": "version",
-    "type": "STRING",
-    "mode": "REQUIRED",
-    "description": "The module version"
-  },
-  {
-    "name": "timestamp",
-    "type": "TIMESTAMP",
-    "mode": "REQUIRED",
-    "description": "Time the version was first cached by proxy.golang.org"
-  }
-]
-EOF
+  # generated from the proto definitions, see app/pipeline/schema
+  schema = file("${path.module}/schema/index.json")
 }
 
 resource "google_bigquery_table" "index_stat" {
@@ -93,110 +73,8 @@ resource "google_bigquery_table" "pkggodev" {
 
   deletion_protection = false
 
-  schema = <<EOF
-[
-  {
-    "name": "path",
-    "type": "STRING",
-    "mode": "REQUIRED",
-    "description": "The module path"
-  },
-  {
-    "name": "version",
-    "type": "STRING",
-    "mode": "REQUIRED",
-    "description": "The module version"
-  },
-  {
-    "name": "meta",
-    "type": "RECORD",
-    "mode": "REQUIRED",
-    "description": "Meta data of the given module",
-    "fields": [
-      {
-        "name": "license",
-        "type": "STRING",
-        "mode": "REQUIRED",
-        "description": "The license under which the module is distributed"
-      },
-      {
-        "name": "repository",
-        "type": "STRING",
-        "mode": "REQUIRED",
-        "description": "Repo with the module's codebase"
-      },
-      {
-        "name": "is_module",
-        "type": "BOOLEAN",
-        "mode": "REQUIRED",
-        "description": "Flags if the package is a module"
-      },
-      {
-        "name": "is_latest_version",
-        "type": "BOOLEAN",
-        "mode": "REQUIRED",
-        "description": "Flags if it is the latest version of the module"
-      },
-      {
-        "name": "is_valid_go_mod",
-        "type": "BOOLEAN",
-        "mode": "REQUIRED",
-        "description": "Flags if the module has a valid go.mod"
-      },
-      {
-        "name": "with_redistributable_license",
-        "type": "BOOLEAN",
-        "mode": "REQUIRED",
-        "description": "Flags if the module is distributed under the redistributable license"
-      },
-      {
-        "name": "is_tagged_version",
-        "type": "BOOLEAN",
-        "mode": "REQUIRED",
-        "description": "Flags if the module is tagged"
-      },
-      {
-        "name": "is_stable_version",
-        "type": "BOOLEAN",
-        "mode": "REQUIRED",
-        "description": "Flags if the version is stable, i.e. at least 1.0.0"
-      }
-    ]
-  },
-  {
-    "name": "imports",
-    "type": "RECORD",
-    "mode": "REQUIRED",
-    "description": "The dependencies of the given module",
-    "fields": [
-      {
-        "name": "std",
-        "type": "STRING",
-        "mode": "REPEATED",
-        "description": "The std libraries imported as dependencies by the given module"
-      },
-      {
-        "name": "nonstd",
-        "type": "STRING",
-        "mode": "REPEATED",
-        "description": "The non-std libraries imported as dependencies by the given module"
-      }
-    ]
-  },
-  {
-    "name": "importedby",
-    "type": "STRING",
-    "mode": "REPEATED",
-    "description": "The modules which use the give on as dependency"
-  },
-  {
-    "name": "timestamp",
-    "type": "TIMESTAMP",
-    "mode": "REQUIRED",
-    "description": "Time the version was first cached by proxy.golang.org"
-  }
-]
-EOF
+  # generated from the proto definitions, see app/pipeline/schema
+  schema = file("${path.module}/schema/pkggodev.json")
 }
 
 resource "google_bigquery_table" "pkggodev_remain" {
@@ -227,3 +105,95 @@ resource "google_bigquery_table" "pkggodev_remain" {
     ])
   }
 }
+
+resource "google_bigquery_table" "pkggodev_pages" {
+  dataset_id    = google_bigquery_dataset.raw.dataset_id
+  project       = google_bigquery_dataset.raw.project
+  table_id      = "pkggodev_pages"
+  friendly_name = "pkggodev_pages"
+  description   = "Raw pages fetched from https://pkg.go.dev/"
+
+  time_partitioning {
+    type          = "DAY"
+    expiration_ms = 0
+  }
+
+  clustering = ["sha256"]
+
+  deletion_protection = false
+
+  # generated from the proto definitions, see app/pipeline/schema
+  schema = file("${path.module}/schema/pkggodev_pages.json")
+}
+
+resource "google_bigquery_table" "pkggodev_deadletters" {
+  dataset_id    = google_bigquery_dataset.raw.dataset_id
+  project       = google_bigquery_dataset.raw.project
+  table_id      = "pkggodev_deadletters"
+  friendly_name = "pkggodev_deadletters"
+  description   = "Failed extractions of the module's sections from https://pkg.go.dev/, the latest row per section defines its state"
+
+  time_partitioning {
+    type          = "DAY"
+    expiration_ms = 0
+  }
+
+  deletion_protection = false
+
+  # generated from the proto definitions, see app/pipeline/schema
+  schema = file("${path.module}/schema/pkggodev_deadletters.json")
+}
+
+resource "google_bigquery_table" "release_cadence" {
+  dataset_id    = google_bigquery_dataset.raw.dataset_id
+  project       = google_bigquery_dataset.raw.project
+  table_id      = "release_cadence"
+  friendly_name = "release_cadence"
+  description   = "Release cadence of the modules aggregated from the index table, the latest row per module is current"
+
+  time_partitioning {
+    type          = "DAY"
+    expiration_ms = 0
+  }
+
+  deletion_protection = false
+
+  # generated from the proto definitions, see app/pipeline/schema
+  schema = file("${path.module}/schema/release_cadence.json")
+}
+
+resource "google_bigquery_table" "module_repository" {
+  dataset_id    = google_bigquery_dataset.raw.dataset_id
+  project       = google_bigquery_dataset.raw.project
+  table_id      = "module_repository"
+  friendly_name = "module_repository"
+  description   = "Repositories of the modules enriched from the pkggodev table, the latest row per module is current"
+
+  time_partitioning {
+    type          = "DAY"
+    expiration_ms = 0
+  }
+
+  deletion_protection = false
+
+  # generated from the proto definitions, see app/pipeline/schema
+  schema = file("${path.module}/schema/module_repository.json")
+}
+
+resource "google_bigquery_table" "module_graph" {
+  dataset_id    = google_bigquery_dataset.raw.dataset_id
+  project       = google_bigquery_dataset.raw.project
+  table_id      = "module_graph"
+  friendly_name = "module_graph"
+  description   = "Dependency graph of the modules built from the pkggodev table, the latest rows per module's version are current"
+
+  time_partitioning {
+    type          = "DAY"
+    expiration_ms = 0
+  }
+
+  deletion_protection = false
+
+  # generated from the proto definitions, see app/pipeline/schema
+  schema = file("${path.module}/schema/module_graph.json")
+}